@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+type StatsRow struct {
+	AvgDailySpend float64 `bun:"avg_daily_spend" json:"avg_daily_spend"`
+	MedianSpend   float64 `bun:"median_spend" json:"median_spend"`
+	P90Spend      float64 `bun:"p90_spend" json:"p90_spend"`
+	BusiestDay    string  `bun:"busiest_day" json:"busiest_day"`
+	Count         int     `bun:"count" json:"count"`
+	DebitCount    int     `bun:"debit_count" json:"debit_count"`
+	CreditCount   int     `bun:"credit_count" json:"credit_count"`
+}
+
+func (trackerDb *trackerDb) getStats(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	q := trackerDb.reports.NewSelect().TableExpr("item AS i")
+	if p.isZero() {
+		q = q.ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'debit'), 0) / GREATEST(MAX(created_at)::date - MIN(created_at)::date + 1, 1) AS avg_daily_spend")
+	} else {
+		q = q.ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'debit'), 0) / ? AS avg_daily_spend", p.days())
+	}
+
+	stats := StatsRow{}
+	err = p.where(q, "created_at").
+		ColumnExpr("COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY cost) FILTER (WHERE type = 'debit'), 0) AS median_spend").
+		ColumnExpr("COALESCE(PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY cost) FILTER (WHERE type = 'debit'), 0) AS p90_spend").
+		ColumnExpr("COALESCE(MODE() WITHIN GROUP (ORDER BY TO_CHAR(created_at, 'FMDay')) FILTER (WHERE type = 'debit'), '') AS busiest_day").
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("COUNT(*) FILTER (WHERE type = 'debit') AS debit_count").
+		ColumnExpr("COUNT(*) FILTER (WHERE type = 'credit') AS credit_count").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
+		Scan(ctx, &stats)
+	if err != nil {
+		log.Printf("Error while getting stats: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	return respondOK(c, stats)
+}
+
+type TopMerchantRow struct {
+	Merchant string  `bun:"merchant" json:"merchant"`
+	Total    float64 `bun:"total" json:"total"`
+	Count    int     `bun:"count" json:"count"`
+}
+
+func (trackerDb *trackerDb) getTop(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	limit := 10
+	if l := c.QueryParam("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > 100 {
+			return respondError(c, http.StatusBadRequest, "limit must be between 1 and 100")
+		}
+	}
+
+	var data interface{}
+	switch c.QueryParam("metric") {
+	case "", "merchants":
+		merchants := []TopMerchantRow{}
+		q := trackerDb.reports.NewSelect().
+			ColumnExpr("COALESCE(display_name, name) AS merchant").
+			ColumnExpr("SUM(cost) AS total").
+			ColumnExpr("COUNT(*) AS count").
+			TableExpr("item").
+			Where("user_id = ?", userID).
+			Apply(analyticsScope(c)).
+			Where("type = 'debit'").
+			GroupExpr("COALESCE(display_name, name)").
+			OrderExpr("total DESC").
+			Limit(limit)
+		err = p.where(q, "created_at").Scan(ctx, &merchants)
+		data = merchants
+	case "transactions":
+		items := []GetItem{}
+		q := trackerDb.reports.NewSelect().
+			TableExpr("item").
+			Where("user_id = ?", userID).
+			Apply(analyticsScope(c)).
+			Where("type = 'debit'").
+			OrderExpr("cost DESC").
+			Limit(limit)
+		err = p.where(q, "created_at").Scan(ctx, &items)
+		data = items
+	default:
+		return respondError(c, http.StatusBadRequest, "metric must be one of merchants, transactions")
+	}
+	if err != nil {
+		log.Printf("Error while getting top spending: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	return respondOK(c, data)
+}
+
+type CompareRow struct {
+	Category string  `bun:"category" json:"category"`
+	ATotal   float64 `bun:"a_total" json:"a_total"`
+	BTotal   float64 `bun:"b_total" json:"b_total"`
+	Delta    float64 `bun:"-" json:"delta"`
+}
+
+// getCompare returns per-category expenses for two periods a and b, with
+// delta being a minus b.
+func (trackerDb *trackerDb) getCompare(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	a, err := parsePeriod(c.QueryParam("a"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	b, err := parsePeriod(c.QueryParam("b"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if a.isZero() || b.isZero() {
+		return respondError(c, http.StatusBadRequest, "both a and b periods are required")
+	}
+
+	total := "COALESCE(SUM(i.cost) FILTER (WHERE i.created_at >= ? AND i.created_at < ?), 0)"
+
+	rows := []CompareRow{}
+	err = trackerDb.reports.NewSelect().
+		ColumnExpr("c.name AS category").
+		ColumnExpr(total+" AS a_total", a.start, a.end).
+		ColumnExpr(total+" AS b_total", b.start, b.end).
+		TableExpr("item i").
+		Join("JOIN category c ON i.category_id = c.id").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
+		Where("i.type = 'debit'").
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("i.created_at >= ? AND i.created_at < ?", a.start, a.end).
+				WhereOr("i.created_at >= ? AND i.created_at < ?", b.start, b.end)
+		}).
+		Group("c.name").
+		Order("category").
+		Scan(ctx, &rows)
+	if err != nil {
+		log.Printf("Error while comparing periods: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	for i := range rows {
+		rows[i].Delta = rows[i].ATotal - rows[i].BTotal
+	}
+
+	return respondOK(c, rows)
+}
+
+// aggregateDimensions and aggregateMetrics whitelist what getAggregate may
+// group by and compute. Values are trusted SQL fragments over "item i" left
+// joined with "category c".
+var aggregateDimensions = map[string]string{
+	"category": "c.name",
+	"merchant": "i.name",
+	"type":     "i.type",
+	"year":     "TO_CHAR(i.created_at, 'YYYY')",
+	"month":    "TO_CHAR(i.created_at, 'YYYY-MM')",
+	"weekday":  "TO_CHAR(i.created_at, 'FMDay')",
+}
+
+var aggregateMetrics = map[string]string{
+	"sum":   "SUM(i.cost)",
+	"count": "COUNT(*)",
+	"avg":   "AVG(i.cost)",
+	"min":   "MIN(i.cost)",
+	"max":   "MAX(i.cost)",
+}
+
+func (trackerDb *trackerDb) getAggregate(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	metric := c.QueryParam("metric")
+	if metric == "" {
+		metric = "sum"
+	}
+	metricExpr, ok := aggregateMetrics[metric]
+	if !ok {
+		return respondError(c, http.StatusBadRequest, fmt.Sprintf("unknown metric %q", metric))
+	}
+
+	q := trackerDb.reports.NewSelect().
+		TableExpr("item i").
+		Join("LEFT JOIN category c ON i.category_id = c.id").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c))
+
+	seen := map[string]bool{}
+	for _, dim := range strings.Split(c.QueryParam("group_by"), ",") {
+		if dim == "" || seen[dim] {
+			continue
+		}
+		expr, ok := aggregateDimensions[dim]
+		if !ok {
+			return respondError(c, http.StatusBadRequest, fmt.Sprintf("unknown dimension %q", dim))
+		}
+		seen[dim] = true
+		q = q.ColumnExpr(expr+" AS ?", bun.Ident(dim)).GroupExpr(expr).OrderExpr(expr)
+	}
+
+	if t := c.QueryParam("type"); t != "" {
+		q = q.Where("i.type = ?", t)
+	}
+
+	rows := []map[string]interface{}{}
+	err = p.where(q, "i.created_at").
+		ColumnExpr(metricExpr+" AS value").
+		Scan(ctx, &rows)
+	if err != nil {
+		log.Printf("Error while aggregating items: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	return respondOK(c, rows)
+}
+
+// locationGrid is the size in degrees (about 500m) of the cells that
+// unnamed locations are clustered into.
+const locationGrid = 0.005
+
+type LocationSpendRow struct {
+	Place     string  `bun:"place" json:"place"`
+	Latitude  float64 `bun:"latitude" json:"latitude"`
+	Longitude float64 `bun:"longitude" json:"longitude"`
+	Spent     float64 `bun:"spent" json:"spent"`
+	Items     int     `bun:"items" json:"items"`
+}
+
+// getLocations clusters spending by where it happened: by place name when
+// the client sent one, otherwise by nearby coordinates.
+func (trackerDb *trackerDb) getLocations(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	cluster := "COALESCE(lower(place), ROUND((latitude / ?)::numeric)::text || ',' || ROUND((longitude / ?)::numeric)::text)"
+	q := trackerDb.reports.NewSelect().
+		ColumnExpr("MIN(place) AS place").
+		ColumnExpr("AVG(latitude) AS latitude").
+		ColumnExpr("AVG(longitude) AS longitude").
+		ColumnExpr("SUM(cost) AS spent").
+		ColumnExpr("COUNT(*) AS items").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Where("type = 'debit'").
+		Where("place IS NOT NULL OR latitude IS NOT NULL").
+		Apply(analyticsScope(c)).
+		GroupExpr(cluster, locationGrid, locationGrid).
+		OrderExpr("spent DESC")
+
+	rows := []LocationSpendRow{}
+	err = p.where(q, "created_at").Scan(ctx, &rows)
+	if err != nil {
+		log.Printf("Error while getting location spend: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	return respondOK(c, rows)
+}
+
+// CategoryMonthlyRow is one category's spending in each month of a year,
+// a row of the budget grid.
+type CategoryMonthlyRow struct {
+	Category string  `bun:"category" json:"category"`
+	Jan      float64 `bun:"jan" json:"jan"`
+	Feb      float64 `bun:"feb" json:"feb"`
+	Mar      float64 `bun:"mar" json:"mar"`
+	Apr      float64 `bun:"apr" json:"apr"`
+	May      float64 `bun:"may" json:"may"`
+	Jun      float64 `bun:"jun" json:"jun"`
+	Jul      float64 `bun:"jul" json:"jul"`
+	Aug      float64 `bun:"aug" json:"aug"`
+	Sep      float64 `bun:"sep" json:"sep"`
+	Oct      float64 `bun:"oct" json:"oct"`
+	Nov      float64 `bun:"nov" json:"nov"`
+	Dec      float64 `bun:"dec" json:"dec"`
+	Total    float64 `bun:"total" json:"total"`
+}
+
+var monthColumns = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// getCategoryMonthly returns spending per category per month of ?year=,
+// the current year by default. Uncategorized spending is its own row.
+func (trackerDb *trackerDb) getCategoryMonthly(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	year := time.Now().Year()
+	if y := c.QueryParam("year"); y != "" {
+		start, err := time.Parse("2006", y)
+		if err != nil {
+			return respondError(c, http.StatusBadRequest, fmt.Sprintf("invalid year %q", y))
+		}
+		year = start.Year()
+	}
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	q := trackerDb.reports.NewSelect().
+		ColumnExpr("COALESCE(c.name, 'Uncategorized') AS category").
+		TableExpr("item i").
+		Join("LEFT JOIN category c ON i.category_id = c.id").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
+		Where("i.type = 'debit'").
+		Where("i.created_at >= ? AND i.created_at < ?", start, start.AddDate(1, 0, 0))
+	for i, col := range monthColumns {
+		q = q.ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE EXTRACT(MONTH FROM i.created_at) = ?), 0) AS ?", i+1, bun.Ident(col))
+	}
+
+	rows := []CategoryMonthlyRow{}
+	err := q.
+		ColumnExpr("SUM(i.cost) AS total").
+		GroupExpr("c.name").
+		OrderExpr("category").
+		Scan(ctx, &rows)
+	if err != nil {
+		log.Printf("Error while getting category monthly spend: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	return respondOK(c, rows)
+}
+
+// getCategoryItems serves GET /dashboard/categories/:id/items, the items
+// behind one slice of the dashboard's category chart: the category's items
+// in ?period= (all time by default), scoped as the chart is so that their
+// totals add up to the slice. ?type=debit or credit keeps one side, and
+// the id "uncategorized" lists items without a category.
+func (trackerDb *trackerDb) getCategoryItems(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "limit must be between 1 and 1000 and offset not negative")
+	}
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	typ := c.QueryParam("type")
+	if typ != "" && typ != "debit" && typ != "credit" {
+		return respondError(c, http.StatusBadRequest, "type must be debit or credit")
+	}
+
+	inCategory := bun.SafeQuery("category_id IS NULL")
+	if id := c.Param("id"); id != "uncategorized" {
+		categoryID, err := uuid.Parse(id)
+		if err != nil {
+			return respondError(c, http.StatusBadRequest, "category id must be a UUID or uncategorized")
+		}
+		exists, err := trackerDb.db.NewSelect().TableExpr("category").Where("id = ?", categoryID).Exists(ctx)
+		if err != nil {
+			log.Printf("Error while getting category: %+v", err)
+			return respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		if !exists {
+			return respondError(c, http.StatusNotFound, "Category not found")
+		}
+		inCategory = bun.SafeQuery("category_id = ?", categoryID)
+	}
+
+	scope := func(q *bun.SelectQuery) *bun.SelectQuery {
+		q = q.TableExpr("item").
+			Where("user_id = ?", userID).
+			Where("?", inCategory).
+			Apply(analyticsScope(c))
+		if typ != "" {
+			q = q.Where("type = ?", typ)
+		}
+		return p.where(q, "created_at")
+	}
+
+	items := []GetItem{}
+	q := trackerDb.reports.NewSelect().Apply(scope).OrderExpr("created_at, id")
+	if limit != 0 {
+		q = q.Limit(limit).Offset(offset)
+	}
+	err = q.Scan(ctx, &items)
+	if err != nil {
+		log.Printf("Error while getting category items: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	var summary ItemsSummary
+	err = trackerDb.reports.NewSelect().
+		Apply(scope).
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'debit'), 0) AS debits").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'credit'), 0) AS credits").
+		Scan(ctx, &summary)
+	if err != nil {
+		log.Printf("Error while getting category items: %+v", err)
+		return respondQueryError(c, err)
+	}
+	summary.Debits = roundMoney(summary.Debits)
+	summary.Credits = roundMoney(summary.Credits)
+	summary.Net = roundMoney(summary.Credits - summary.Debits)
+
+	setSummaryHeaders(c, summary)
+	if limit == 0 {
+		return respondOK(c, items)
+	}
+	return respondPage(c, items, PageMeta{Total: summary.Count, Limit: limit, Offset: offset, Summary: &summary})
+}
+
+// analyticsScope keeps to the selected profile's ledger and drops items
+// that are not real spending or income: scheduled items that haven't
+// happened yet, items the user excluded, reimbursed expenses together with
+// their reimbursement, and balance adjustments unless the client opts in
+// with include_adjustments=true.
+func analyticsScope(c echo.Context) func(*bun.SelectQuery) *bun.SelectQuery {
+	return func(q *bun.SelectQuery) *bun.SelectQuery {
+		q = q.Apply(inProfile(currentProfile(c)))
+		q = q.Where("NOT scheduled")
+		q = q.Where("NOT excluded")
+		q = q.Where("NOT reimbursed")
+		if c.QueryParam("include_adjustments") != "true" {
+			q = q.Where("NOT adjustment")
+		}
+		return q
+	}
+}
+
+// connectReports opens the pool analytics and reports query through. Its
+// connections have Postgres cancel any statement that runs longer than
+// ANALYTICS_TIMEOUT seconds (30 by default), so one pathological report
+// can't hold a connection and the server's CPU for minutes. The driver's
+// own read timeout is set a little later, so the server's cancellation
+// normally arrives first.
+func connectReports(env *Env) *bun.DB {
+	timeout := time.Duration(env.AnalyticsTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return connect(env,
+		pgdriver.WithConnParams(map[string]interface{}{"statement_timeout": timeout.Milliseconds()}),
+		pgdriver.WithReadTimeout(timeout+5*time.Second),
+	)
+}
+
+// queryTimedOut reports whether err is a statement cancelled by
+// statement_timeout or a read that timed out waiting for one.
+func queryTimedOut(err error) bool {
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.Field('C') == "57014"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
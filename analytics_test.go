@@ -0,0 +1,48 @@
+//go:build integration
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestTopMerchants checks that items from one merchant under different
+// raw names are counted together by their display name.
+func TestTopMerchants(t *testing.T) {
+	userID := newTestUser(t)
+	for _, name := range []string{"AMZN MKTP IN*1234", "AMAZON.IN ORDER 5678"} {
+		item := createTestItem(t, userID, map[string]interface{}{"name": name, "cost": 300.0})
+		rec := request(t, http.MethodPatch, "/api/v2/items/"+item.ID.String(), map[string]interface{}{"display_name": "Amazon"})
+		expectStatus(t, rec, http.StatusOK)
+	}
+	createTestItem(t, userID, map[string]interface{}{"name": "Tea", "cost": 500.0})
+
+	rec := request(t, http.MethodGet, fmt.Sprintf("/api/v2/analytics/top?user_id=%d&metric=merchants", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var rows []TopMerchantRow
+	decodeData(t, rec, &rows)
+	want := []TopMerchantRow{{"Amazon", 600, 2}, {"Tea", 500, 1}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("top merchants are %+v, want %+v", rows, want)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/analytics/stats?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var stats StatsRow
+	decodeData(t, rec, &stats)
+	if stats.Count != 3 || stats.DebitCount != 3 {
+		t.Errorf("stats are %+v, want 3 debits", stats)
+	}
+}
+
+func TestAnalyticsErrors(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodGet, fmt.Sprintf("/api/v2/analytics/top?user_id=%d&limit=0", userID), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/analytics/stats?user_id=%d&period=fortnight", userID), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
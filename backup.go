@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// BackupTarget is somewhere off the server, the user's own S3 bucket or
+// WebDAV folder, that their data is copied to every week or month.
+type BackupTarget struct {
+	bun.BaseModel `bun:"table:backup_target,alias:bt"`
+
+	ID     uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID int       `bun:"user_id" json:"user_id"`
+	Name   string    `json:"name"`
+	Kind   string    `json:"kind"`
+	// Schedule is weekly, run on Mondays, or monthly, run on the 1st.
+	Schedule string `json:"schedule"`
+	// Format is json for everything or csv for the items alone.
+	Format string `json:"format"`
+	// Endpoint is the WebDAV folder's URL, or an S3-compatible service's;
+	// empty means AWS.
+	Endpoint    string `bun:",nullzero" json:"endpoint"`
+	Bucket      string `bun:",nullzero" json:"bucket"`
+	Prefix      string `bun:",nullzero" json:"prefix"`
+	Region      string `bun:",nullzero" json:"region"`
+	AccessKeyID string `bun:",nullzero" json:"access_key_id,omitempty"`
+	Username    string `bun:",nullzero" json:"username,omitempty"`
+	// Secret is the S3 secret access key or the WebDAV password. It is
+	// write-only and never sent back.
+	Secret     string    `json:"secret,omitempty"`
+	LastRunAt  time.Time `bun:",nullzero" json:"last_run_at"`
+	LastStatus string    `bun:",nullzero" json:"last_status"`
+	LastError  string    `bun:",nullzero" json:"last_error"`
+	LastFile   string    `bun:",nullzero" json:"last_file"`
+	CreatedAt  time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// Backup is everything a JSON backup holds for one user.
+type Backup struct {
+	ExportedAt    time.Time      `json:"exported_at"`
+	UserID        int            `json:"user_id"`
+	Items         []Item         `json:"items"`
+	Categories    []Category     `json:"categories"`
+	CategoryCaps  []CategoryCap  `json:"category_caps"`
+	Bills         []Bill         `json:"bills"`
+	Loans         []Loan         `json:"loans"`
+	CreditCards   []CreditCard   `json:"credit_cards"`
+	Claims        []Claim        `json:"claims"`
+	Invoices      []Invoice      `json:"invoices"`
+	ItemTemplates []ItemTemplate `json:"item_templates"`
+	MerchantRules []MerchantRule `json:"merchant_rules"`
+	Profiles      []Profile      `json:"profiles"`
+}
+
+var webdavClient = newOutboundClient(2 * time.Minute)
+
+func validateBackupTarget(t *BackupTarget) string {
+	if t.Name == "" {
+		return "name is required"
+	}
+	if t.Schedule != "weekly" && t.Schedule != "monthly" {
+		return "schedule must be weekly or monthly"
+	}
+	if t.Format == "" {
+		t.Format = "json"
+	}
+	if t.Format != "json" && t.Format != "csv" {
+		return "format must be json or csv"
+	}
+	if t.Secret == "" {
+		return "secret is required"
+	}
+
+	switch t.Kind {
+	case "s3":
+		if t.Bucket == "" || t.AccessKeyID == "" {
+			return "bucket and access_key_id are required"
+		}
+		if t.Region == "" {
+			t.Region = "us-east-1"
+		}
+		t.Username = ""
+	case "webdav":
+		if t.Username == "" {
+			return "username is required"
+		}
+		t.Bucket, t.Region, t.AccessKeyID = "", "", ""
+	default:
+		return "kind must be s3 or webdav"
+	}
+	if t.Endpoint != "" || t.Kind == "webdav" {
+		u, err := url.Parse(t.Endpoint)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return "endpoint must be an https URL"
+		}
+	}
+	return ""
+}
+
+// backupData collects what a backup of the user holds, in the target's
+// format. JSON has every table; CSV has the main ledger's items with the
+// same columns as a CSV export of GET /items.
+func (trackerDb *trackerDb) backupData(ctx context.Context, userID int, format string, now time.Time) ([]byte, error) {
+	if format == "csv" {
+		items, _, err := trackerDb.listItems(ctx, itemFilter{UserID: strconv.Itoa(userID)}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		header, records, err := csvRecords(items)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		w := csv.NewWriter(&b)
+		w.Write(header)
+		w.WriteAll(records)
+		return b.Bytes(), w.Error()
+	}
+
+	b := Backup{ExportedAt: now, UserID: userID}
+	db := trackerDb.db
+	byUser := func(q *bun.SelectQuery) *bun.SelectQuery { return q.Where("user_id = ?", userID) }
+	scans := []func() error{
+		func() error { return db.NewSelect().Model(&b.Items).Apply(byUser).Order("created_at", "id").Scan(ctx) },
+		func() error { return db.NewSelect().Model(&b.Categories).Order("name").Scan(ctx) },
+		func() error { return db.NewSelect().Model(&b.CategoryCaps).Apply(byUser).Scan(ctx) },
+		func() error { return db.NewSelect().Model(&b.Bills).Apply(byUser).Scan(ctx) },
+		func() error { return selectLoans(db).Where("l.user_id = ?", userID).Scan(ctx, &b.Loans) },
+		func() error { return db.NewSelect().Model(&b.CreditCards).Apply(byUser).Scan(ctx) },
+		func() error { return db.NewSelect().Model(&b.Claims).Apply(byUser).Scan(ctx) },
+		func() error {
+			return db.NewSelect().Model(&b.Invoices).Relation("Lines").Where("inv.user_id = ?", userID).Scan(ctx)
+		},
+		func() error { return db.NewSelect().Model(&b.ItemTemplates).Apply(byUser).Scan(ctx) },
+		func() error { return db.NewSelect().Model(&b.MerchantRules).Apply(byUser).Scan(ctx) },
+		func() error { return db.NewSelect().Model(&b.Profiles).Apply(byUser).Scan(ctx) },
+	}
+	for _, scan := range scans {
+		err := scan()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(b)
+}
+
+// upload writes a backup file to the target.
+func (t *BackupTarget) upload(ctx context.Context, name string, data []byte) error {
+	if t.Kind == "s3" {
+		u := s3URL(t.Endpoint, t.Bucket, t.Region, t.Prefix+name, nil)
+		res, err := s3Do(ctx, s3Credentials{t.Region, t.AccessKeyID, t.Secret}, http.MethodPut, u, data)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	}
+
+	u, err := url.JoinPath(t.Endpoint, t.Prefix+name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.Username, t.Secret)
+
+	res, err := webdavClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("webdav: %s: %s", res.Status, msg)
+}
+
+// runBackup backs the user up to the target and records how it went. The
+// user is notified when it fails.
+func (trackerDb *trackerDb) runBackup(ctx context.Context, t *BackupTarget, now time.Time) error {
+	name := fmt.Sprintf("finance-tracker-%d-%s.%s", t.UserID, now.Format("2006-01-02"), t.Format)
+	data, err := trackerDb.backupData(ctx, t.UserID, t.Format, now)
+	if err == nil {
+		err = t.upload(ctx, name, data)
+	}
+
+	t.LastRunAt = now
+	t.LastStatus = "ok"
+	t.LastError = ""
+	if err != nil {
+		t.LastStatus = "failed"
+		t.LastError = err.Error()
+		nerr := trackerDb.notify(ctx, t.UserID, fmt.Sprintf("Backup to %s failed: %v", t.Name, err))
+		if nerr != nil {
+			log.Printf("Error while notifying user %d: %v", t.UserID, nerr)
+		}
+	} else {
+		t.LastFile = t.Prefix + name
+	}
+
+	_, uerr := trackerDb.db.NewUpdate().
+		Model(t).
+		Column("last_run_at", "last_status", "last_error", "last_file").
+		WherePK().
+		Exec(ctx)
+	if err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// runBackups is the daily job that runs the weekly backups on Mondays and
+// the monthly ones on the 1st. day is the day that has just ended.
+func (trackerDb *trackerDb) runBackups(ctx context.Context, day time.Time) error {
+	today := day.AddDate(0, 0, 1)
+	schedules := []string{}
+	if today.Weekday() == time.Monday {
+		schedules = append(schedules, "weekly")
+	}
+	if today.Day() == 1 {
+		schedules = append(schedules, "monthly")
+	}
+	if len(schedules) == 0 {
+		return nil
+	}
+
+	targets := []BackupTarget{}
+	err := trackerDb.db.NewSelect().Model(&targets).Where("schedule IN (?)", bun.In(schedules)).Scan(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range targets {
+		err = trackerDb.runBackup(ctx, &targets[i], time.Now().UTC())
+		if err != nil {
+			log.Printf("Error while backing up to %s: %v", targets[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func (trackerDb *trackerDb) addBackupTarget(c echo.Context) error {
+	ctx := context.Background()
+
+	t := new(BackupTarget)
+	err := c.Bind(t)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if msg := validateBackupTarget(t); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	t.ID = uuid.Nil
+	t.LastRunAt = time.Time{}
+	t.LastStatus, t.LastError, t.LastFile = "", "", ""
+
+	_, err = trackerDb.db.NewInsert().Model(t).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	t.Secret = ""
+
+	return respondCreated(c, "", t)
+}
+
+func (trackerDb *trackerDb) getAllBackupTargets(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	targets := []BackupTarget{}
+	err := trackerDb.db.NewSelect().
+		Model(&targets).
+		ExcludeColumn("secret").
+		Where("user_id = ?", userID).
+		Order("name").
+		Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting backup targets: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, targets)
+}
+
+func (trackerDb *trackerDb) deleteBackupTarget(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("backup_target").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Backup target not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// runBackupNow backs up to a target straight away, to try it out. It
+// counts as one of the user's exports.
+func (trackerDb *trackerDb) runBackupNow(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	t := new(BackupTarget)
+	err := trackerDb.db.NewSelect().Model(t).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Backup target not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch backup target: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	release, ok := trackerDb.exports.acquire(strconv.Itoa(t.UserID), concurrencyWait)
+	if !ok {
+		return respondBusy(c, "Too many exports running for this user; try again when one finishes")
+	}
+	defer release()
+
+	err = trackerDb.runBackup(ctx, t, time.Now().UTC())
+	t.Secret = ""
+	if err != nil {
+		log.Printf("Error while backing up: %v", err)
+		return c.JSON(http.StatusBadGateway, Envelope{Message: err.Error(), Data: t})
+	}
+
+	return respondOK(c, t)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// Bill is a monthly payment due on DueDay. Days past the end of a short
+// month fall on its last day. ItemID optionally links the recurring item
+// the bill stands for; paying a bill without a category of its own files
+// the payment under that item's.
+type Bill struct {
+	bun.BaseModel `bun:"table:bill,alias:b"`
+
+	ID         uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID     int       `bun:"user_id" json:"user_id"`
+	Name       string    `json:"name"`
+	Amount     float64   `json:"amount"`
+	DueDay     int       `json:"due_day"`
+	Autopay    bool      `json:"autopay"`
+	CategoryID uuid.UUID `bun:"type:uuid,nullzero" json:"category_id"`
+	ItemID     uuid.UUID `bun:"type:uuid,nullzero" json:"item_id"`
+	LastPaidOn Date      `bun:"type:date,nullzero" json:"last_paid_on"`
+	CreatedAt  time.Time `bun:",nullzero,default:now()" json:"created_at"`
+	NextDueOn  Date      `bun:"-" json:"next_due_on"`
+	Overdue    bool      `bun:"-" json:"overdue"`
+}
+
+func (b *Bill) dueDate(year int, month time.Month) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return time.Date(year, month, min(b.DueDay, last), 0, 0, 0, 0, time.UTC)
+}
+
+// schedule fills in NextDueOn and Overdue as of today. A due date counts as
+// paid when the last payment came after the previous month's due date.
+func (b *Bill) schedule(today time.Time) {
+	due := b.dueDate(today.Year(), today.Month())
+	prev := b.dueDate(today.Year(), today.Month()-1)
+	if b.LastPaidOn.After(prev) {
+		due = b.dueDate(today.Year(), today.Month()+1)
+	}
+
+	b.NextDueOn = Date{due}
+	b.Overdue = due.Before(today)
+}
+
+func (trackerDb *trackerDb) addBill(c echo.Context) error {
+	ctx := context.Background()
+
+	bill := new(Bill)
+	err := c.Bind(bill)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if bill.DueDay < 1 || bill.DueDay > 31 {
+		return respondError(c, http.StatusBadRequest, "due_day must be between 1 and 31")
+	}
+	bill.ID = uuid.Nil
+
+	_, err = trackerDb.db.NewInsert().Model(bill).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	bill.schedule(today())
+
+	return respondCreated(c, apiPath(c, "/bills/"+bill.ID.String()), bill)
+}
+
+func (trackerDb *trackerDb) getBill(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	bill := new(Bill)
+	err := trackerDb.db.NewSelect().Model(bill).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Bill not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch bill: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	bill.schedule(today())
+
+	return respondOK(c, bill)
+}
+
+func (trackerDb *trackerDb) getAllBills(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	bills := []Bill{}
+	err := trackerDb.db.NewSelect().Model(&bills).Where("user_id = ?", userID).Order("due_day").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting bills: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	t := today()
+	for i := range bills {
+		bills[i].schedule(t)
+	}
+
+	return respondOK(c, bills)
+}
+
+// getUpcomingBills returns bills that are overdue or due within the next
+// days (7 by default), soonest first.
+func (trackerDb *trackerDb) getUpcomingBills(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	days := 7
+	if d := c.QueryParam("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 0 {
+			return respondError(c, http.StatusBadRequest, "days must be a non-negative number")
+		}
+	}
+
+	bills := []Bill{}
+	err := trackerDb.db.NewSelect().Model(&bills).Where("user_id = ?", userID).Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting bills: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	t := today()
+	horizon := t.AddDate(0, 0, days)
+	upcoming := []Bill{}
+	for _, b := range bills {
+		b.schedule(t)
+		if !b.NextDueOn.After(horizon) {
+			upcoming = append(upcoming, b)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].NextDueOn.Before(upcoming[j].NextDueOn.Time)
+	})
+
+	return respondOK(c, upcoming)
+}
+
+// payBill records the bill's amount as a debit item, which is checked like
+// any new item, and marks it paid today.
+func (trackerDb *trackerDb) payBill(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	bill := new(Bill)
+	var item *Item
+	err := trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().Model(bill).Where("id = ?", id).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		categoryID := bill.CategoryID
+		if categoryID == uuid.Nil && bill.ItemID != uuid.Nil {
+			err = tx.NewSelect().Model((*Item)(nil)).Column("category_id").Where("id = ?", bill.ItemID).Scan(ctx, &categoryID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+
+		item = &Item{
+			Name:       bill.Name,
+			Cost:       roundMoney(bill.Amount),
+			Type:       "debit",
+			CategoryID: categoryID,
+			UserID:     bill.UserID,
+			ProfileID:  currentProfile(c),
+		}
+		err = trackerDb.insertItem(ctx, tx, item, c.QueryParam("override_cap") == "true")
+		if err != nil {
+			return err
+		}
+
+		bill.LastPaidOn = Date{today()}
+		_, err = tx.NewUpdate().Model(bill).Column("last_paid_on").WherePK().Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Bill not found")
+	}
+	if err != nil {
+		return respondItemError(c, err, "paying bill")
+	}
+	trackerDb.fireHooks(item.UserID, eventItemCreated, item)
+	bill.schedule(today())
+
+	return respondOK(c, bill)
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// remindBills is the daily job that tells users when an unpaid bill falls
+// due in BILL_REMIND_DAYS days (3 by default) or today, and once more the
+// day after when it is overdue.
+func (trackerDb *trackerDb) remindBills(ctx context.Context, day time.Time) error {
+	lead := trackerDb.env.BillRemindDays
+	if lead <= 0 {
+		lead = 3
+	}
+
+	bills := []Bill{}
+	err := trackerDb.db.NewSelect().Model(&bills).Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, bill := range bills {
+		bill.schedule(day)
+		days := int(bill.NextDueOn.Sub(day).Hours() / 24)
+		var when string
+		switch days {
+		case lead:
+			when = "is due on " + bill.NextDueOn.Format("2 Jan")
+		case 0:
+			when = "is due today"
+		case -1:
+			when = "was due yesterday and is overdue"
+		default:
+			continue
+		}
+
+		money, err := trackerDb.moneyFormat(ctx, bill.UserID)
+		if err != nil {
+			return err
+		}
+		err = trackerDb.notify(ctx, bill.UserID, fmt.Sprintf("%s: %s %s", bill.Name, money.format(bill.Amount), when))
+		if err != nil {
+			log.Printf("Error while reminding user %d about bill %s: %+v", bill.UserID, bill.ID, err)
+		}
+	}
+	return nil
+}
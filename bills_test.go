@@ -0,0 +1,60 @@
+//go:build integration
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBillPay(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v2/bills", map[string]interface{}{
+		"user_id": userID, "name": "Rent", "amount": 15000.0, "due_day": 5,
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var bill Bill
+	decodeData(t, rec, &bill)
+	loc := rec.Header().Get("Location")
+	if loc != "/api/v2/bills/"+bill.ID.String() {
+		t.Errorf("Location is %q", loc)
+	}
+
+	rec = request(t, http.MethodGet, loc, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var got Bill
+	decodeData(t, rec, &got)
+	if got.Name != "Rent" || got.NextDueOn.IsZero() {
+		t.Errorf("fetched %+v, want the new bill with its next due date", got)
+	}
+
+	rec = request(t, http.MethodPost, loc+"/pay", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var paid Bill
+	decodeData(t, rec, &paid)
+	if !paid.LastPaidOn.Equal(today()) {
+		t.Errorf("bill was last paid on %v, want today", paid.LastPaidOn)
+	}
+
+	items := listTestItems(t, userID)
+	if len(items) != 1 || items[0].Name != "Rent" || items[0].Cost != 15000 || items[0].Type != "debit" {
+		t.Errorf("paying the bill saved %+v, want one debit of 15000", items)
+	}
+}
+
+func TestBillErrors(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v2/bills", map[string]interface{}{
+		"user_id": userID, "name": "Rent", "amount": 15000.0, "due_day": 32,
+	})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = request(t, http.MethodGet, "/api/v2/bills/"+uuid.NewString(), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = request(t, http.MethodPost, "/api/v2/bills/"+uuid.NewString()+"/pay", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
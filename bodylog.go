@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+)
+
+// maxLoggedBody is how much of each redacted body is written to the log.
+const maxLoggedBody = 2048
+
+// sensitiveKeys are redacted wherever they appear in a body or query
+// string. A key matches if it contains any of them, ignoring case.
+var sensitiveKeys = []string{"password", "token", "secret", "api_key", "apikey", "authorization", "note", "webhook_url", "target_url", "private_key", "account_number"}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if isSensitive(k) {
+				v[k] = "[REDACTED]"
+			} else {
+				v[k] = redactJSON(val)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	}
+	return v
+}
+
+func redactValues(values url.Values) string {
+	for k := range values {
+		if isSensitive(k) {
+			values[k] = []string{"[REDACTED]"}
+		}
+	}
+	return values.Encode()
+}
+
+// redactBody returns a loggable form of body. JSON and form bodies have
+// sensitive fields redacted; anything else, like uploaded images or raw
+// emails, is reduced to its size.
+func redactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var s string
+	switch {
+	case strings.HasPrefix(contentType, echo.MIMEApplicationJSON):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return "[invalid JSON]"
+		}
+		b, _ := json.Marshal(redactJSON(v))
+		s = string(b)
+	case strings.HasPrefix(contentType, echo.MIMEApplicationForm):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "[invalid form]"
+		}
+		s = redactValues(values)
+	default:
+		return "[" + strings.SplitN(contentType, ";", 2)[0] + " body omitted]"
+	}
+
+	if len(s) > maxLoggedBody {
+		s = s[:maxLoggedBody] + "...[truncated]"
+	}
+	return s
+}
+
+// bodyLogger logs request and response bodies for debugging, with
+// sensitive fields redacted. It is only installed when LOG_BODIES is set.
+func bodyLogger() echo.MiddlewareFunc {
+	return middleware.BodyDumpWithConfig(middleware.BodyDumpConfig{
+		Skipper: func(c echo.Context) bool {
+			return strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm)
+		},
+		Handler: func(c echo.Context, req, res []byte) {
+			r := c.Request()
+			target := r.URL.Path
+			if r.URL.RawQuery != "" {
+				target += "?" + redactValues(r.URL.Query())
+			}
+			log.Printf("%s %s %d request=%s response=%s",
+				r.Method, target, c.Response().Status,
+				redactBody(r.Header.Get(echo.HeaderContentType), req),
+				redactBody(c.Response().Header().Get(echo.HeaderContentType), res))
+		},
+	})
+}
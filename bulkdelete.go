@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// bulkDeleteSample is how many of the matched items a bulk delete shows.
+const bulkDeleteSample = 10
+
+// BulkDeleteRequest picks the items to delete either by id or by date range
+// and category. Nothing is deleted unless Confirm is the token returned by
+// a dry run of the same filter.
+type BulkDeleteRequest struct {
+	UserID     int         `json:"user_id"`
+	IDs        []uuid.UUID `json:"ids"`
+	From       Date        `json:"from"`
+	To         Date        `json:"to"`
+	CategoryID uuid.UUID   `json:"category_id"`
+	DryRun     bool        `json:"dry_run"`
+	Confirm    string      `json:"confirm"`
+}
+
+type BulkDeleteResult struct {
+	Count   int       `json:"count"`
+	Sample  []GetItem `json:"sample"`
+	Confirm string    `json:"confirm,omitempty"`
+	Deleted bool      `json:"deleted"`
+}
+
+var errBulkDeleteChanged = errors.New("the items matching the filter changed since the dry run; run it again")
+
+func (r *BulkDeleteRequest) validate() string {
+	if r.UserID == 0 {
+		return "user_id is required"
+	}
+	if len(r.IDs) > 0 && (!r.From.IsZero() || !r.To.IsZero() || r.CategoryID != uuid.Nil) {
+		return "filter by ids or by date range and category, not both"
+	}
+	if len(r.IDs) == 0 && (r.From.IsZero() || r.To.IsZero()) {
+		return "ids or both from and to are required"
+	}
+	if r.To.Before(r.From.Time) {
+		return "to must not be before from"
+	}
+	if !r.DryRun && r.Confirm == "" {
+		return "run with dry_run=true first and send back its confirm token"
+	}
+	return ""
+}
+
+func (r *BulkDeleteRequest) where(profile uuid.UUID) func(*bun.SelectQuery) *bun.SelectQuery {
+	return func(q *bun.SelectQuery) *bun.SelectQuery {
+		q = q.Where("user_id = ?", r.UserID).Apply(inProfile(profile))
+		if len(r.IDs) > 0 {
+			return q.Where("id IN (?)", bun.In(r.IDs))
+		}
+		q = q.Where("created_at >= ?", r.From.Time).
+			Where("created_at < ?", r.To.AddDate(0, 0, 1))
+		if r.CategoryID != uuid.Nil {
+			q = q.Where("category_id = ?", r.CategoryID)
+		}
+		return q
+	}
+}
+
+// bulkDeleteToken identifies the exact set of items a filter matched, so a
+// delete only goes ahead if it would remove what the dry run showed.
+func bulkDeleteToken(ids []uuid.UUID) string {
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write(id[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bulkDeleteItems deletes many items at once. A dry run reports how many
+// items the filter matches, a sample of them and a confirm token; the
+// delete itself must send that token back, and is refused with a 409 if
+// the matching items have changed since.
+func (trackerDb *trackerDb) bulkDeleteItems(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(BulkDeleteRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if msg := req.validate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+
+	var result BulkDeleteResult
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var ids []uuid.UUID
+		err := tx.NewSelect().
+			Column("id").
+			TableExpr("item").
+			Apply(req.where(currentProfile(c))).
+			OrderExpr("id").
+			Scan(ctx, &ids)
+		if err != nil {
+			return err
+		}
+
+		result = BulkDeleteResult{Count: len(ids), Sample: []GetItem{}, Confirm: bulkDeleteToken(ids)}
+		if len(ids) > 0 {
+			err = tx.NewSelect().
+				TableExpr("item").
+				Where("id IN (?)", bun.In(ids[:min(len(ids), bulkDeleteSample)])).
+				OrderExpr("created_at, id").
+				Scan(ctx, &result.Sample)
+			if err != nil {
+				return err
+			}
+		}
+		if req.DryRun {
+			return nil
+		}
+
+		if req.Confirm != result.Confirm {
+			return errBulkDeleteChanged
+		}
+		result.Confirm = ""
+		if len(ids) > 0 {
+			_, err = tx.NewDelete().TableExpr("item").Where("id IN (?)", bun.In(ids)).Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		result.Deleted = true
+		return nil
+	})
+	if errors.Is(err, errBulkDeleteChanged) {
+		return c.JSON(http.StatusConflict, Envelope{Message: err.Error(), Data: result})
+	}
+	if err != nil {
+		log.Printf("Error while bulk deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, result)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// calendarMonths is how far ahead bill due dates are listed in the feed.
+const calendarMonths = 12
+
+// calendarToken signs the user id so a calendar app can fetch the feed
+// without credentials. Tokens look like "42.<signature>".
+func (trackerDb *trackerDb) calendarToken(userID int) string {
+	mac := hmac.New(sha256.New, []byte(trackerDb.env.CalendarSecret))
+	mac.Write([]byte("calendar:" + strconv.Itoa(userID)))
+	return strconv.Itoa(userID) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (trackerDb *trackerDb) calendarUser(token string) (int, bool) {
+	id, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, false
+	}
+	return userID, hmac.Equal([]byte(token), []byte(trackerDb.calendarToken(userID)))
+}
+
+func (trackerDb *trackerDb) getCalendarToken(c echo.Context) error {
+	if trackerDb.env.CalendarSecret == "" {
+		return respondError(c, http.StatusServiceUnavailable, "calendar feed is not configured")
+	}
+	userID, err := strconv.Atoi(c.QueryParam("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+
+	return respondOK(c, map[string]string{"token": trackerDb.calendarToken(userID)})
+}
+
+// icsEscape escapes text for an iCalendar property value.
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+func writeICSEvent(b *strings.Builder, uid string, day time.Time, summary, description string) {
+	fmt.Fprintf(b, "BEGIN:VEVENT\r\n")
+	fmt.Fprintf(b, "UID:%s@finance-tracker\r\n", uid)
+	fmt.Fprintf(b, "DTSTAMP:%s\r\n", time.Now().UTC().Format("20060102T150405Z"))
+	fmt.Fprintf(b, "DTSTART;VALUE=DATE:%s\r\n", day.Format("20060102"))
+	fmt.Fprintf(b, "DTEND;VALUE=DATE:%s\r\n", day.AddDate(0, 0, 1).Format("20060102"))
+	fmt.Fprintf(b, "SUMMARY:%s\r\n", icsEscape(summary))
+	fmt.Fprintf(b, "DESCRIPTION:%s\r\n", icsEscape(description))
+	fmt.Fprintf(b, "END:VEVENT\r\n")
+}
+
+// getCalendar serves an iCalendar feed of the user's bill due dates for the
+// coming year and the due dates of loans still outstanding.
+func (trackerDb *trackerDb) getCalendar(c echo.Context) error {
+	ctx := context.Background()
+
+	if trackerDb.env.CalendarSecret == "" {
+		return respondError(c, http.StatusServiceUnavailable, "calendar feed is not configured")
+	}
+	userID, ok := trackerDb.calendarUser(c.QueryParam("token"))
+	if !ok {
+		return respondError(c, http.StatusUnauthorized, "invalid token")
+	}
+
+	bills := []Bill{}
+	err := trackerDb.db.NewSelect().Model(&bills).Where("user_id = ?", userID).Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting bills: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	loans := []Loan{}
+	err = selectLoans(trackerDb.db).
+		Where("l.user_id = ?", userID).
+		Where("l.due_on IS NOT NULL").
+		Having("l.amount - COALESCE(SUM(i.cost), 0) > 0").
+		Scan(ctx, &loans)
+	if err != nil {
+		log.Printf("Error while getting loans: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	money, err := trackerDb.moneyFormat(ctx, userID)
+	if err != nil {
+		log.Printf("Could not fetch preferences: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//finance-tracker//calendar//EN\r\nX-WR-CALNAME:Bills\r\n")
+
+	t := today()
+	for _, bill := range bills {
+		bill.schedule(t)
+		due := bill.NextDueOn.Time
+		for i := 0; i < calendarMonths; i++ {
+			day := bill.dueDate(due.Year(), due.Month()+time.Month(i))
+			desc := money.format(bill.Amount) + " due"
+			if bill.Autopay {
+				desc += " (autopay)"
+			}
+			writeICSEvent(&b, bill.ID.String()+"-"+day.Format("20060102"), day, bill.Name, desc)
+		}
+	}
+	for _, loan := range loans {
+		summary := "Repay " + loan.Counterparty
+		if loan.Direction == "lent" {
+			summary = loan.Counterparty + " owes you"
+		}
+		writeICSEvent(&b, loan.ID.String(), loan.DueOn.Time, summary, money.format(loan.Outstanding)+" outstanding")
+	}
+
+	b.WriteString("END:VCALENDAR\r\n")
+
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", []byte(b.String()))
+}
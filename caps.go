@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// CategoryCap is how much a user means to spend in a category each calendar
+// month. Hard caps are enforced when items are created; soft caps are only
+// informational.
+type CategoryCap struct {
+	bun.BaseModel `bun:"table:category_cap,alias:cc"`
+
+	UserID     int       `bun:"user_id,pk" json:"user_id"`
+	CategoryID uuid.UUID `bun:"category_id,pk,type:uuid" json:"category_id"`
+	Amount     float64   `json:"amount"`
+	Hard       bool      `json:"hard"`
+	// A cap in a foreign currency, like a EUR travel budget, has Amount in
+	// Currency and the rate that converts it into the base currency. Items
+	// paid in that currency count at what was actually paid; others are
+	// converted at the cap's rate.
+	Currency     string  `bun:",nullzero" json:"currency"`
+	ExchangeRate float64 `bun:",nullzero" json:"exchange_rate"`
+}
+
+// checkCurrency checks the currency fields of a cap and returns a message
+// for the client if they don't add up.
+func (l *CategoryCap) checkCurrency() string {
+	if l.Currency == "" && l.ExchangeRate == 0 {
+		return ""
+	}
+	if !currencyCode.MatchString(l.Currency) {
+		return "currency must be a three-letter currency code"
+	}
+	if l.ExchangeRate <= 0 {
+		return "exchange_rate must be positive"
+	}
+	return ""
+}
+
+// spending is what item counts for against the cap, in the cap's currency.
+func (l *CategoryCap) spending(item *Item) float64 {
+	if l.Currency == "" {
+		return item.Cost
+	}
+	if item.OriginalCurrency == l.Currency {
+		return item.OriginalAmount
+	}
+	return item.Cost / l.ExchangeRate
+}
+
+// capSpending is the SQL for what an item i counts for against the cap cc,
+// in the cap's currency, as CategoryCap.spending works it out.
+var capSpending = bun.SafeQuery(`CASE
+	WHEN cc.currency IS NULL THEN i.cost
+	WHEN i.original_currency = cc.currency THEN i.original_amount
+	ELSE i.cost / cc.exchange_rate
+END`)
+
+// CapExceeded is returned with a 409 when an item would take a category over
+// its hard cap.
+// Amounts are in Currency if the cap has one, and the base currency if not.
+type CapExceeded struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	Cap        float64   `json:"cap"`
+	Spent      float64   `json:"spent"`
+	Overage    float64   `json:"overage"`
+	Currency   string    `json:"currency,omitempty"`
+}
+
+func (e *CapExceeded) Error() string {
+	overage := fmt.Sprintf("%.2f", e.Overage)
+	if e.Currency != "" {
+		overage += " " + e.Currency
+	}
+	return fmt.Sprintf("this would go %s over the category's cap; repeat with override_cap=true to save it anyway", overage)
+}
+
+// checkCap returns a *CapExceeded if item is a debit that would take its
+// category's spending for the month over a hard cap. Excluded items never
+// count towards a cap. Caps apply to each of the user's ledgers apart, so
+// only spending in the item's profile counts. An item already saved, as
+// when it is edited, is counted once at its new amount.
+func checkCap(ctx context.Context, db bun.IDB, item *Item) error {
+	if item.Type != "debit" || item.CategoryID == uuid.Nil || item.Excluded {
+		return nil
+	}
+
+	limit := new(CategoryCap)
+	err := db.NewSelect().
+		Model(limit).
+		Where("user_id = ?", item.UserID).
+		Where("category_id = ?", item.CategoryID).
+		Where("hard").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	at := item.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	month := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var spent float64
+	err = db.NewSelect().
+		ColumnExpr("COALESCE(SUM(?), 0)", capSpending).
+		TableExpr("item AS i").
+		Join("JOIN category_cap AS cc ON cc.user_id = i.user_id AND cc.category_id = i.category_id").
+		Where("i.user_id = ?", item.UserID).
+		Where("i.category_id = ?", item.CategoryID).
+		Where("?", profileCond("i.profile_id", item.ProfileID)).
+		Where("i.id <> ?", item.ID).
+		Where("i.type = 'debit'").
+		Where("NOT i.reimbursed").
+		Where("NOT i.adjustment").
+		Where("NOT i.excluded").
+		Where("i.created_at >= ?", month).
+		Where("i.created_at < ?", month.AddDate(0, 1, 0)).
+		Scan(ctx, &spent)
+	if err != nil {
+		return err
+	}
+	spent = roundMoney(spent)
+
+	overage := roundMoney(spent + limit.spending(item) - limit.Amount)
+	if overage <= 0 {
+		return nil
+	}
+	return &CapExceeded{CategoryID: limit.CategoryID, Cap: limit.Amount, Spent: spent, Overage: overage, Currency: limit.Currency}
+}
+
+// putCategoryCap sets the monthly cap on a category for a user.
+func (trackerDb *trackerDb) putCategoryCap(c echo.Context) error {
+	ctx := context.Background()
+
+	limit := new(CategoryCap)
+	err := c.Bind(limit)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	limit.CategoryID, err = uuid.Parse(c.Param("category_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "category_id must be a UUID")
+	}
+	if limit.Amount <= 0 {
+		return respondError(c, http.StatusBadRequest, "amount must be positive")
+	}
+	if limit.Currency == trackerDb.env.Currency {
+		limit.Currency, limit.ExchangeRate = "", 0
+	}
+	if msg := limit.checkCurrency(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+
+	_, err = trackerDb.db.NewInsert().
+		Model(limit).
+		On("CONFLICT (user_id, category_id) DO UPDATE").
+		Set("amount = EXCLUDED.amount").
+		Set("hard = EXCLUDED.hard").
+		Set("currency = EXCLUDED.currency").
+		Set("exchange_rate = EXCLUDED.exchange_rate").
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, limit)
+}
+
+func (trackerDb *trackerDb) getAllCategoryCaps(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	caps := []CategoryCap{}
+	err := trackerDb.db.NewSelect().Model(&caps).Where("user_id = ?", userID).Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting category caps: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, caps)
+}
+
+// CapProgress is how a cap stands in a month. Amount, Spent and Remaining
+// are in the cap's currency; the Base fields are the same in the base
+// currency, with the cap converted at its rate. For a cap in the base
+// currency the two sets are the same.
+type CapProgress struct {
+	CategoryID    uuid.UUID `bun:"category_id" json:"category_id"`
+	Category      string    `bun:"category" json:"category"`
+	Hard          bool      `bun:"hard" json:"hard"`
+	Currency      string    `bun:"currency" json:"currency"`
+	ExchangeRate  float64   `bun:"exchange_rate" json:"exchange_rate"`
+	Amount        float64   `bun:"amount" json:"amount"`
+	Spent         float64   `bun:"spent" json:"spent"`
+	Remaining     float64   `bun:"-" json:"remaining"`
+	BaseCurrency  string    `bun:"-" json:"base_currency"`
+	BaseAmount    float64   `bun:"-" json:"base_amount"`
+	BaseSpent     float64   `bun:"base_spent" json:"base_spent"`
+	BaseRemaining float64   `bun:"-" json:"base_remaining"`
+}
+
+// getCapProgress serves GET /category-caps/progress, how much of each of
+// the user's caps has been spent in ?month= (YYYY-MM, this month by
+// default) in the X-Profile-ID ledger.
+func (trackerDb *trackerDb) getCapProgress(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if m := c.QueryParam("month"); m != "" {
+		var err error
+		month, err = time.Parse("2006-01", m)
+		if err != nil {
+			return respondError(c, http.StatusBadRequest, fmt.Sprintf("invalid month %q", m))
+		}
+	}
+
+	progress := []CapProgress{}
+	err := trackerDb.db.NewSelect().
+		ColumnExpr("cc.category_id, c.name AS category, cc.hard, cc.amount").
+		ColumnExpr("COALESCE(cc.currency, ?) AS currency", trackerDb.env.Currency).
+		ColumnExpr("COALESCE(cc.exchange_rate, 1) AS exchange_rate").
+		ColumnExpr("COALESCE(SUM(?), 0) AS spent", capSpending).
+		ColumnExpr("COALESCE(SUM(i.cost), 0) AS base_spent").
+		TableExpr("category_cap AS cc").
+		Join("JOIN category AS c ON c.id = cc.category_id").
+		Join(`LEFT JOIN item AS i ON i.user_id = cc.user_id AND i.category_id = cc.category_id
+			AND i.type = 'debit' AND NOT i.reimbursed AND NOT i.adjustment AND NOT i.excluded
+			AND i.created_at >= ? AND i.created_at < ? AND ?`,
+			month, month.AddDate(0, 1, 0), profileCond("i.profile_id", currentProfile(c))).
+		Where("cc.user_id = ?", userID).
+		GroupExpr("cc.category_id, c.name, cc.hard, cc.amount, cc.currency, cc.exchange_rate").
+		OrderExpr("c.name").
+		Scan(ctx, &progress)
+	if err != nil {
+		log.Printf("Error while getting cap progress: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	for i := range progress {
+		p := &progress[i]
+		p.Spent = roundMoney(p.Spent)
+		p.Remaining = roundMoney(p.Amount - p.Spent)
+		p.BaseCurrency = trackerDb.env.Currency
+		p.BaseAmount = roundMoney(p.Amount * p.ExchangeRate)
+		p.BaseSpent = roundMoney(p.BaseSpent)
+		p.BaseRemaining = roundMoney(p.BaseAmount - p.BaseSpent)
+	}
+
+	return respondOK(c, progress)
+}
+
+func (trackerDb *trackerDb) deleteCategoryCap(c echo.Context) error {
+	ctx := context.Background()
+	userID, err := strconv.Atoi(c.QueryParam("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+
+	res, err := trackerDb.db.NewDelete().
+		TableExpr("category_cap").
+		Where("user_id = ?", userID).
+		Where("category_id = ?", c.Param("category_id")).
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Category cap not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
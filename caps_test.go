@@ -0,0 +1,58 @@
+//go:build integration
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestHardCap checks that items past a hard cap are refused with the
+// overage, whether added directly or by paying a bill, unless the cap is
+// overridden.
+func TestHardCap(t *testing.T) {
+	userID := newTestUser(t)
+	category := createTestCategory(t)
+	path := "/api/v2/category-caps/" + category.ID.String()
+
+	rec := request(t, http.MethodPut, path, map[string]interface{}{"user_id": userID, "amount": 100.0, "hard": true})
+	expectStatus(t, rec, http.StatusOK)
+
+	// Dated now rather than an hour ago, so all of it lands in this month.
+	item := map[string]interface{}{
+		"name": "Snacks", "cost": 80.0, "type": "debit", "user_id": userID,
+		"category_id": category.ID, "created_at": time.Now().UTC(),
+	}
+	rec = request(t, http.MethodPost, "/api/v2/items", item)
+	expectStatus(t, rec, http.StatusCreated)
+
+	item["cost"] = 50.0
+	rec = request(t, http.MethodPost, "/api/v2/items", item)
+	expectStatus(t, rec, http.StatusConflict)
+	var exceeded CapExceeded
+	decodeData(t, rec, &exceeded)
+	if exceeded.Overage != 30 {
+		t.Errorf("refused with %+v, want an overage of 30", exceeded)
+	}
+
+	rec = request(t, http.MethodPost, "/api/v2/bills", map[string]interface{}{
+		"user_id": userID, "name": "Gym", "amount": 40.0, "due_day": 1, "category_id": category.ID,
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	bill := rec.Header().Get("Location")
+	rec = request(t, http.MethodPost, bill+"/pay", nil)
+	expectStatus(t, rec, http.StatusConflict)
+	rec = request(t, http.MethodPost, bill+"/pay?override_cap=true", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestCapErrors(t *testing.T) {
+	userID := newTestUser(t)
+	category := createTestCategory(t)
+
+	rec := request(t, http.MethodPut, "/api/v2/category-caps/"+category.ID.String(), map[string]interface{}{"user_id": userID, "amount": 0})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = request(t, http.MethodPut, "/api/v2/category-caps/groceries", map[string]interface{}{"user_id": userID, "amount": 100.0})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// cardRemindDays are how many days before a statement's due date an unpaid
+// balance is reminded of.
+var cardRemindDays = []int{3, 0}
+
+// CreditCard is a card whose statement closes on StatementDay each month
+// and is due on the next DueDay after that. Debit items with its card_id
+// are charges; credit items are payments and refunds.
+type CreditCard struct {
+	bun.BaseModel `bun:"table:credit_card,alias:cr"`
+
+	ID           uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID       int       `bun:"user_id" json:"user_id"`
+	Name         string    `json:"name"`
+	StatementDay int       `json:"statement_day"`
+	DueDay       int       `json:"due_day"`
+	CreditLimit  float64   `bun:",nullzero" json:"credit_limit"`
+	// SpendingLimit is how much the user means to charge to the card each
+	// calendar month. They are alerted once a month when charges reach
+	// AlertPercent of it.
+	SpendingLimit  float64   `bun:",nullzero" json:"spending_limit"`
+	AlertPercent   int       `bun:",nullzero,default:80" json:"alert_percent"`
+	LimitAlertedOn time.Time `bun:",nullzero" json:"-"`
+	CreatedAt      time.Time `bun:",nullzero,default:now()" json:"created_at"`
+	// Outstanding is everything charged and not yet paid, including the
+	// cycle that hasn't closed.
+	Outstanding   float64        `bun:"-" json:"outstanding"`
+	Available     float64        `bun:"-" json:"available,omitempty"`
+	LastStatement *CardStatement `bun:"-" json:"last_statement"`
+	// SpentThisMonth is what has been charged since the start of the month,
+	// and Utilization that as a percentage of SpendingLimit.
+	SpentThisMonth float64 `bun:"-" json:"spent_this_month"`
+	Utilization    float64 `bun:"-" json:"utilization,omitempty"`
+}
+
+// CardStatement is one closed cycle of a card. Paid counts payments and
+// refunds from the day after it closed until it is due, or until today
+// before then.
+type CardStatement struct {
+	From      Date    `json:"from"`
+	ClosingOn Date    `json:"closing_on"`
+	DueOn     Date    `json:"due_on"`
+	Opening   float64 `json:"opening"`
+	Charges   float64 `json:"charges"`
+	Credits   float64 `json:"credits"`
+	Balance   float64 `json:"balance"`
+	Paid      float64 `json:"paid"`
+	Unpaid    float64 `json:"unpaid"`
+	Overdue   bool    `json:"overdue"`
+}
+
+func (card *CreditCard) validate() string {
+	if card.Name == "" {
+		return "name is required"
+	}
+	if card.StatementDay < 1 || card.StatementDay > 31 {
+		return "statement_day must be between 1 and 31"
+	}
+	if card.DueDay < 1 || card.DueDay > 31 {
+		return "due_day must be between 1 and 31"
+	}
+	if card.CreditLimit < 0 {
+		return "credit_limit must not be negative"
+	}
+	return card.validateLimit()
+}
+
+func (card *CreditCard) validateLimit() string {
+	if card.SpendingLimit < 0 {
+		return "spending_limit must not be negative"
+	}
+	if card.AlertPercent < 0 || card.AlertPercent > 100 {
+		return "alert_percent must be between 1 and 100"
+	}
+	return ""
+}
+
+// dayIn is day of the given month, or the month's last day if it is
+// shorter.
+func dayIn(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return time.Date(year, month, min(day, last), 0, 0, 0, 0, time.UTC)
+}
+
+// closings returns the last n statement closing dates on or before today,
+// newest first.
+func (card *CreditCard) closings(today time.Time, n int) []time.Time {
+	year, month := today.Year(), today.Month()
+	if dayIn(year, month, card.StatementDay).After(today) {
+		month--
+	}
+	dates := make([]time.Time, n)
+	for i := range dates {
+		dates[i] = dayIn(year, month-time.Month(i), card.StatementDay)
+	}
+	return dates
+}
+
+// dueOn is when the statement closing on closing is due: the first DueDay
+// after it.
+func (card *CreditCard) dueOn(closing time.Time) time.Time {
+	due := dayIn(closing.Year(), closing.Month(), card.DueDay)
+	if !due.After(closing) {
+		due = dayIn(closing.Year(), closing.Month()+1, card.DueDay)
+	}
+	return due
+}
+
+// statements works out the card's last n statements, newest first, and
+// what is outstanding on it today. Scheduled items count once their date
+// arrives.
+func (card *CreditCard) statements(ctx context.Context, db bun.IDB, today time.Time, n int) ([]CardStatement, float64, error) {
+	closings := card.closings(today, n+1)
+	start := closings[n].AddDate(0, 0, 1)
+
+	var opening float64
+	err := db.NewSelect().
+		ColumnExpr("COALESCE(SUM(CASE WHEN type = 'debit' THEN cost ELSE -cost END), 0)").
+		TableExpr("item").
+		Where("card_id = ?", card.ID).
+		Where("NOT scheduled").
+		Where("created_at < ?", start).
+		Scan(ctx, &opening)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var days []struct {
+		Day     time.Time `bun:"day"`
+		Debits  float64   `bun:"debits"`
+		Credits float64   `bun:"credits"`
+	}
+	err = db.NewSelect().
+		ColumnExpr("created_at::date AS day").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'debit'), 0) AS debits").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'credit'), 0) AS credits").
+		TableExpr("item").
+		Where("card_id = ?", card.ID).
+		Where("NOT scheduled").
+		Where("created_at >= ?", start).
+		GroupExpr("1").
+		Scan(ctx, &days)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// sum totals the charges and credits on days in [from, to].
+	sum := func(from, to time.Time) (debits, credits float64) {
+		for _, d := range days {
+			if !d.Day.Before(from) && !d.Day.After(to) {
+				debits += d.Debits
+				credits += d.Credits
+			}
+		}
+		return debits, credits
+	}
+
+	statements := make([]CardStatement, n)
+	balance := opening
+	for i := n - 1; i >= 0; i-- {
+		from, closing := closings[i+1].AddDate(0, 0, 1), closings[i]
+		due := card.dueOn(closing)
+		charges, credits := sum(from, closing)
+		_, paid := sum(closing.AddDate(0, 0, 1), due)
+
+		s := CardStatement{
+			From:      Date{from},
+			ClosingOn: Date{closing},
+			DueOn:     Date{due},
+			Opening:   roundMoney(balance),
+			Charges:   roundMoney(charges),
+			Credits:   roundMoney(credits),
+		}
+		balance += charges - credits
+		s.Balance = roundMoney(balance)
+		s.Paid = roundMoney(paid)
+		s.Unpaid = roundMoney(max(s.Balance-s.Paid, 0))
+		s.Overdue = s.Unpaid > 0 && due.Before(today)
+		statements[i] = s
+	}
+
+	debits, credits := sum(start, today)
+	return statements, roundMoney(opening + debits - credits), nil
+}
+
+// describe fills in the card's outstanding balance, available credit and
+// last statement as of today.
+func (card *CreditCard) describe(ctx context.Context, db bun.IDB, today time.Time) error {
+	statements, outstanding, err := card.statements(ctx, db, today, 1)
+	if err != nil {
+		return err
+	}
+	card.Outstanding = outstanding
+	if card.CreditLimit > 0 {
+		card.Available = roundMoney(card.CreditLimit - outstanding)
+	}
+	card.LastStatement = &statements[0]
+
+	card.SpentThisMonth, err = card.monthSpent(ctx, db, today)
+	if err != nil {
+		return err
+	}
+	if card.SpendingLimit > 0 {
+		card.Utilization = math.Round(card.SpentThisMonth/card.SpendingLimit*1000) / 10
+	}
+	return nil
+}
+
+// monthSpent is what has been charged to the card from the start of
+// today's month up to today.
+func (card *CreditCard) monthSpent(ctx context.Context, db bun.IDB, today time.Time) (float64, error) {
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var spent float64
+	err := db.NewSelect().
+		ColumnExpr("COALESCE(SUM(cost), 0)").
+		TableExpr("item").
+		Where("card_id = ?", card.ID).
+		Where("type = 'debit'").
+		Where("NOT scheduled").
+		Where("created_at >= ?", month).
+		Where("created_at < ?", today.AddDate(0, 0, 1)).
+		Scan(ctx, &spent)
+	return roundMoney(spent), err
+}
+
+func (trackerDb *trackerDb) addCreditCard(c echo.Context) error {
+	ctx := context.Background()
+
+	card := new(CreditCard)
+	err := c.Bind(card)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if msg := card.validate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	card.ID = uuid.Nil
+
+	_, err = trackerDb.db.NewInsert().Model(card).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	err = card.describe(ctx, trackerDb.db, today())
+	if err != nil {
+		log.Printf("Error while getting card statement: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, "", card)
+}
+
+func (trackerDb *trackerDb) getAllCreditCards(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	cards := []CreditCard{}
+	err := trackerDb.db.NewSelect().Model(&cards).Where("user_id = ?", userID).Order("name").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting credit cards: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	t := today()
+	for i := range cards {
+		err = cards[i].describe(ctx, trackerDb.db, t)
+		if err != nil {
+			log.Printf("Error while getting card statement: %+v", err)
+			return respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+	}
+
+	return respondOK(c, cards)
+}
+
+func (trackerDb *trackerDb) deleteCreditCard(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("credit_card").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Credit card not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CardLimitRequest is the body of PUT /credit-cards/:id/limit. A zero
+// SpendingLimit removes the limit.
+type CardLimitRequest struct {
+	SpendingLimit float64 `json:"spending_limit"`
+	AlertPercent  int     `json:"alert_percent"`
+}
+
+// putCardLimit sets the card's monthly spending limit and the percentage
+// of it that triggers an alert. A new limit can alert again this month.
+func (trackerDb *trackerDb) putCardLimit(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(CardLimitRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	card := &CreditCard{SpendingLimit: req.SpendingLimit, AlertPercent: req.AlertPercent}
+	if msg := card.validateLimit(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	if card.AlertPercent == 0 {
+		card.AlertPercent = 80
+	}
+
+	res, err := trackerDb.db.NewUpdate().
+		Model(card).
+		Column("spending_limit", "alert_percent", "limit_alerted_on").
+		Where("id = ?", c.Param("id")).
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Error while updating credit card: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Credit card not found")
+	}
+	err = card.describe(ctx, trackerDb.db, today())
+	if err != nil {
+		log.Printf("Error while getting card statement: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, card)
+}
+
+// getCardStatements returns the card's last ?count= statements (6 by
+// default), newest first.
+func (trackerDb *trackerDb) getCardStatements(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	count := 6
+	if s := c.QueryParam("count"); s != "" {
+		var err error
+		count, err = strconv.Atoi(s)
+		if err != nil || count < 1 || count > 36 {
+			return respondError(c, http.StatusBadRequest, "count must be between 1 and 36")
+		}
+	}
+
+	card := new(CreditCard)
+	err := trackerDb.db.NewSelect().Model(card).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Credit card not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch credit card: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	statements, _, err := card.statements(ctx, trackerDb.db, today(), count)
+	if err != nil {
+		log.Printf("Error while getting card statements: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, statements)
+}
+
+// PayStatementRequest is the body of POST /credit-cards/:id/pay. Amount
+// defaults to what is unpaid on the last statement.
+type PayStatementRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+// PayStatementResult is the two halves of a statement payment and the
+// statement as it stands after it.
+type PayStatementResult struct {
+	Payment   *Item         `json:"payment"`
+	Transfer  *Item         `json:"transfer"`
+	Statement CardStatement `json:"statement"`
+}
+
+var errNothingToPay = errors.New("nothing is unpaid on the last statement; send an amount to pay anyway")
+
+// payCardStatement records paying off a card from the user's bank account.
+// Charges were already spending when they were made, so the payment is a
+// transfer: a credit on the card and a matching debit, both excluded from
+// analytics, that leave the balance where it was.
+func (trackerDb *trackerDb) payCardStatement(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	req := new(PayStatementRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if req.Amount < 0 {
+		return respondError(c, http.StatusBadRequest, "amount must be positive")
+	}
+
+	var result PayStatementResult
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		card := new(CreditCard)
+		err := tx.NewSelect().Model(card).Where("id = ?", id).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		t := today()
+		statements, _, err := card.statements(ctx, tx, t, 1)
+		if err != nil {
+			return err
+		}
+		amount := roundMoney(req.Amount)
+		if amount == 0 {
+			amount = statements[0].Unpaid
+		}
+		if amount == 0 {
+			return errNothingToPay
+		}
+
+		name := fmt.Sprintf("%s statement payment", card.Name)
+		profile := currentProfile(c)
+		result.Payment = &Item{Name: name, Cost: amount, Type: "credit", UserID: card.UserID, ProfileID: profile, CardID: card.ID, Excluded: true}
+		result.Transfer = &Item{Name: name, Cost: amount, Type: "debit", UserID: card.UserID, ProfileID: profile, Excluded: true}
+		for _, item := range []*Item{result.Payment, result.Transfer} {
+			err = trackerDb.insertItem(ctx, tx, item, c.QueryParam("override_cap") == "true")
+			if err != nil {
+				return err
+			}
+		}
+
+		statements, _, err = card.statements(ctx, tx, t, 1)
+		if err != nil {
+			return err
+		}
+		result.Statement = statements[0]
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Credit card not found")
+	}
+	if errors.Is(err, errNothingToPay) {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return respondItemError(c, err, "paying card statement")
+	}
+	trackerDb.fireHooks(result.Payment.UserID, eventItemCreated, result.Payment)
+	trackerDb.fireHooks(result.Transfer.UserID, eventItemCreated, result.Transfer)
+
+	return respondCreated(c, "", result)
+}
+
+// remindCardStatements is the daily job that tells users when a card
+// statement with something unpaid falls due in one of cardRemindDays days.
+func (trackerDb *trackerDb) remindCardStatements(ctx context.Context, day time.Time) error {
+	cards := []CreditCard{}
+	err := trackerDb.db.NewSelect().Model(&cards).Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, card := range cards {
+		statements, _, err := card.statements(ctx, trackerDb.db, day, 1)
+		if err != nil {
+			return err
+		}
+		s := statements[0]
+		days := int(s.DueOn.Sub(day).Hours() / 24)
+		if s.Unpaid == 0 || !slices.Contains(cardRemindDays, days) {
+			continue
+		}
+
+		money, err := trackerDb.moneyFormat(ctx, card.UserID)
+		if err != nil {
+			return err
+		}
+		when := "today"
+		if days > 0 {
+			when = "on " + s.DueOn.Format("2 Jan")
+		}
+		err = trackerDb.notify(ctx, card.UserID, fmt.Sprintf("%s statement: %s is due %s", card.Name, money.format(s.Unpaid), when))
+		if err != nil {
+			log.Printf("Error while reminding user %d about card %s: %+v", card.UserID, card.ID, err)
+		}
+	}
+	return nil
+}
+
+// alertCardLimits is the hourly job that tells users when this month's
+// charges to a card reach its alert percentage of the spending limit. Each
+// card alerts at most once a month.
+func (trackerDb *trackerDb) alertCardLimits(ctx context.Context, hour time.Time) error {
+	t := hour.Truncate(24 * time.Hour)
+	month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	cards := []CreditCard{}
+	err := trackerDb.db.NewSelect().
+		Model(&cards).
+		Where("spending_limit IS NOT NULL").
+		Where("limit_alerted_on IS NULL OR limit_alerted_on < ?", month).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, card := range cards {
+		spent, err := card.monthSpent(ctx, trackerDb.db, t)
+		if err != nil {
+			return err
+		}
+		if spent*100 < card.SpendingLimit*float64(card.AlertPercent) {
+			continue
+		}
+
+		money, err := trackerDb.moneyFormat(ctx, card.UserID)
+		if err != nil {
+			return err
+		}
+		err = trackerDb.notify(ctx, card.UserID, fmt.Sprintf("%s: %s of this month's %s limit spent (%.0f%%)",
+			card.Name, money.format(spent), money.format(card.SpendingLimit), spent/card.SpendingLimit*100))
+		if err != nil {
+			log.Printf("Error while alerting user %d about card %s: %+v", card.UserID, card.ID, err)
+			continue
+		}
+		_, err = trackerDb.db.NewUpdate().
+			TableExpr("credit_card").
+			Set("limit_alerted_on = ?", t).
+			Where("id = ?", card.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+//go:build integration
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestCard adds a credit card for the user through POST
+// /api/v2/credit-cards.
+func createTestCard(t *testing.T, userID int) CreditCard {
+	t.Helper()
+
+	rec := request(t, http.MethodPost, "/api/v2/credit-cards", map[string]interface{}{
+		"user_id": userID, "name": "Visa", "statement_day": 1, "due_day": 20,
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var card CreditCard
+	decodeData(t, rec, &card)
+	return card
+}
+
+func TestCardPayment(t *testing.T) {
+	userID := newTestUser(t)
+	card := createTestCard(t, userID)
+	createTestItem(t, userID, map[string]interface{}{"name": "Groceries", "cost": 500.0, "card_id": card.ID})
+
+	rec := request(t, http.MethodPost, "/api/v2/credit-cards/"+card.ID.String()+"/pay", map[string]interface{}{"amount": 200.0})
+	expectStatus(t, rec, http.StatusCreated)
+	var result PayStatementResult
+	decodeData(t, rec, &result)
+	if p := result.Payment; p == nil || p.Type != "credit" || p.Cost != 200 || p.CardID != card.ID || !p.Excluded {
+		t.Errorf("payment is %+v, want an excluded credit of 200 on the card", p)
+	}
+	if tr := result.Transfer; tr == nil || tr.Type != "debit" || tr.Cost != 200 || !tr.Excluded {
+		t.Errorf("transfer is %+v, want an excluded debit of 200", tr)
+	}
+
+	rec = request(t, http.MethodGet, "/api/v2/credit-cards/"+card.ID.String()+"/statements", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestCardErrors(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v2/credit-cards", map[string]interface{}{
+		"user_id": userID, "name": "Visa", "statement_day": 0, "due_day": 20,
+	})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// Nothing has been charged, so there is nothing to pay by default.
+	card := createTestCard(t, userID)
+	rec = request(t, http.MethodPost, "/api/v2/credit-cards/"+card.ID.String()+"/pay", map[string]interface{}{})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = request(t, http.MethodPost, "/api/v2/credit-cards/"+uuid.NewString()+"/pay", map[string]interface{}{"amount": 200.0})
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+)
+
+// trainingLimit caps how many of the user's most recent categorized items
+// the classifier learns from, so old habits fade out.
+const trainingLimit = 5000
+
+// minSuggestConfidence is how sure the classifier must be before a staged
+// item gets a category filled in automatically.
+const minSuggestConfidence = 0.6
+
+type CategorySuggestion struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	Confidence float64   `json:"confidence"`
+}
+
+// categoryModel is a multinomial naive Bayes classifier over the tokens of
+// item names.
+type categoryModel struct {
+	docs   map[uuid.UUID]int
+	tokens map[uuid.UUID]map[string]int
+	totals map[uuid.UUID]int
+	vocab  map[string]bool
+	n      int
+}
+
+func nameTokens(name string) []string {
+	return strings.Fields(strings.ToLower(merchantKey(name)))
+}
+
+// trainCategoryModel builds a classifier from the user's categorized items.
+// It is rebuilt on every call, so confirmations and corrections count
+// straight away.
+func (trackerDb *trackerDb) trainCategoryModel(ctx context.Context, userID int) (*categoryModel, error) {
+	var rows []struct {
+		Name       string
+		CategoryID uuid.UUID
+	}
+	err := trackerDb.db.NewSelect().
+		Column("name", "category_id").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Where("category_id IS NOT NULL").
+		Where("NOT adjustment").
+		OrderExpr("created_at DESC").
+		Limit(trainingLimit).
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &categoryModel{
+		docs:   map[uuid.UUID]int{},
+		tokens: map[uuid.UUID]map[string]int{},
+		totals: map[uuid.UUID]int{},
+		vocab:  map[string]bool{},
+	}
+	for _, r := range rows {
+		m.n++
+		m.docs[r.CategoryID]++
+		if m.tokens[r.CategoryID] == nil {
+			m.tokens[r.CategoryID] = map[string]int{}
+		}
+		for _, t := range nameTokens(r.Name) {
+			m.tokens[r.CategoryID][t]++
+			m.totals[r.CategoryID]++
+			m.vocab[t] = true
+		}
+	}
+	return m, nil
+}
+
+// suggest ranks categories for name, most likely first, with Laplace
+// smoothing. Confidences are normalized posteriors.
+func (m *categoryModel) suggest(name string) []CategorySuggestion {
+	if m.n == 0 {
+		return nil
+	}
+	tokens := nameTokens(name)
+	v := float64(len(m.vocab))
+
+	logp := map[uuid.UUID]float64{}
+	best := math.Inf(-1)
+	for cat, docs := range m.docs {
+		p := math.Log(float64(docs) / float64(m.n))
+		for _, t := range tokens {
+			p += math.Log((float64(m.tokens[cat][t]) + 1) / (float64(m.totals[cat]) + v))
+		}
+		logp[cat] = p
+		best = math.Max(best, p)
+	}
+
+	var sum float64
+	for _, p := range logp {
+		sum += math.Exp(p - best)
+	}
+	suggestions := make([]CategorySuggestion, 0, len(logp))
+	for cat, p := range logp {
+		suggestions = append(suggestions, CategorySuggestion{
+			CategoryID: cat,
+			Confidence: math.Round(math.Exp(p-best)/sum*1000) / 1000,
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].Confidence > suggestions[j].Confidence
+	})
+	return suggestions
+}
+
+// suggestCategory returns the best category for a new item, or uuid.Nil if
+// the classifier is not confident enough.
+func (trackerDb *trackerDb) suggestCategory(ctx context.Context, userID int, name string) (uuid.UUID, error) {
+	m, err := trackerDb.trainCategoryModel(ctx, userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	s := m.suggest(name)
+	if len(s) == 0 || s[0].Confidence < minSuggestConfidence {
+		return uuid.Nil, nil
+	}
+	return s[0].CategoryID, nil
+}
+
+func (trackerDb *trackerDb) getCategorySuggestions(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	var item GetItem
+	err := trackerDb.db.NewSelect().TableExpr("item").Where("id = ?", id).Scan(ctx, &item)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Item not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch item: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	m, err := trackerDb.trainCategoryModel(ctx, item.UserID)
+	if err != nil {
+		log.Printf("Error while training category model: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	suggestions := m.suggest(item.Name)
+	if len(suggestions) > 5 {
+		suggestions = suggestions[:5]
+	}
+
+	return respondOK(c, suggestions)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// Charts are drawn with the standard library alone: a PNG for channels
+// that can only show images, and the same picture as SVG for those that
+// scale it.
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	// chartMaxMonths keeps bars at least a few pixels wide.
+	chartMaxMonths = 60
+)
+
+// plotArea is where the bars go, leaving room for the axis labels and the
+// legend.
+var plotArea = image.Rect(70, 40, chartWidth-20, chartHeight-40)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	chartText       = color.RGBA{0x44, 0x44, 0x44, 0xff}
+	chartExpenses   = color.RGBA{0xd9, 0x53, 0x4f, 0xff}
+	chartIncome     = passColor
+)
+
+// chartMonth is one month of the chart.
+type chartMonth struct {
+	Month    time.Time `bun:"month"`
+	Expenses float64   `bun:"expenses"`
+	Income   float64   `bun:"income"`
+}
+
+type chartRect struct {
+	rect  image.Rectangle
+	color color.RGBA
+}
+
+// chartLabel is text drawn with its top left corner at at, or centred on
+// at.X when centred is set.
+type chartLabel struct {
+	at      image.Point
+	text    string
+	centred bool
+}
+
+// monthlyChart is a bar chart of expenses and income per month, laid out
+// once so the PNG and SVG show exactly the same thing.
+type monthlyChart struct {
+	rects  []chartRect
+	labels []chartLabel
+}
+
+// layoutMonthlyChart places the gridlines, bars and labels for months.
+func layoutMonthlyChart(months []chartMonth) monthlyChart {
+	var ch monthlyChart
+	ch.rects = append(ch.rects, chartRect{image.Rect(0, 0, chartWidth, chartHeight), chartBackground})
+
+	top := 0.0
+	for _, m := range months {
+		top = max(top, m.Expenses, m.Income)
+	}
+	step := niceStep(top / 4)
+	ticks := int(math.Ceil(top / step))
+	if ticks == 0 {
+		ticks = 1
+	}
+	top = step * float64(ticks)
+
+	y := func(amount float64) int {
+		return plotArea.Max.Y - int(math.Round(amount/top*float64(plotArea.Dy())))
+	}
+	for i := 0; i <= ticks; i++ {
+		amount := step * float64(i)
+		ch.rects = append(ch.rects, chartRect{image.Rect(plotArea.Min.X, y(amount), plotArea.Max.X, y(amount)+1), chartGrid})
+		label := compactAmount(amount)
+		ch.labels = append(ch.labels, chartLabel{at: image.Pt(plotArea.Min.X-8-textWidth(label), y(amount)-glyphHeight/2), text: label})
+	}
+
+	slot := float64(plotArea.Dx()) / float64(max(len(months), 1))
+	bar := max(int(slot*0.35), 1)
+	for i, m := range months {
+		mid := plotArea.Min.X + int(slot*(float64(i)+0.5))
+		ch.rects = append(ch.rects,
+			chartRect{image.Rect(mid-bar, y(m.Expenses), mid, plotArea.Max.Y), chartExpenses},
+			chartRect{image.Rect(mid, y(m.Income), mid+bar, plotArea.Max.Y), chartIncome},
+		)
+		// Label every month while they fit, and fewer once they don't.
+		if every := int(math.Ceil(float64(textWidth("MMM 00")+8) / slot)); i%every == 0 {
+			ch.labels = append(ch.labels, chartLabel{at: image.Pt(mid, plotArea.Max.Y+10), text: strings.ToUpper(m.Month.Format("Jan 06")), centred: true})
+		}
+	}
+
+	x := plotArea.Min.X
+	for _, key := range []struct {
+		name  string
+		color color.RGBA
+	}{{"EXPENSES", chartExpenses}, {"INCOME", chartIncome}} {
+		ch.rects = append(ch.rects, chartRect{image.Rect(x, 14, x+glyphHeight, 14+glyphHeight), key.color})
+		ch.labels = append(ch.labels, chartLabel{at: image.Pt(x+glyphHeight+6, 14), text: key.name})
+		x += glyphHeight + 6 + textWidth(key.name) + 24
+	}
+	return ch
+}
+
+// niceStep rounds a gridline spacing up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	pow := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*pow {
+			return m * pow
+		}
+	}
+	return 10 * pow
+}
+
+// compactAmount writes an axis amount briefly, e.g. 800, 12K or 1.5M.
+func compactAmount(amount float64) string {
+	for _, u := range []struct {
+		size   float64
+		suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "K"}} {
+		if amount >= u.size {
+			return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", amount/u.size), "0"), ".") + u.suffix
+		}
+	}
+	return fmt.Sprintf("%.0f", amount)
+}
+
+// png draws the chart. There is no font to hand, so labels use the small
+// bitmap font below, doubled in size.
+func (ch monthlyChart) png() ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	for _, r := range ch.rects {
+		draw.Draw(img, r.rect, &image.Uniform{r.color}, image.Point{}, draw.Src)
+	}
+	for _, l := range ch.labels {
+		at := l.at
+		if l.centred {
+			at.X -= textWidth(l.text) / 2
+		}
+		drawText(img, at, l.text)
+	}
+
+	var b bytes.Buffer
+	err := png.Encode(&b, img)
+	return b.Bytes(), err
+}
+
+func (ch monthlyChart) svg() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %[1]d %[2]d">`, chartWidth, chartHeight)
+	for _, r := range ch.rects {
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`, r.rect.Min.X, r.rect.Min.Y, r.rect.Dx(), r.rect.Dy(), hexColor(r.color))
+	}
+	for _, l := range ch.labels {
+		x, anchor := l.at.X, "start"
+		if l.centred {
+			anchor = "middle"
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="sans-serif" font-size="%d" fill="%s" text-anchor="%s">%s</text>`,
+			x, l.at.Y+glyphHeight, glyphHeight, hexColor(chartText), anchor, html.EscapeString(l.text))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// glyphScale is how many pixels square each dot of the bitmap font is.
+const glyphScale = 2
+
+// glyphHeight is the height of a line of text in pixels.
+const glyphHeight = 7 * glyphScale
+
+// glyphs is a 5x7 bitmap font with just the characters chart labels use;
+// each row's low five bits are its dots, left to right. Anything else is
+// drawn as a space.
+var glyphs = map[rune][7]uint8{
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	'A': {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'B': {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C': {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D': {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c},
+	'E': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G': {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'I': {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M': {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P': {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'R': {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S': {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T': {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'X': {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+}
+
+// textWidth is how wide text is in pixels, each glyph followed by a
+// one-dot gap.
+func textWidth(s string) int {
+	return len([]rune(s)) * 6 * glyphScale
+}
+
+func drawText(img draw.Image, at image.Point, s string) {
+	ink := &image.Uniform{chartText}
+	for i, r := range []rune(s) {
+		g := glyphs[r]
+		x0 := at.X + i*6*glyphScale
+		for row, bits := range g {
+			for col := 0; col < 5; col++ {
+				if bits&(0x10>>col) == 0 {
+					continue
+				}
+				dot := image.Rect(x0+col*glyphScale, at.Y+row*glyphScale, x0+(col+1)*glyphScale, at.Y+(row+1)*glyphScale)
+				draw.Draw(img, dot, ink, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// chartMonths returns expenses and income in each month of p, counted the
+// way the dashboard counts them, with months without items as zero.
+func (trackerDb *trackerDb) chartMonths(ctx context.Context, c echo.Context, userID string, p period) ([]chartMonth, error) {
+	rows := []chartMonth{}
+	err := trackerDb.reports.NewSelect().
+		ColumnExpr("date_trunc('month', created_at) AS month").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'debit'), 0) AS expenses").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'credit'), 0) AS income").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
+		Where("created_at >= ?", p.start).
+		Where("created_at < ?", p.end).
+		GroupExpr("1").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	byMonth := make(map[time.Time]chartMonth, len(rows))
+	for _, r := range rows {
+		byMonth[r.Month.UTC()] = r
+	}
+
+	months := []chartMonth{}
+	start := time.Date(p.start.Year(), p.start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for m := start; m.Before(p.end); m = m.AddDate(0, 1, 0) {
+		row := byMonth[m]
+		row.Month = m
+		months = append(months, row)
+	}
+	return months, nil
+}
+
+// chartPeriod reads ?period=, which defaults to the twelve months ending
+// with this one. It returns a message for the client if the period can't
+// be charted.
+func chartPeriod(c echo.Context) (period, string) {
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return p, err.Error()
+	}
+	if p.isZero() {
+		now := time.Now().UTC()
+		end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+		return period{start: end.AddDate(-1, 0, 0), end: end}, ""
+	}
+	if p.end.After(p.start.AddDate(0, chartMaxMonths, 0)) {
+		return p, fmt.Sprintf("period must cover at most %d months", chartMaxMonths)
+	}
+	return p, ""
+}
+
+// getMonthlyChart serves GET /charts/monthly.png and /charts/monthly.svg,
+// the dashboard's monthly expenses and income as an image, for places that
+// can't draw the chart themselves.
+func (trackerDb *trackerDb) getMonthlyChart(format string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := context.Background()
+		userID := c.QueryParam("user_id")
+
+		p, msg := chartPeriod(c)
+		if msg != "" {
+			return respondError(c, http.StatusBadRequest, msg)
+		}
+		months, err := trackerDb.chartMonths(ctx, c, userID, p)
+		if err != nil {
+			log.Printf("Error while getting chart data: %+v", err)
+			return respondQueryError(c, err)
+		}
+
+		chart := layoutMonthlyChart(months)
+		c.Response().Header().Set("Cache-Control", "private, max-age=300")
+		if format == "svg" {
+			return c.Blob(http.StatusOK, "image/svg+xml", chart.svg())
+		}
+		b, err := chart.png()
+		if err != nil {
+			log.Printf("Error while drawing chart: %+v", err)
+			return respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return c.Blob(http.StatusOK, "image/png", b)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// Claim groups reimbursable items submitted to an employer. Paying a claim
+// books the reimbursement as a credit item.
+type Claim struct {
+	bun.BaseModel `bun:"table:claim,alias:cl"`
+
+	ID                  uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID              int       `bun:"user_id" json:"user_id"`
+	Name                string    `json:"name"`
+	Status              string    `bun:",nullzero" json:"status"`
+	ReimbursementItemID uuid.UUID `bun:"type:uuid,nullzero" json:"reimbursement_item_id"`
+	CreatedAt           time.Time `bun:",nullzero,default:now()" json:"created_at"`
+	Total               float64   `bun:",scanonly" json:"total"`
+	Items               []GetItem `bun:"-" json:"items,omitempty"`
+}
+
+type AddClaimRequest struct {
+	UserID  int         `json:"user_id"`
+	Name    string      `json:"name"`
+	ItemIDs []uuid.UUID `json:"item_ids"`
+}
+
+var errClaimItems = errors.New("all items must be reimbursable, unclaimed and belong to the user")
+
+func (trackerDb *trackerDb) addClaim(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(AddClaimRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if len(req.ItemIDs) == 0 {
+		return respondError(c, http.StatusBadRequest, "item_ids is required")
+	}
+
+	claim := &Claim{UserID: req.UserID, Name: req.Name}
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewInsert().Model(claim).Returning("*").Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.NewUpdate().
+			TableExpr("item").
+			Set("claim_id = ?", claim.ID).
+			Where("id IN (?)", bun.In(req.ItemIDs)).
+			Where("user_id = ?", req.UserID).
+			Where("reimbursable").
+			Where("claim_id IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if int(n) != len(req.ItemIDs) {
+			return errClaimItems
+		}
+		return nil
+	})
+	if errors.Is(err, errClaimItems) {
+		return respondError(c, http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error while adding claim: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, apiPath(c, "/claims/"+claim.ID.String()), claim)
+}
+
+func selectClaims(db bun.IDB) *bun.SelectQuery {
+	return db.NewSelect().
+		ColumnExpr("cl.*").
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE i.type = 'debit'), 0) AS total").
+		TableExpr("claim AS cl").
+		Join("LEFT JOIN item i ON i.claim_id = cl.id").
+		Group("cl.id")
+}
+
+func (trackerDb *trackerDb) getAllClaims(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	claims := []Claim{}
+	err := selectClaims(trackerDb.db).
+		Where("cl.user_id = ?", userID).
+		Order("cl.created_at DESC").
+		Scan(ctx, &claims)
+	if err != nil {
+		log.Printf("Error while getting claims: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, claims)
+}
+
+// getClaim returns a claim together with its items, which is the report
+// handed to the employer.
+func (trackerDb *trackerDb) getClaim(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	var claim Claim
+	err := selectClaims(trackerDb.db).Where("cl.id = ?", id).Scan(ctx, &claim)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Claim not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch claim: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	err = trackerDb.db.NewSelect().
+		TableExpr("item").
+		Where("claim_id = ?", id).
+		Where("type = 'debit'").
+		OrderExpr("created_at").
+		Scan(ctx, &claim.Items)
+	if err != nil {
+		log.Printf("Could not fetch claim items: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, claim)
+}
+
+// payClaim marks a submitted claim as paid and books the reimbursement as a
+// credit item. The claimed items and the credit are flagged reimbursed so
+// they cancel out of expense analytics.
+func (trackerDb *trackerDb) payClaim(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	var claim Claim
+	var credit *Item
+	err := trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(&claim).
+			Where("id = ?", id).
+			Where("status = 'submitted'").
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = tx.NewSelect().
+			ColumnExpr("COALESCE(SUM(cost), 0)").
+			TableExpr("item").
+			Where("claim_id = ?", claim.ID).
+			Where("type = 'debit'").
+			Scan(ctx, &claim.Total)
+		if err != nil {
+			return err
+		}
+		claim.Total = roundMoney(claim.Total)
+
+		credit = &Item{
+			Name:       "Reimbursement: " + claim.Name,
+			Cost:       claim.Total,
+			Type:       "credit",
+			UserID:     claim.UserID,
+			ProfileID:  currentProfile(c),
+			Status:     "cleared",
+			ClaimID:    claim.ID,
+			Reimbursed: true,
+		}
+		err = trackerDb.insertItem(ctx, tx, credit, c.QueryParam("override_cap") == "true")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			TableExpr("item").
+			Set("reimbursed = true").
+			Where("claim_id = ?", claim.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		claim.Status = "paid"
+		claim.ReimbursementItemID = credit.ID
+		_, err = tx.NewUpdate().
+			Model(&claim).
+			Column("status", "reimbursement_item_id").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "No submitted claim with that id")
+	}
+	if err != nil {
+		return respondItemError(c, err, "paying claim")
+	}
+	trackerDb.fireHooks(credit.UserID, eventItemCreated, credit)
+
+	return respondOK(c, claim)
+}
@@ -0,0 +1,67 @@
+//go:build integration
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestClaimPay(t *testing.T) {
+	userID := newTestUser(t)
+	taxi := createTestItem(t, userID, map[string]interface{}{"name": "Taxi", "cost": 300.0, "reimbursable": true})
+	hotel := createTestItem(t, userID, map[string]interface{}{"name": "Hotel", "cost": 4200.0, "reimbursable": true})
+
+	rec := request(t, http.MethodPost, "/api/v2/claims", map[string]interface{}{
+		"user_id": userID, "name": "Conference", "item_ids": []uuid.UUID{taxi.ID, hotel.ID},
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	loc := rec.Header().Get("Location")
+
+	rec = request(t, http.MethodGet, loc, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var claim Claim
+	decodeData(t, rec, &claim)
+	if claim.Total != 4500 || len(claim.Items) != 2 {
+		t.Errorf("claim is %+v, want both items totalling 4500", claim)
+	}
+
+	rec = request(t, http.MethodPost, loc+"/pay", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var paid Claim
+	decodeData(t, rec, &paid)
+	if paid.Status != "paid" || paid.ReimbursementItemID == uuid.Nil {
+		t.Errorf("paid %+v, want it paid with a reimbursement item", paid)
+	}
+
+	var credits []ItemV2
+	for _, item := range listTestItems(t, userID) {
+		if item.Type == "credit" {
+			credits = append(credits, item)
+		}
+	}
+	if len(credits) != 1 || credits[0].ID != paid.ReimbursementItemID || credits[0].Cost != 4500 {
+		t.Errorf("paying the claim saved %+v, want one credit of 4500", credits)
+	}
+}
+
+func TestClaimErrors(t *testing.T) {
+	userID := newTestUser(t)
+	coffee := createTestItem(t, userID, nil)
+
+	rec := request(t, http.MethodPost, "/api/v2/claims", map[string]interface{}{
+		"user_id": userID, "name": "Conference",
+	})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// The coffee isn't reimbursable.
+	rec = request(t, http.MethodPost, "/api/v2/claims", map[string]interface{}{
+		"user_id": userID, "name": "Conference", "item_ids": []uuid.UUID{coffee.ID},
+	})
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = request(t, http.MethodPost, "/api/v2/claims/"+uuid.NewString()+"/pay", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// concurrencyWait is how long a request waits for one of the user's slots
+// before it is refused.
+const concurrencyWait = 10 * time.Second
+
+// concurrencyLimiter caps how many of one kind of expensive request, like
+// exports or imports, each user may have running at once, so one user's
+// five-year export can't take every database connection. Requests over the
+// cap queue for concurrencyWait and are then refused with 429. Like the rate
+// limiter, it counts per replica.
+type concurrencyLimiter struct {
+	mu    sync.Mutex
+	limit int
+	users map[string]*userSlots
+}
+
+type userSlots struct {
+	sem  chan struct{}
+	refs int
+}
+
+// newConcurrencyLimiter allows limit requests per user at once, or
+// fallback if limit is 0. A negative limit means no limit.
+func newConcurrencyLimiter(limit, fallback int) *concurrencyLimiter {
+	if limit == 0 {
+		limit = fallback
+	}
+	return &concurrencyLimiter{limit: limit, users: map[string]*userSlots{}}
+}
+
+// acquire takes one of user's slots, waiting up to wait for one to free up.
+// If it gets one, the caller must call release once the work is done,
+// which may be after the request has ended.
+func (l *concurrencyLimiter) acquire(user string, wait time.Duration) (release func(), ok bool) {
+	if l.limit < 0 {
+		return func() {}, true
+	}
+
+	l.mu.Lock()
+	s := l.users[user]
+	if s == nil {
+		s = &userSlots{sem: make(chan struct{}, l.limit)}
+		l.users[user] = s
+	}
+	s.refs++
+	l.mu.Unlock()
+
+	release = func() {
+		<-s.sem
+		l.done(user, s)
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return sync.OnceFunc(release), true
+	default:
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case s.sem <- struct{}{}:
+		return sync.OnceFunc(release), true
+	case <-timer.C:
+		l.done(user, s)
+		return nil, false
+	}
+}
+
+// done forgets user once nothing holds or waits for their slots, so the
+// map doesn't grow with every user ever seen.
+func (l *concurrencyLimiter) done(user string, s *userSlots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s.refs--
+	if s.refs == 0 {
+		delete(l.users, user)
+	}
+}
+
+// concurrencyUser is who a request counts against: its user_id, or its IP
+// address if it names no user.
+func concurrencyUser(c echo.Context) string {
+	if id := c.FormValue("user_id"); id != "" {
+		return id
+	}
+	return "ip:" + c.RealIP()
+}
+
+// respondBusy refuses a request because the user already has too many of
+// its kind running.
+func respondBusy(c echo.Context, msg string) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(concurrencyWait.Seconds())*3))
+	return respondError(c, http.StatusTooManyRequests, msg)
+}
+
+// wantsCSV reports whether the request asks for a CSV export instead of
+// JSON, with Accept: text/csv or, on a read, ?format=csv. Elsewhere format
+// names what is sent, like the statement format of an import.
+func wantsCSV(c echo.Context) bool {
+	if c.Request().Method == http.MethodGet && c.QueryParam("format") == "csv" {
+		return true
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/csv")
+}
+
+// limitExports holds CSV exports to the user's export slots. Other
+// requests pass straight through.
+func (trackerDb *trackerDb) limitExports(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !wantsCSV(c) {
+			return next(c)
+		}
+		release, ok := trackerDb.exports.acquire(concurrencyUser(c), concurrencyWait)
+		if !ok {
+			return respondBusy(c, "Too many exports running for this user; try again when one finishes")
+		}
+		defer release()
+		return next(c)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// writeCSV serializes a struct, a slice of structs or a slice of maps as CSV.
+// Columns are named after the json tags so both formats share field names.
+func writeCSV(c echo.Context, code int, data interface{}) error {
+	header, records, err := csvRecords(data)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().WriteHeader(code)
+
+	w := csv.NewWriter(c.Response())
+	w.Write(header)
+	w.WriteAll(records)
+	return w.Error()
+}
+
+func csvRecords(data interface{}) ([]string, [][]string, error) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+
+	var rows []reflect.Value
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, reflect.Indirect(v.Index(i)))
+		}
+	} else {
+		rows = append(rows, v)
+	}
+
+	elem := v.Type()
+	if v.Kind() == reflect.Slice {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	switch elem.Kind() {
+	case reflect.Struct:
+		var header []string
+		var fields []int
+		for i := 0; i < elem.NumField(); i++ {
+			f := elem.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			header = append(header, name)
+			fields = append(fields, i)
+		}
+
+		records := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			record := make([]string, len(fields))
+			for j, i := range fields {
+				record[j] = csvValue(row.Field(i).Interface())
+			}
+			records = append(records, record)
+		}
+		return header, records, nil
+	case reflect.Map:
+		keys := map[string]bool{}
+		for _, row := range rows {
+			for _, k := range row.MapKeys() {
+				keys[k.String()] = true
+			}
+		}
+		header := make([]string, 0, len(keys))
+		for k := range keys {
+			header = append(header, k)
+		}
+		sort.Strings(header)
+
+		records := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			record := make([]string, len(header))
+			for j, k := range header {
+				if val := row.MapIndex(reflect.ValueOf(k)); val.IsValid() {
+					record[j] = csvValue(val.Interface())
+				}
+			}
+			records = append(records, record)
+		}
+		return header, records, nil
+	}
+
+	return nil, nil, fmt.Errorf("cannot write %T as csv", data)
+}
+
+// csvValue formats v the same way it would appear in JSON, minus the quotes.
+func csvValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return ""
+	}
+
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		return s
+	}
+	return string(b)
+}
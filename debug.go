@@ -0,0 +1,78 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// adminOnly refuses requests that don't carry the admin token. Unlike the
+// policy, which an operator may loosen, it can't be configured away.
+func (trackerDb *trackerDb) adminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if trackerDb.requestRole(c) != roleAdmin {
+			return respondError(c, http.StatusForbidden, "You are not allowed to do that")
+		}
+		return next(c)
+	}
+}
+
+// debugRoutes mounts the Go profiler at /debug/pprof for admins. For
+// example, to look at where the CPU goes while a slow listing runs:
+//
+//	curl -H "X-Admin-Token: $ADMIN_TOKEN" -o cpu.out \
+//		'localhost:1323/debug/pprof/profile?seconds=30'
+//	go tool pprof cpu.out
+//
+// /debug/pprof/heap, /goroutine, /allocs and the other named profiles
+// work the same way. /debug/vars serves expvar's memory statistics along
+// with the database connection pool's, and /debug/dump has heap and
+// goroutine dumps to download and keep.
+func (trackerDb *trackerDb) debugRoutes(e *echo.Echo) {
+	expvar.Publish("db", expvar.Func(func() any { return trackerDb.db.Stats() }))
+	e.GET("/debug/vars", echo.WrapHandler(expvar.Handler()), trackerDb.adminOnly)
+
+	d := e.Group("/debug/dump", trackerDb.adminOnly)
+	d.GET("/heap", dumpHeap)
+	d.GET("/goroutine", dumpGoroutines)
+
+	g := e.Group("/debug/pprof", trackerDb.adminOnly)
+	g.GET("/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	g.GET("/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	g.GET("/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.POST("/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.GET("/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	g.GET("/*", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+}
+
+// dumpHeap downloads a heap profile for go tool pprof, taken after a
+// garbage collection so it shows memory that is still live rather than
+// garbage waiting to be collected.
+func dumpHeap(c echo.Context) error {
+	runtime.GC()
+	attachment(c, "heap.pb.gz", echo.MIMEOctetStream)
+	return rpprof.Lookup("heap").WriteTo(c.Response(), 0)
+}
+
+// dumpGoroutines downloads every goroutine's stack in the same format as
+// an unrecovered panic, which shows what is stuck and where.
+func dumpGoroutines(c echo.Context) error {
+	attachment(c, "goroutine.txt", echo.MIMETextPlainCharsetUTF8)
+	return rpprof.Lookup("goroutine").WriteTo(c.Response(), 2)
+}
+
+// attachment makes the response a download named after name, with the
+// time inserted before the extension so successive dumps don't collide.
+func attachment(c echo.Context, name, contentType string) {
+	base, ext, _ := strings.Cut(name, ".")
+	h := c.Response().Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, base, time.Now().UTC().Format("20060102T150405Z"), ext))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+var (
+	emailAmountRe    = regexp.MustCompile(`(?i)(?:₹|rs\.?|inr|usd|\$|€|£)\s*([\d,]+(?:\.\d{1,2})?)`)
+	emailAmountWords = []string{"total", "amount", "paid", "charged", "debited"}
+	emailUserRe      = regexp.MustCompile(`\+(\d+)@`)
+)
+
+// parseEmailReceipt takes the merchant from the sender's display name (or
+// domain) and the amount from the last line with a currency figure that
+// mentions a total or payment, falling back to the first figure at all.
+func parseEmailReceipt(from, subject, body string) (string, float64) {
+	merchant := from
+	if addr, err := mail.ParseAddress(from); err == nil {
+		merchant = addr.Name
+		if merchant == "" {
+			domain := addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+			merchant = strings.Split(domain, ".")[0]
+		}
+	}
+
+	var amount, fallback float64
+	for _, line := range strings.Split(subject+"\n"+body, "\n") {
+		m := emailAmountRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		if containsAny(strings.ToLower(line), emailAmountWords) {
+			amount = v
+			continue
+		}
+		if fallback == 0 {
+			fallback = v
+		}
+	}
+	if amount == 0 {
+		amount = fallback
+	}
+
+	return merchant, amount
+}
+
+// ingestEmail is the inbound webhook for forwarded e-receipts. It accepts
+// the form posts sent by Mailgun (recipient, sender, subject, body-plain)
+// and SendGrid (to, from, subject, text). The user is taken from the plus
+// part of the address, e.g. receipts+42@example.com.
+func (trackerDb *trackerDb) ingestEmail(c echo.Context) error {
+	ctx := context.Background()
+
+	token := trackerDb.env.InboundEmailToken
+	if token == "" || subtle.ConstantTimeCompare([]byte(c.QueryParam("token")), []byte(token)) != 1 {
+		return respondError(c, http.StatusUnauthorized, "Invalid token")
+	}
+
+	recipient := firstFormValue(c, "recipient", "to")
+	m := emailUserRe.FindStringSubmatch(recipient)
+	if m == nil {
+		return respondError(c, http.StatusBadRequest, "Recipient has no user id")
+	}
+	userID, _ := strconv.Atoi(m[1])
+
+	from := firstFormValue(c, "sender", "from")
+	subject := c.FormValue("subject")
+	merchant, amount := parseEmailReceipt(from, subject, firstFormValue(c, "body-plain", "text"))
+
+	staged := &StagedItem{
+		UserID:     userID,
+		Source:     "email",
+		Name:       merchant,
+		Cost:       amount,
+		Type:       "debit",
+		OccurredOn: Date{time.Now().UTC()},
+		Details: map[string]interface{}{
+			"from":    from,
+			"subject": subject,
+		},
+	}
+	err := trackerDb.stage(ctx, staged)
+	if err != nil {
+		log.Printf("Error while staging item: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, staged)
+}
+
+func firstFormValue(c echo.Context, names ...string) string {
+	for _, name := range names {
+		if v := c.FormValue(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -12,6 +12,108 @@ type Env struct {
 	DbPass string `mapstructure:"DB_PASSWORD"`
 	DbHost string `mapstructure:"DB_HOST"`
 	DbName string `mapstructure:"DB_NAME"`
+
+	// OcrBackend is "tesseract" (the default) or "google" for the Cloud
+	// Vision API, which also needs OcrApiKey.
+	OcrBackend string `mapstructure:"OCR_BACKEND"`
+	OcrApiKey  string `mapstructure:"OCR_API_KEY"`
+
+	// InboundEmailToken must be passed as ?token= by the email provider's
+	// inbound webhook. Email ingestion is disabled when it is empty.
+	InboundEmailToken string `mapstructure:"INBOUND_EMAIL_TOKEN"`
+
+	// EnrichmentURL is an optional merchant lookup service. It is called as
+	// GET EnrichmentURL?q=<raw name> and answers {"name": ..., "category": ...}.
+	EnrichmentURL string `mapstructure:"ENRICHMENT_URL"`
+
+	// GoogleCredentialsFile is a service account key used for Google Sheets
+	// sync. Users share their sheet with the account's email. Sync is
+	// disabled when it is empty.
+	GoogleCredentialsFile string `mapstructure:"GOOGLE_CREDENTIALS_FILE"`
+
+	// PublicURL is where phones reach the server, e.g.
+	// https://tracker.example.com, for wallet passes to fetch updates from.
+	PublicURL string `mapstructure:"PUBLIC_URL"`
+
+	// PassTypeID, PassTeamID, PassCertFile and PassKeyFile are the Apple
+	// Pass Type ID certificate (PEM) and its ids that sign Apple Wallet
+	// passes; PassWWDRFile is Apple's WWDR intermediate certificate. Apple
+	// Wallet passes are disabled when PassCertFile is empty.
+	PassTypeID   string `mapstructure:"PASS_TYPE_ID"`
+	PassTeamID   string `mapstructure:"PASS_TEAM_ID"`
+	PassCertFile string `mapstructure:"PASS_CERT_FILE"`
+	PassKeyFile  string `mapstructure:"PASS_KEY_FILE"`
+	PassWWDRFile string `mapstructure:"PASS_WWDR_FILE"`
+
+	// GoogleWalletIssuerID enables Google Wallet passes, issued with the
+	// service account in GoogleCredentialsFile.
+	GoogleWalletIssuerID string `mapstructure:"GOOGLE_WALLET_ISSUER_ID"`
+
+	// CalendarSecret signs the tokens in calendar feed URLs. The feed is
+	// disabled when it is empty.
+	CalendarSecret string `mapstructure:"CALENDAR_SECRET"`
+
+	// AdminToken must be sent as X-Admin-Token to act with the admin role,
+	// which the default policy requires for admin endpoints. There is no
+	// admin when it is empty. MaintenanceMode starts the server with
+	// writes paused.
+	AdminToken      string `mapstructure:"ADMIN_TOKEN"`
+	MaintenanceMode bool   `mapstructure:"MAINTENANCE_MODE"`
+
+	// AuditorToken must be sent as X-Auditor-Token to act with the auditor
+	// role, which the default policy lets read and export everything but
+	// change nothing. There is no auditor when it is empty.
+	AuditorToken string `mapstructure:"AUDITOR_TOKEN"`
+
+	// PolicyFile is a JSON list of authorization rules that replaces the
+	// built-in policy; see PolicyRule.
+	PolicyFile string `mapstructure:"POLICY_FILE"`
+
+	// ItemQuota and HookQuota cap how many items and webhook subscriptions
+	// each user may have, so one user can't fill a shared instance. 0 means
+	// no limit.
+	ItemQuota int `mapstructure:"ITEM_QUOTA"`
+	HookQuota int `mapstructure:"HOOK_QUOTA"`
+
+	// Currency is the ledger's currency code; amounts are rounded to its
+	// minor unit, e.g. cents, or yen for JPY. RoundingMode is "half_up"
+	// (the default) or "half_even" for banker's rounding. CashRounding
+	// lists cash increments per currency, e.g. "CHF:0.05,DKK:0.50"; the
+	// entry for Currency rounds invoice totals.
+	Currency     string `mapstructure:"CURRENCY"`
+	RoundingMode string `mapstructure:"ROUNDING_MODE"`
+	CashRounding string `mapstructure:"CASH_ROUNDING"`
+
+	// RateLimit is how many requests a client may make per minute. 0 means
+	// no limit.
+	RateLimit int `mapstructure:"RATE_LIMIT"`
+
+	// ReceiptMaxMB and StatementMaxMB cap upload sizes, defaulting to 10
+	// and 5. When ClamdAddress is set (host:port or unix:/path/to/socket),
+	// uploads are scanned by ClamAV and refused if it finds anything.
+	ReceiptMaxMB   int    `mapstructure:"RECEIPT_MAX_MB"`
+	StatementMaxMB int    `mapstructure:"STATEMENT_MAX_MB"`
+	ClamdAddress   string `mapstructure:"CLAMD_ADDRESS"`
+
+	// ExportConcurrency and ImportConcurrency are how many CSV exports and
+	// how many imports (statements, import sources and receipt OCR) one
+	// user may run at once, defaulting to 2 and 1. -1 means no limit.
+	ExportConcurrency int `mapstructure:"EXPORT_CONCURRENCY"`
+	ImportConcurrency int `mapstructure:"IMPORT_CONCURRENCY"`
+
+	// BillRemindDays is how many days before a bill's due date users are
+	// reminded of it, defaulting to 3. They are reminded again on the day
+	// and once the day after if it is still unpaid.
+	BillRemindDays int `mapstructure:"BILL_REMIND_DAYS"`
+
+	// AnalyticsTimeout is how many seconds an analytics or report query may
+	// run before it is cancelled and the request fails with 504. It
+	// defaults to 30.
+	AnalyticsTimeout int `mapstructure:"ANALYTICS_TIMEOUT"`
+
+	// LogBodies logs request and response bodies, redacted and truncated,
+	// for debugging.
+	LogBodies bool `mapstructure:"LOG_BODIES"`
 }
 
 func NewEnv() *Env {
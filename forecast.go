@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+// maxForecastDays is how far ahead GET /forecast may look.
+const maxForecastDays = 366
+
+type ForecastDay struct {
+	Date    Date    `bun:"day" json:"date"`
+	Change  float64 `bun:"change" json:"change"`
+	Balance float64 `bun:"-" json:"balance"`
+}
+
+type Forecast struct {
+	Balance float64       `json:"balance"`
+	Days    []ForecastDay `json:"days"`
+}
+
+// getForecast projects the user's balance over the next ?days= (30 by
+// default) from their current balance and the items scheduled in that
+// time. Only days with scheduled items are listed.
+func (trackerDb *trackerDb) getForecast(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	days := 30
+	if d := c.QueryParam("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 || days > maxForecastDays {
+			return respondError(c, http.StatusBadRequest, "days must be between 1 and 366")
+		}
+	}
+
+	forecast := Forecast{Days: []ForecastDay{}}
+	err := trackerDb.reports.NewSelect().
+		ColumnExpr("COALESCE(SUM(CASE WHEN type = 'credit' THEN cost ELSE -cost END), 0)").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Where("NOT scheduled").
+		Apply(inProfile(currentProfile(c))).
+		Scan(ctx, &forecast.Balance)
+	if err != nil {
+		log.Printf("Error while getting balance: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	err = trackerDb.reports.NewSelect().
+		ColumnExpr("created_at::date AS day").
+		ColumnExpr("SUM(CASE WHEN type = 'credit' THEN cost ELSE -cost END) AS change").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Where("scheduled").
+		Where("created_at < ?", today().AddDate(0, 0, days+1)).
+		Apply(inProfile(currentProfile(c))).
+		GroupExpr("day").
+		OrderExpr("day").
+		Scan(ctx, &forecast.Days)
+	if err != nil {
+		log.Printf("Error while getting scheduled items: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	balance := forecast.Balance
+	for i := range forecast.Days {
+		balance += forecast.Days[i].Change
+		forecast.Days[i].Change = roundMoney(forecast.Days[i].Change)
+		forecast.Days[i].Balance = roundMoney(balance)
+	}
+	forecast.Balance = roundMoney(forecast.Balance)
+
+	return respondOK(c, forecast)
+}
@@ -0,0 +1,232 @@
+//go:build integration
+
+package main
+
+// The integration tests run the real server, migrations and all, against
+// Postgres. They are behind the integration build tag:
+//
+//	go test -tags integration ./...
+//
+// By default they start Postgres in a throwaway Docker container. Set
+// TEST_DATABASE_URL to use a database you already have instead; the tests
+// only add rows under fresh user ids, so it needn't be empty.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var (
+	testTracker *trackerDb
+	testServer  *echo.Echo
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() {
+		log.Println("Skipping integration tests in short mode")
+		os.Exit(0)
+	}
+	ctx := context.Background()
+
+	dsn, stop, err := startTestDatabase(ctx)
+	if err != nil {
+		log.Fatal("Can't start Postgres: ", err)
+	}
+	env, err := testEnv(dsn)
+	if err != nil {
+		stop()
+		log.Fatal(err)
+	}
+
+	db := connect(env)
+	migrateDb(db)
+	testTracker, err = newTrackerDb(env, db)
+	if err != nil {
+		stop()
+		log.Fatal(err)
+	}
+	testServer = testTracker.newServer()
+
+	code := m.Run()
+	db.Close()
+	testTracker.reports.Close()
+	stop()
+	os.Exit(code)
+}
+
+// startTestDatabase returns the URL of the database to test against and a
+// function that tears it down.
+func startTestDatabase(ctx context.Context) (string, func(), error) {
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+		return dsn, func() {}, nil
+	}
+
+	container, err := postgres.Run(ctx, "postgres:16-alpine",
+		postgres.WithDatabase("tracker"),
+		postgres.WithUsername("tracker"),
+		postgres.WithPassword("tracker"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	stop := func() {
+		err := testcontainers.TerminateContainer(container)
+		if err != nil {
+			log.Printf("Can't stop Postgres: %+v", err)
+		}
+	}
+
+	dsn, err := container.ConnectionString(ctx)
+	if err != nil {
+		stop()
+		return "", nil, err
+	}
+	return dsn, stop, nil
+}
+
+// testEnv is the configuration the tests run the server with: the test
+// database and admin and auditor tokens, with everything optional off.
+func testEnv(dsn string) (*Env, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("test database URL: %w", err)
+	}
+	password, _ := u.User.Password()
+	return &Env{
+		AppEnv:       "test",
+		DbUser:       u.User.Username(),
+		DbPass:       password,
+		DbHost:       u.Host,
+		DbName:       u.Path[1:],
+		Currency:     "INR",
+		AdminToken:   "test-admin",
+		AuditorToken: "test-auditor",
+	}, nil
+}
+
+// lastUserID hands out user ids no earlier run has used, so tests can
+// share a database without seeing each other's rows.
+var lastUserID = time.Now().Unix() % 1_000_000 * 1000
+
+// newTestUser registers a user through POST /users and returns its id.
+func newTestUser(t *testing.T) int {
+	t.Helper()
+
+	id := int(atomic.AddInt64(&lastUserID, 1))
+	rec := request(t, http.MethodPost, "/api/v2/users", map[string]interface{}{"user_id": id})
+	expectStatus(t, rec, http.StatusCreated)
+	return id
+}
+
+// request sends a request through the whole server, middleware included.
+// body is sent as JSON unless it is nil. headers are name, value pairs.
+func request(t *testing.T, method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var b bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&b).Encode(body)
+		if err != nil {
+			t.Fatalf("encoding %s %s body: %v", method, path, err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &b)
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	testServer.ServeHTTP(rec, req)
+	return rec
+}
+
+// expectStatus fails the test unless the response has the given status.
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("got status %d, want %d; body: %s", rec.Code, status, rec.Body)
+	}
+}
+
+// decodeData unmarshals the data of an Envelope response into v.
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	env := Envelope{Data: v}
+	err := json.Unmarshal(rec.Body.Bytes(), &env)
+	if err != nil {
+		t.Fatalf("decoding response: %v; body: %s", err, rec.Body)
+	}
+}
+
+// createTestItem saves an item through POST /api/v2/items. fields are
+// merged over a small debit for the user.
+func createTestItem(t *testing.T, userID int, fields map[string]interface{}) ItemV2 {
+	t.Helper()
+
+	body := map[string]interface{}{
+		"name":       "Coffee",
+		"cost":       120.0,
+		"type":       "debit",
+		"user_id":    userID,
+		"created_at": time.Now().UTC().Add(-time.Hour),
+	}
+	for k, v := range fields {
+		body[k] = v
+	}
+
+	rec := request(t, http.MethodPost, "/api/v2/items", body)
+	expectStatus(t, rec, http.StatusCreated)
+	var item ItemV2
+	decodeData(t, rec, &item)
+	return item
+}
+
+// listTestItems returns the user's items through GET /api/v2/items.
+func listTestItems(t *testing.T, userID int) []ItemV2 {
+	t.Helper()
+
+	rec := request(t, http.MethodGet, fmt.Sprintf("/api/v2/items?user_id=%d&limit=100", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	items := []ItemV2{}
+	decodeData(t, rec, &items)
+	return items
+}
+
+// createTestCategory adds a category under a name no other test uses.
+// Categories are shared by all users, so there is no endpoint for it.
+func createTestCategory(t *testing.T) *Category {
+	t.Helper()
+
+	category := &Category{ID: uuid.New(), Name: "Test " + uuid.NewString()}
+	_, err := testTracker.db.NewInsert().Model(category).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return category
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// Category is shared by all users. Fixed marks categories of committed
+// spending, like rent or insurance, as opposed to discretionary spending.
+type Category struct {
+	bun.BaseModel `bun:"table:category"`
+
+	ID    uuid.UUID `bun:",pk" json:"id"`
+	Name  string    `json:"name"`
+	Fixed bool      `json:"fixed"`
+}
+
+// UpdateCategoryRequest is the body of PATCH /categories/:id.
+type UpdateCategoryRequest struct {
+	Fixed *bool `json:"fixed"`
+}
+
+func (trackerDb *trackerDb) updateCategory(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	req := new(UpdateCategoryRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if req.Fixed == nil {
+		return respondError(c, http.StatusBadRequest, "fixed is required")
+	}
+
+	category := new(Category)
+	err = trackerDb.db.NewUpdate().
+		Model(category).
+		Set("fixed = ?", *req.Fixed).
+		Where("id = ?", id).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Category not found")
+	}
+	if err != nil {
+		log.Printf("Error while updating: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, category)
+}
+
+// FinancialHealth summarizes the last Months complete months. The ratios
+// are fractions, e.g. 0.2 for a 20% savings rate, and are null when there
+// is nothing to divide by.
+type FinancialHealth struct {
+	Months          int     `json:"months"`
+	Income          float64 `bun:"income" json:"income"`
+	Expenses        float64 `bun:"expenses" json:"expenses"`
+	FixedExpenses   float64 `bun:"fixed_expenses" json:"fixed_expenses"`
+	Discretionary   float64 `bun:"-" json:"discretionary_expenses"`
+	AvgMonthlySpend float64 `bun:"-" json:"avg_monthly_spend"`
+	// Balance is the user's current net balance, which stands in for
+	// liquid savings when working out the emergency fund.
+	Balance             float64  `bun:"-" json:"balance"`
+	SavingsRate         *float64 `bun:"-" json:"savings_rate"`
+	ExpenseToIncome     *float64 `bun:"-" json:"expense_to_income"`
+	FixedShare          *float64 `bun:"-" json:"fixed_share"`
+	EmergencyFundMonths *float64 `bun:"-" json:"emergency_fund_months"`
+}
+
+// ratio returns a/b rounded to four places, or nil when b is not positive.
+func ratio(a, b float64) *float64 {
+	if b <= 0 {
+		return nil
+	}
+	r := math.Round(a/b*1e4) / 1e4
+	return &r
+}
+
+// getHealth works out savings rate, expense-to-income ratio, the split
+// between fixed and discretionary spending and how many months of average
+// spending the current balance would cover, over the last ?months= (6 by
+// default) complete months.
+func (trackerDb *trackerDb) getHealth(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	months := 6
+	if m := c.QueryParam("months"); m != "" {
+		var err error
+		months, err = strconv.Atoi(m)
+		if err != nil || months < 1 || months > 60 {
+			return respondError(c, http.StatusBadRequest, "months must be between 1 and 60")
+		}
+	}
+	t := today()
+	end := t.AddDate(0, 0, 1-t.Day())
+	start := end.AddDate(0, -months, 0)
+
+	health := FinancialHealth{Months: months}
+	err := trackerDb.reports.NewSelect().
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE i.type = 'credit'), 0) AS income").
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE i.type = 'debit'), 0) AS expenses").
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE i.type = 'debit' AND c.fixed), 0) AS fixed_expenses").
+		TableExpr("item i").
+		Join("LEFT JOIN category c ON i.category_id = c.id").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
+		Where("i.created_at >= ? AND i.created_at < ?", start, end).
+		Scan(ctx, &health)
+	if err != nil {
+		log.Printf("Error while getting income and expenses: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	err = trackerDb.reports.NewSelect().
+		ColumnExpr("COALESCE(SUM(CASE WHEN type = 'credit' THEN cost ELSE -cost END), 0)").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Where("NOT scheduled").
+		Apply(inProfile(currentProfile(c))).
+		Scan(ctx, &health.Balance)
+	if err != nil {
+		log.Printf("Error while getting balance: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	health.Discretionary = roundMoney(health.Expenses - health.FixedExpenses)
+	health.AvgMonthlySpend = roundMoney(health.Expenses / float64(months))
+	health.SavingsRate = ratio(health.Income-health.Expenses, health.Income)
+	health.ExpenseToIncome = ratio(health.Expenses, health.Income)
+	health.FixedShare = ratio(health.FixedExpenses, health.Expenses)
+	health.EmergencyFundMonths = ratio(max(health.Balance, 0), health.AvgMonthlySpend)
+	health.Income = roundMoney(health.Income)
+	health.Expenses = roundMoney(health.Expenses)
+	health.FixedExpenses = roundMoney(health.FixedExpenses)
+	health.Balance = roundMoney(health.Balance)
+
+	return respondOK(c, health)
+}
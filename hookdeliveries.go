@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// hookDeliveryKeep is how long delivery attempts are kept for debugging.
+const hookDeliveryKeep = 30 * 24 * time.Hour
+
+// maxHookResponse is how much of a target's answer is kept.
+const maxHookResponse = 1 << 10
+
+// HookDelivery is one attempt to deliver an event to a REST hook, kept so
+// integration failures can be looked into and retried.
+type HookDelivery struct {
+	bun.BaseModel `bun:"table:hook_delivery,alias:hd"`
+
+	ID      uuid.UUID       `bun:",pk,default:gen_random_uuid()" json:"id"`
+	HookID  uuid.UUID       `bun:"type:uuid" json:"hook_id"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `bun:"type:jsonb" json:"payload"`
+	// StatusCode is zero when the target couldn't be reached; Error says
+	// why.
+	StatusCode   int       `bun:",nullzero" json:"status_code"`
+	Error        string    `bun:",nullzero" json:"error"`
+	ResponseBody string    `bun:",nullzero" json:"response_body"`
+	LatencyMs    int64     `json:"latency_ms"`
+	RetryOf      uuid.UUID `bun:"type:uuid,nullzero" json:"retry_of"`
+	AttemptedAt  time.Time `bun:",nullzero,default:now()" json:"attempted_at"`
+}
+
+// deliverHook POSTs an event to a hook and records the attempt. Targets
+// answering 410 Gone are unsubscribed. retryOf is the delivery being
+// retried, if any.
+func (trackerDb *trackerDb) deliverHook(ctx context.Context, hook *HookSubscription, event string, body []byte, retryOf uuid.UUID) *HookDelivery {
+	d := &HookDelivery{HookID: hook.ID, Event: event, Payload: body, RetryOf: retryOf}
+
+	start := time.Now()
+	res, err := hookClient.Post(hook.TargetURL, "application/json", bytes.NewReader(body))
+	d.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		log.Printf("Error while delivering hook %s: %v", hook.ID, err)
+		d.Error = err.Error()
+	} else {
+		d.StatusCode = res.StatusCode
+		b, _ := io.ReadAll(io.LimitReader(res.Body, maxHookResponse))
+		d.ResponseBody = string(b)
+		res.Body.Close()
+	}
+
+	_, err = trackerDb.db.NewInsert().Model(d).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error while recording delivery for hook %s: %+v", hook.ID, err)
+	}
+
+	if d.StatusCode == http.StatusGone {
+		_, err = trackerDb.db.NewDelete().Model(hook).WherePK().Exec(ctx)
+		if err != nil {
+			log.Printf("Error while deleting hook %s: %+v", hook.ID, err)
+		}
+	}
+	return d
+}
+
+// pruneHookDeliveries is the daily job that forgets old delivery attempts.
+func (trackerDb *trackerDb) pruneHookDeliveries(ctx context.Context, day time.Time) error {
+	_, err := trackerDb.db.NewDelete().
+		TableExpr("hook_delivery").
+		Where("attempted_at < ?", day.Add(-hookDeliveryKeep)).
+		Exec(ctx)
+	return err
+}
+
+// getHookDeliveries lists a hook's recent delivery attempts, newest first.
+func (trackerDb *trackerDb) getHookDeliveries(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "limit must be between 1 and 1000 and offset not negative")
+	}
+	if limit == 0 {
+		limit = 50
+	}
+
+	deliveries := []HookDelivery{}
+	total, err := trackerDb.db.NewSelect().
+		Model(&deliveries).
+		Where("hook_id = ?", id).
+		OrderExpr("attempted_at DESC, id").
+		Limit(limit).
+		Offset(offset).
+		ScanAndCount(ctx)
+	if err != nil {
+		log.Printf("Error while getting hook deliveries: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondPage(c, deliveries, PageMeta{Total: total, Limit: limit, Offset: offset})
+}
+
+// retryHookDelivery sends a past delivery's payload to the hook again and
+// answers with the new attempt.
+func (trackerDb *trackerDb) retryHookDelivery(c echo.Context) error {
+	ctx := context.Background()
+
+	hook := new(HookSubscription)
+	err := trackerDb.db.NewSelect().Model(hook).Where("id = ?", c.Param("id")).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Hook not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch hook: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	orig := new(HookDelivery)
+	err = trackerDb.db.NewSelect().
+		Model(orig).
+		Where("id = ?", c.Param("delivery_id")).
+		Where("hook_id = ?", hook.ID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Delivery not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch hook delivery: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	d := trackerDb.deliverHook(ctx, hook, orig.Event, orig.Payload, orig.ID)
+	return respondCreated(c, "", d)
+}
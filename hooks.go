@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// The endpoints in this file follow the shapes no-code tools like Zapier and
+// IFTTT expect: triggers and actions answer with bare JSON rather than the
+// usual message/data envelope, and REST hooks are subscribed by target URL.
+
+const eventItemCreated = "item.created"
+
+// HookSubscription is a REST hook: every matching event is POSTed to
+// TargetURL until the subscription is deleted or the target answers 410.
+type HookSubscription struct {
+	bun.BaseModel `bun:"table:hook_subscription,alias:hs"`
+
+	ID        uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID    int       `bun:"user_id" json:"user_id"`
+	Event     string    `json:"event"`
+	TargetURL string    `json:"target_url"`
+	CreatedAt time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+var hookClient = newOutboundClient(10 * time.Second)
+
+func (trackerDb *trackerDb) subscribeHook(c echo.Context) error {
+	ctx := context.Background()
+
+	hook := new(HookSubscription)
+	err := c.Bind(hook)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if hook.Event != eventItemCreated {
+		return respondError(c, http.StatusBadRequest, "event must be "+eventItemCreated)
+	}
+	u, err := url.Parse(hook.TargetURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return respondError(c, http.StatusBadRequest, "target_url must be an http(s) URL")
+	}
+
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := checkQuota(ctx, tx, "hook_subscription", "webhooks", hook.UserID, trackerDb.env.HookQuota)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewInsert().Model(hook).Returning("*").Exec(ctx)
+		return err
+	})
+	var quota *QuotaExceeded
+	if errors.As(err, &quota) {
+		return c.JSON(http.StatusForbidden, Envelope{Message: quota.Error(), Data: quota})
+	}
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return c.JSON(http.StatusCreated, hook)
+}
+
+func (trackerDb *trackerDb) unsubscribeHook(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	_, err := trackerDb.db.NewDelete().TableExpr("hook_subscription").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// fireHooks delivers payload to the user's subscriptions for event in the
+// background. Targets answering 410 Gone are unsubscribed.
+func (trackerDb *trackerDb) fireHooks(userID int, event string, payload interface{}) {
+	go func() {
+		ctx := context.Background()
+
+		hooks := []HookSubscription{}
+		err := trackerDb.db.NewSelect().
+			Model(&hooks).
+			Where("user_id = ?", userID).
+			Where("event = ?", event).
+			Scan(ctx)
+		if err != nil {
+			log.Printf("Error while getting hooks: %+v", err)
+			return
+		}
+		if len(hooks) == 0 {
+			return
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Error while encoding hook payload: %v", err)
+			return
+		}
+
+		for i := range hooks {
+			trackerDb.deliverHook(ctx, &hooks[i], event, body, uuid.Nil)
+		}
+	}()
+}
+
+// getNewItemsTrigger is the polling trigger for new items: the user's most
+// recent items, newest first, optionally only those after since (RFC 3339).
+func (trackerDb *trackerDb) getNewItemsTrigger(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	q := trackerDb.db.NewSelect().
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		OrderExpr("created_at DESC, id DESC").
+		Limit(100)
+	if s := c.QueryParam("since"); s != "" {
+		since, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return respondError(c, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+		}
+		q = q.Where("created_at > ?", since)
+	}
+
+	items := []GetItem{}
+	err := q.Scan(ctx, &items)
+	if err != nil {
+		log.Printf("Error while getting items: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+// createItemAction is the "create item" action. It answers with the new
+// item itself so later steps of an automation can use its fields.
+func (trackerDb *trackerDb) createItemAction(c echo.Context) error {
+	ctx := context.Background()
+
+	item := new(Item)
+	err := c.Bind(item)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if item.Name == "" || item.Cost == 0 {
+		return respondError(c, http.StatusBadRequest, "name and cost are required")
+	}
+	if item.Type == "" {
+		item.Type = "debit"
+	}
+
+	// Automations can't stop to ask, so category caps don't apply here.
+	err = trackerDb.createItem(ctx, item, true)
+	var quota *QuotaExceeded
+	if errors.As(err, &quota) {
+		return c.JSON(http.StatusForbidden, Envelope{Message: quota.Error(), Data: quota})
+	}
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return c.JSON(http.StatusOK, item)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/labstack/echo"
+	"golang.org/x/text/language"
+)
+
+// supportedLanguages are the languages messages can be sent in. The first
+// is used when the client accepts none of them.
+var supportedLanguages = []language.Tag{language.English, language.Hindi}
+
+var languageMatcher = language.NewMatcher(supportedLanguages)
+
+// catalogs translate user-facing messages, keyed by their English text.
+// A message missing from a catalog is sent in English, so new messages
+// work before they are translated.
+var catalogs = map[language.Tag]map[string]string{
+	language.Hindi: {
+		"Internal server error":          "सर्वर में आंतरिक त्रुटि हुई",
+		"You are not allowed to do that": "आपको ऐसा करने की अनुमति नहीं है",
+		"Invalid token":                  "अमान्य टोकन",
+		"invalid token":                  "अमान्य टोकन",
+		"Invalid signature":              "अमान्य हस्ताक्षर",
+		"Too many requests; slow down and try again after the reset time":     "बहुत अधिक अनुरोध; धीमे चलें और रीसेट समय के बाद फिर से प्रयास करें",
+		"Too many exports running for this user; try again when one finishes": "इस उपयोगकर्ता के बहुत सारे एक्सपोर्ट चल रहे हैं; किसी एक के पूरा होने पर फिर से प्रयास करें",
+		"Too many imports running for this user; try again when one finishes": "इस उपयोगकर्ता के बहुत सारे इम्पोर्ट चल रहे हैं; किसी एक के पूरा होने पर फिर से प्रयास करें",
+		defaultMaintenanceMessage:                           "ट्रैकर का रखरखाव चल रहा है। बदलाव रोके गए हैं; कुछ मिनटों में फिर से प्रयास करें।",
+		"The virus scanner is unavailable; try again later": "वायरस स्कैनर उपलब्ध नहीं है; बाद में फिर से प्रयास करें",
+
+		"Item not found":                  "आइटम नहीं मिला",
+		"Item template not found":         "आइटम टेम्पलेट नहीं मिला",
+		"Staged item not found":           "स्टेज किया गया आइटम नहीं मिला",
+		"Category not found":              "श्रेणी नहीं मिली",
+		"Category cap not found":          "श्रेणी की सीमा नहीं मिली",
+		"Bill not found":                  "बिल नहीं मिला",
+		"Loan not found":                  "लोन नहीं मिला",
+		"Credit card not found":           "क्रेडिट कार्ड नहीं मिला",
+		"Claim not found":                 "क्लेम नहीं मिला",
+		"Invoice not found":               "इनवॉइस नहीं मिला",
+		"Profile not found":               "प्रोफ़ाइल नहीं मिली",
+		"User not found":                  "उपयोगकर्ता नहीं मिला",
+		"Payment webhook not found":       "पेमेंट वेबहुक नहीं मिला",
+		"Hook not found":                  "वेबहुक नहीं मिला",
+		"Delivery not found":              "डिलीवरी नहीं मिली",
+		"Merchant rule not found":         "व्यापारी नियम नहीं मिला",
+		"Notification channel not found":  "सूचना चैनल नहीं मिला",
+		"SMS template not found":          "SMS टेम्पलेट नहीं मिला",
+		"Import not found":                "इम्पोर्ट नहीं मिला",
+		"Import mapping not found":        "इम्पोर्ट मैपिंग नहीं मिली",
+		"Import source not found":         "इम्पोर्ट स्रोत नहीं मिला",
+		"Backup target not found":         "बैकअप लक्ष्य नहीं मिला",
+		"No sheet linked":                 "कोई शीट लिंक नहीं है",
+		"No draft invoice with that id":   "इस id का कोई ड्राफ़्ट इनवॉइस नहीं है",
+		"No unpaid invoice with that id":  "इस id का कोई बकाया इनवॉइस नहीं है",
+		"No submitted claim with that id": "इस id का कोई जमा किया गया क्लेम नहीं है",
+		"No pending item with that id":    "इस id का कोई लंबित आइटम नहीं है",
+
+		"User already exists":                             "उपयोगकर्ता पहले से मौजूद है",
+		"A profile with that name already exists":         "इस नाम की प्रोफ़ाइल पहले से मौजूद है",
+		"An import mapping with that name already exists": "इस नाम की इम्पोर्ट मैपिंग पहले से मौजूद है",
+		"Profile still has items":                         "प्रोफ़ाइल में अभी भी आइटम हैं",
+		"An invoice needs at least one line":              "इनवॉइस में कम से कम एक पंक्ति होनी चाहिए",
+		"Recipient has no user id":                        "प्राप्तकर्ता की कोई user id नहीं है",
+		"Could not read the receipt":                      "रसीद पढ़ी नहीं जा सकी",
+		"Message did not match any bank format":           "संदेश किसी भी बैंक के प्रारूप से मेल नहीं खाता",
+		"calendar feed is not configured":                 "कैलेंडर फ़ीड कॉन्फ़िगर नहीं है",
+		"Apple Wallet passes are not configured":          "Apple Wallet पास कॉन्फ़िगर नहीं हैं",
+		"Google Wallet passes are not configured":         "Google Wallet पास कॉन्फ़िगर नहीं हैं",
+		"nothing to update":                               "अपडेट करने के लिए कुछ नहीं है",
+
+		"user_id is required":          "user_id आवश्यक है",
+		"user_id must be a number":     "user_id एक संख्या होनी चाहिए",
+		"user_id must be positive":     "user_id धनात्मक होनी चाहिए",
+		"name is required":             "name आवश्यक है",
+		"period is required":           "period आवश्यक है",
+		"at is required":               "at आवश्यक है",
+		"cost must be positive":        "cost धनात्मक होनी चाहिए",
+		"type must be debit or credit": "type debit या credit होना चाहिए",
+		"limit must be between 1 and 1000 and offset not negative": "limit 1 से 1000 के बीच होना चाहिए और offset ऋणात्मक नहीं",
+
+		"User not found; register it with POST /users first":       "उपयोगकर्ता नहीं मिला; पहले POST /users से उसे पंजीकृत करें",
+		"status must be pending, cleared or reconciled":            "status pending, cleared या reconciled होना चाहिए",
+		"as_of must be a date like 2024-03-31":                     "as_of 2024-03-31 जैसी तारीख होनी चाहिए",
+		"the import is still running; wait for it to finish":       "इम्पोर्ट अभी चल रहा है; इसके पूरा होने तक प्रतीक्षा करें",
+		"the user's items changed since the dry run; run it again": "ड्राई रन के बाद से उपयोगकर्ता के आइटम बदल गए हैं; इसे फिर से चलाएँ",
+
+		"This report took too long; try a shorter period or fewer filters": "यह रिपोर्ट बनने में बहुत समय लगा; छोटी अवधि या कम फ़िल्टर के साथ फिर से प्रयास करें",
+	},
+}
+
+// requestLanguage picks the supported language that best matches the
+// request's Accept-Language header.
+func requestLanguage(c echo.Context) language.Tag {
+	tags, _, _ := language.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))
+	_, i, _ := languageMatcher.Match(tags...)
+	return supportedLanguages[i]
+}
+
+// translate returns msg in lang, or msg itself if it has no translation.
+func translate(lang language.Tag, msg string) string {
+	if t, ok := catalogs[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// localize translates msg into the language the client asked for and
+// records the language in Content-Language.
+func localize(c echo.Context, msg string) string {
+	lang := requestLanguage(c)
+	c.Response().Header().Set("Content-Language", lang.String())
+	return translate(lang, msg)
+}
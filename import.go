@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// importer parses one bank's statement export. To support a new format,
+// implement it and add it to importFormats.
+type importer interface {
+	// Parse returns the transactions in the statement, or an error saying
+	// what in the file didn't match the format.
+	Parse(r io.Reader) ([]ImportedTransaction, error)
+}
+
+// ImportedTransaction is one statement line. Amount is always positive;
+// Type says which way the money went.
+type ImportedTransaction struct {
+	Date        time.Time
+	Description string
+	Amount      float64
+	Type        string
+	// Reference is the bank's id for the transaction, if the format has one.
+	Reference string
+	// Currency is set by formats that say which currency a line is in.
+	Currency string
+	// Category is the name the exporting program filed the line under,
+	// e.g. "Groceries" or "Food:Groceries".
+	Category string
+}
+
+// ImportJob tracks a statement import, which runs in the background so
+// large files don't hold the request open.
+type ImportJob struct {
+	bun.BaseModel `bun:"table:import_job,alias:ij"`
+
+	ID     uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID int       `bun:"user_id" json:"user_id"`
+	Format string    `json:"format"`
+	// Status is running, done, failed or rolled_back. A failed job could
+	// not read the file at all; Message says why.
+	Status    string `json:"status"`
+	Message   string `bun:",nullzero" json:"message,omitempty"`
+	Total     int    `json:"total"`
+	Processed int    `json:"processed"`
+	Staged    int    `json:"staged"`
+	// Skipped counts lines that were already imported or entered.
+	Skipped    int           `json:"skipped"`
+	Errors     []ImportError `bun:"type:jsonb" json:"errors"`
+	CreatedAt  time.Time     `bun:",nullzero,default:now()" json:"created_at"`
+	UpdatedAt  time.Time     `bun:",nullzero,default:now()" json:"updated_at"`
+	FinishedAt time.Time     `bun:",nullzero" json:"finished_at"`
+}
+
+// ImportError is a statement line that could not be staged.
+type ImportError struct {
+	Row         int     `json:"row"`
+	Date        Date    `json:"date"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+	Message     string  `json:"message"`
+}
+
+// importProgressEvery is how many lines an import handles between saving
+// its progress.
+const importProgressEvery = 50
+
+// importStallAfter is how long a running import can go without saving
+// progress before it is taken to have died with its server.
+const importStallAfter = 30 * time.Minute
+
+// importCategory maps a category name from the statement to one of the
+// tracker's categories. Nested names like "Food:Groceries" are tried whole
+// and then from the most specific part up.
+func (trackerDb *trackerDb) importCategory(ctx context.Context, name string) (uuid.UUID, error) {
+	if name == "" {
+		return uuid.Nil, nil
+	}
+	parts := strings.Split(name, ":")
+	candidates := []string{name}
+	for i := len(parts) - 1; i >= 0; i-- {
+		candidates = append(candidates, strings.TrimSpace(parts[i]))
+	}
+	for _, candidate := range candidates {
+		id, err := trackerDb.categoryByName(ctx, candidate)
+		if err != nil || id != uuid.Nil {
+			return id, err
+		}
+	}
+	return uuid.Nil, nil
+}
+
+// alreadyImported reports whether the user has an item or staged item on
+// the same day with the same name, amount and direction, so importing
+// overlapping statements doesn't double up.
+func (trackerDb *trackerDb) alreadyImported(ctx context.Context, userID int, tx ImportedTransaction) (bool, error) {
+	exists, err := trackerDb.db.NewSelect().
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Where("created_at::date = ?", tx.Date.Format(time.DateOnly)).
+		Where("cost = ?", tx.Amount).
+		Where("type = ?", tx.Type).
+		Where("name = ?", tx.Description).
+		Exists(ctx)
+	if err != nil || exists {
+		return exists, err
+	}
+	return trackerDb.db.NewSelect().
+		TableExpr("staged_item").
+		Where("user_id = ?", userID).
+		Where("occurred_on = ?", tx.Date.Format(time.DateOnly)).
+		Where("cost = ?", tx.Amount).
+		Where("type = ?", tx.Type).
+		Where("name = ?", tx.Description).
+		Exists(ctx)
+}
+
+func importFormatNames() []string {
+	names := make([]string, 0, len(importFormats))
+	for name := range importFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (trackerDb *trackerDb) getImportFormats(c echo.Context) error {
+	return respondOK(c, importFormatNames())
+}
+
+// importStatement starts importing an uploaded bank statement in the
+// format named by ?format=, or laid out as the user's saved ?mapping=, and
+// answers 202 with the job, which can be followed at GET /imports/:id.
+func (trackerDb *trackerDb) importStatement(c echo.Context) error {
+	ctx := context.Background()
+
+	// The upload is gone once the request ends, so read it now, and before
+	// the other form fields so its size limit applies to the whole body.
+	data, err := trackerDb.readUpload(c, "statement", trackerDb.statementUploads())
+	var rejected *UploadRejected
+	if errors.As(err, &rejected) {
+		return respondRejected(c, rejected)
+	}
+	if err != nil {
+		log.Printf("Error while reading statement: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	userID, err := strconv.Atoi(c.FormValue("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id is required")
+	}
+
+	format, imp, err := trackerDb.resolveImporter(ctx, userID, c.QueryParam("format"), c.QueryParam("mapping"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Import mapping not found")
+	}
+	if errors.Is(err, errUnknownFormat) {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		log.Printf("Could not fetch import mapping: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	// The slot is held until the import finishes, after this request.
+	release, ok := trackerDb.imports.acquire(strconv.Itoa(userID), concurrencyWait)
+	if !ok {
+		return respondBusy(c, "Too many imports running for this user; try again when one finishes")
+	}
+	job, err := trackerDb.newImportJob(ctx, userID, format)
+	if err != nil {
+		release()
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	go func() {
+		defer release()
+		trackerDb.runImport(job, imp, data)
+	}()
+
+	c.Response().Header().Set(echo.HeaderLocation, apiPath(c, "/imports/"+job.ID.String()))
+	return c.JSON(http.StatusAccepted, Envelope{Message: "Import started", Data: job})
+}
+
+var errUnknownFormat = fmt.Errorf("format must be one of %v, or use a saved mapping", importFormatNames())
+
+// resolveImporter returns the built-in format, or the user's saved mapping
+// when mapping is set, and the name to record on import jobs. It returns
+// sql.ErrNoRows if there is no such mapping.
+func (trackerDb *trackerDb) resolveImporter(ctx context.Context, userID int, format, mapping string) (string, importer, error) {
+	if mapping != "" {
+		m, err := trackerDb.findImportMapping(ctx, userID, mapping)
+		if err != nil {
+			return "", nil, err
+		}
+		return "mapping:" + mapping, m.importer(), nil
+	}
+	imp, ok := importFormats[format]
+	if !ok {
+		return "", nil, errUnknownFormat
+	}
+	return format, imp, nil
+}
+
+func (trackerDb *trackerDb) newImportJob(ctx context.Context, userID int, format string) (*ImportJob, error) {
+	job := &ImportJob{UserID: userID, Format: format, Status: "running", Errors: []ImportError{}}
+	_, err := trackerDb.db.NewInsert().Model(job).Returning("*").Exec(ctx)
+	return job, err
+}
+
+// runImport stages the transactions in data for the user to confirm,
+// skipping lines they already have. Lines that fail are recorded on the
+// job and the rest carry on. A panic, say in a parser, fails the job
+// instead of taking the server down with it.
+func (trackerDb *trackerDb) runImport(job *ImportJob, imp importer, data []byte) {
+	ctx := context.Background()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Import job %s panicked: %v\n%s", job.ID, r, debug.Stack())
+			job.Status = "failed"
+			job.Message = "The import failed unexpectedly; lines staged so far were kept"
+			trackerDb.saveImportJob(ctx, job)
+		}
+	}()
+
+	txns, err := imp.Parse(bytes.NewReader(data))
+	if err != nil {
+		job.Status = "failed"
+		job.Message = err.Error()
+		trackerDb.saveImportJob(ctx, job)
+		return
+	}
+	job.Total = len(txns)
+	trackerDb.saveImportJob(ctx, job)
+
+	fail := func(row int, tx ImportedTransaction, err error) {
+		log.Printf("Error while importing row %d of job %s: %v", row, job.ID, err)
+		job.Errors = append(job.Errors, ImportError{
+			Row:         row,
+			Date:        Date{tx.Date},
+			Description: tx.Description,
+			Amount:      tx.Amount,
+			Message:     "Could not stage this line",
+		})
+	}
+
+	// Check every line before staging any, so that two identical lines in
+	// one statement, like two coffees on the same day, are both kept.
+	fresh := make([]bool, len(txns))
+	for i, tx := range txns {
+		dup, err := trackerDb.alreadyImported(ctx, job.UserID, tx)
+		if err != nil {
+			fail(i+1, tx, err)
+			job.Processed++
+			continue
+		}
+		if dup {
+			job.Skipped++
+			job.Processed++
+		}
+		fresh[i] = !dup
+		if (i+1)%importProgressEvery == 0 {
+			trackerDb.saveImportJob(ctx, job)
+		}
+	}
+	trackerDb.saveImportJob(ctx, job)
+
+	for i, tx := range txns {
+		if !fresh[i] {
+			continue
+		}
+		err := trackerDb.stageImported(ctx, job, tx)
+		if err != nil {
+			fail(i+1, tx, err)
+		} else {
+			job.Staged++
+		}
+		job.Processed++
+		if job.Processed%importProgressEvery == 0 {
+			trackerDb.saveImportJob(ctx, job)
+		}
+	}
+
+	job.Status = "done"
+	trackerDb.saveImportJob(ctx, job)
+}
+
+func (trackerDb *trackerDb) stageImported(ctx context.Context, job *ImportJob, tx ImportedTransaction) error {
+	categoryID, err := trackerDb.importCategory(ctx, tx.Category)
+	if err != nil {
+		return err
+	}
+	return trackerDb.stage(ctx, &StagedItem{
+		UserID:        job.UserID,
+		Source:        "import",
+		ImportBatchID: job.ID,
+		Name:          tx.Description,
+		Cost:          tx.Amount,
+		Type:          tx.Type,
+		CategoryID:    categoryID,
+		OccurredOn:    Date{tx.Date},
+		Details: map[string]interface{}{
+			"format":    job.Format,
+			"import_id": job.ID,
+			"reference": tx.Reference,
+			"currency":  tx.Currency,
+			"category":  tx.Category,
+		},
+	})
+}
+
+// saveImportJob records a job's progress, and when it has finished.
+func (trackerDb *trackerDb) saveImportJob(ctx context.Context, job *ImportJob) {
+	job.UpdatedAt = time.Now()
+	if job.Status != "running" {
+		job.FinishedAt = time.Now()
+	}
+	err := retry(ctx, func() error {
+		_, err := trackerDb.db.NewUpdate().Model(job).ExcludeColumn("user_id", "format", "created_at").WherePK().Exec(ctx)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error while saving import job %s: %+v", job.ID, err)
+	}
+}
+
+// failStalledImports is the hourly job that marks imports whose progress
+// hasn't been saved for importStallAfter as failed. They were running on a
+// server that has since stopped, and nothing will finish them.
+func (trackerDb *trackerDb) failStalledImports(ctx context.Context, hour time.Time) error {
+	_, err := trackerDb.db.NewUpdate().
+		TableExpr("import_job").
+		Set("status = 'failed'").
+		Set("message = 'The server stopped during the import; lines staged so far were kept'").
+		Set("finished_at = now()").
+		Where("status = 'running'").
+		Where("updated_at < ?", hour.Add(-importStallAfter)).
+		Exec(ctx)
+	return err
+}
+
+func (trackerDb *trackerDb) getImportJob(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	job := new(ImportJob)
+	err := trackerDb.db.NewSelect().Model(job).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Import not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch import job: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, job)
+}
+
+// getImportErrors downloads the lines of an import that could not be
+// staged as a CSV file.
+func (trackerDb *trackerDb) getImportErrors(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	job := new(ImportJob)
+	err := trackerDb.db.NewSelect().Model(job).Column("id", "errors").Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Import not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch import job: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-errors.csv"`, job.ID))
+	return writeCSV(c, http.StatusOK, job.Errors)
+}
+
+// ImportRollback is what undoing an import removed.
+type ImportRollback struct {
+	Items  int `json:"items"`
+	Staged int `json:"staged"`
+}
+
+var errImportRunning = errors.New("the import is still running; wait for it to finish")
+
+// rollbackImport serves DELETE /imports/:id/items, which undoes a whole
+// import in one transaction: the items confirmed from it and the lines
+// still waiting to be confirmed are deleted, and the job is marked
+// rolled_back. Items entered by hand are never touched, even if the import
+// skipped a line as a duplicate of one.
+func (trackerDb *trackerDb) rollbackImport(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	var result ImportRollback
+	err := trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		job := new(ImportJob)
+		err := tx.NewSelect().Model(job).Where("id = ?", id).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return err
+		}
+		if job.Status == "running" {
+			return errImportRunning
+		}
+
+		res, err := tx.NewDelete().
+			TableExpr("item").
+			Where("import_batch_id = ?", job.ID).
+			Where("user_id = ?", job.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		result.Items = int(n)
+
+		res, err = tx.NewDelete().
+			TableExpr("staged_item").
+			Where("import_batch_id = ?", job.ID).
+			Where("user_id = ?", job.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		n, _ = res.RowsAffected()
+		result.Staged = int(n)
+
+		_, err = tx.NewUpdate().
+			TableExpr("import_job").
+			Set("status = 'rolled_back'").
+			Set("updated_at = now()").
+			Where("id = ?", job.ID).
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Import not found")
+	}
+	if errors.Is(err, errImportRunning) {
+		return respondError(c, http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error while rolling back import %s: %+v", id, err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, result)
+}
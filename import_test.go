@@ -0,0 +1,85 @@
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+)
+
+const revolutStatement = `Type,Started Date,Completed Date,Description,Amount,Fee,Currency,State
+CARD_PAYMENT,2026-10-01 09:30:00,2026-10-01 09:31:00,Coffee Shop,-120.00,0.00,INR,COMPLETED
+TOPUP,2026-10-02 10:00:00,2026-10-02 10:00:00,Salary,5000.00,0.00,INR,COMPLETED
+CARD_PAYMENT,2026-10-03 12:00:00,,Bookshop,-300.00,0.00,INR,DECLINED
+`
+
+// uploadStatement posts statement to POST /api/v2/import as the multipart
+// form the import expects. It leaves the file out if statement is empty.
+func uploadStatement(t *testing.T, userID int, format, statement string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("user_id", strconv.Itoa(userID))
+	if statement != "" {
+		part, err := w.CreateFormFile("statement", "statement.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, statement)
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/import?format="+format, &body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	testServer.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImportStatement(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := uploadStatement(t, userID, "revolut_csv", revolutStatement)
+	expectStatus(t, rec, http.StatusAccepted)
+	loc := rec.Header().Get("Location")
+
+	// The import runs in the background.
+	var job ImportJob
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		rec = request(t, http.MethodGet, loc, nil)
+		expectStatus(t, rec, http.StatusOK)
+		decodeData(t, rec, &job)
+		if job.Status != "running" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if job.Status != "done" || job.Staged != 2 || len(job.Errors) != 0 {
+		t.Errorf("import finished as %+v, want 2 lines staged", job)
+	}
+
+	rec = request(t, http.MethodGet, "/api/v2/import/formats", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestImportErrors(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := uploadStatement(t, userID, "revolut_csv", "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = uploadStatement(t, userID, "abacus_csv", revolutStatement)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = request(t, http.MethodGet, "/api/v2/imports/"+uuid.NewString(), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
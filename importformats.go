@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importFormats are the statement formats POST /import?format= accepts.
+var importFormats = map[string]importer{
+	"hdfc_csv": csvStatement{
+		Date:        []string{"date"},
+		DateLayouts: []string{"02/01/06", "02/01/2006"},
+		Description: []string{"narration", "description"},
+		Debit:       []string{"debit amount", "withdrawal amt."},
+		Credit:      []string{"credit amount", "deposit amt."},
+		Reference:   []string{"chq/ref number", "chq./ref.no."},
+	},
+	"revolut_csv": csvStatement{
+		Date:        []string{"completed date", "started date"},
+		DateLayouts: []string{time.DateTime, time.DateOnly},
+		Description: []string{"description"},
+		Amount:      []string{"amount"},
+		Fee:         []string{"fee"},
+		Currency:    []string{"currency"},
+		Keep:        func(row map[string]string) bool { return row["state"] == "" || row["state"] == "COMPLETED" },
+	},
+	// UPI apps. Paytm's UPI statement signs its amounts; PhonePe's
+	// statement, once converted from PDF to CSV, has a separate type column.
+	"paytm_upi_csv": csvStatement{
+		Date:        []string{"date"},
+		DateLayouts: []string{"02/01/2006", "02/01/06", "2006-01-02"},
+		Description: []string{"transaction details"},
+		Amount:      []string{"amount"},
+		Reference:   []string{"upi ref no.", "upi ref no"},
+		Category:    []string{"tags"},
+	},
+	"phonepe_csv": csvStatement{
+		Date:        []string{"date"},
+		DateLayouts: []string{"Jan 02, 2006", "Jan 2, 2006", "02-01-2006", "02/01/2006"},
+		Description: []string{"transaction details"},
+		Amount:      []string{"amount"},
+		Direction:   []string{"type"},
+		Reference:   []string{"utr no.", "transaction id"},
+	},
+	"gpay_takeout": gpayTakeout{},
+	"amex_ofx":     ofxStatement{},
+	"ofx":          ofxStatement{},
+	"qif":          qifStatement{},
+	"qif_dmy":      qifStatement{DayFirst: true},
+}
+
+// csvStatement reads CSV exports whose columns can be found by their
+// header. Each field lists the header names the column goes by, compared
+// case-insensitively. Amounts come either signed in one Amount column,
+// negative for money going out, or in separate Debit and Credit columns.
+type csvStatement struct {
+	Date        []string
+	DateLayouts []string
+	Description []string
+	Amount      []string
+	Debit       []string
+	Credit      []string
+	Fee         []string
+	Reference   []string
+	Currency    []string
+	Category    []string
+	// Negate is for statements that show money going out as positive.
+	Negate bool
+	// Direction is a column saying debit (or dr) or credit (or cr), for
+	// statements whose Amount column is never negative.
+	Direction []string
+	// Keep, if set, drops rows it returns false for, e.g. pending or
+	// declined card payments. It gets the row keyed by lower-cased header.
+	Keep func(row map[string]string) bool
+}
+
+func (s csvStatement) Parse(r io.Reader) ([]ImportedTransaction, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Banks often put account details above the header, so look for the
+	// first row that names the date and description columns.
+	header := -1
+	var cols map[string]int
+	for i, record := range records {
+		cols = map[string]int{}
+		for j, name := range record {
+			cols[strings.ToLower(strings.TrimSpace(name))] = j
+		}
+		if s.column(cols, s.Date) >= 0 && s.column(cols, s.Description) >= 0 {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, errors.New("could not find the header row; is this the right format?")
+	}
+
+	txns := []ImportedTransaction{}
+	for i, record := range records[header+1:] {
+		line := header + i + 2
+		row := map[string]string{}
+		empty := true
+		for name, j := range cols {
+			if j < len(record) {
+				row[name] = strings.TrimSpace(record[j])
+				empty = empty && row[name] == ""
+			}
+		}
+		if empty || s.Keep != nil && !s.Keep(row) {
+			continue
+		}
+
+		tx, err := s.transaction(row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if tx.Amount != 0 {
+			txns = append(txns, tx)
+		}
+	}
+	return txns, nil
+}
+
+func (s csvStatement) column(cols map[string]int, names []string) int {
+	for _, name := range names {
+		if j, ok := cols[name]; ok {
+			return j
+		}
+	}
+	return -1
+}
+
+func (s csvStatement) value(row map[string]string, names []string) string {
+	for _, name := range names {
+		if v := row[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (s csvStatement) transaction(row map[string]string) (ImportedTransaction, error) {
+	tx := ImportedTransaction{
+		Description: s.value(row, s.Description),
+		Reference:   s.value(row, s.Reference),
+		Currency:    s.value(row, s.Currency),
+		Category:    s.value(row, s.Category),
+	}
+
+	var err error
+	date := s.value(row, s.Date)
+	for _, layout := range s.DateLayouts {
+		tx.Date, err = time.Parse(layout, date)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return tx, fmt.Errorf("date %q is not in a known layout", date)
+	}
+
+	var amount float64
+	if s.Amount != nil {
+		amount, err = parseStatementAmount(s.value(row, s.Amount))
+		if s.Negate {
+			amount = -amount
+		}
+		if s.Direction != nil && err == nil {
+			switch d := strings.ToLower(s.value(row, s.Direction)); d {
+			case "debit", "dr":
+				amount = -math.Abs(amount)
+			case "credit", "cr":
+				amount = math.Abs(amount)
+			default:
+				return tx, fmt.Errorf("type %q is neither debit nor credit", d)
+			}
+		}
+	} else {
+		var debit, credit float64
+		debit, err = parseStatementAmount(s.value(row, s.Debit))
+		if err == nil {
+			credit, err = parseStatementAmount(s.value(row, s.Credit))
+		}
+		amount = credit - debit
+	}
+	if err != nil {
+		return tx, err
+	}
+	if s.Fee != nil {
+		fee, err := parseStatementAmount(s.value(row, s.Fee))
+		if err != nil {
+			return tx, err
+		}
+		amount -= fee
+	}
+
+	tx.Type = "credit"
+	if amount < 0 {
+		tx.Type = "debit"
+	}
+	tx.Amount = roundMoney(math.Abs(amount))
+	return tx, nil
+}
+
+// parseStatementAmount reads amounts like "1,234.50", "-12.00" or
+// "₹250". Empty cells are zero.
+func parseStatementAmount(s string) (float64, error) {
+	s = strings.NewReplacer(",", "", " ", "", "₹", "").Replace(s)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q is not a number", s)
+	}
+	return v, nil
+}
+
+var (
+	ofxTransaction = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	ofxField       = regexp.MustCompile(`(?i)<(\w+)>([^<\r\n]*)`)
+	ofxCurrency    = regexp.MustCompile(`(?i)<CURDEF>([^<\r\n]*)`)
+)
+
+// ofxStatement reads OFX 1.x (SGML) and 2.x (XML) statement downloads, as
+// offered by Amex and most card issuers. TRNAMT is negative for charges.
+type ofxStatement struct{}
+
+func (ofxStatement) Parse(r io.Reader) ([]ImportedTransaction, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body := string(b)
+	if !strings.Contains(strings.ToUpper(body), "<OFX>") {
+		return nil, errors.New("not an OFX file")
+	}
+
+	var currency string
+	if m := ofxCurrency.FindStringSubmatch(body); m != nil {
+		currency = strings.TrimSpace(m[1])
+	}
+
+	txns := []ImportedTransaction{}
+	for i, m := range ofxTransaction.FindAllStringSubmatch(body, -1) {
+		fields := map[string]string{}
+		for _, f := range ofxField.FindAllStringSubmatch(m[1], -1) {
+			fields[strings.ToUpper(f[1])] = strings.TrimSpace(f[2])
+		}
+
+		posted := fields["DTPOSTED"]
+		if len(posted) < 8 {
+			return nil, fmt.Errorf("transaction %d: DTPOSTED %q is not a date", i+1, posted)
+		}
+		date, err := time.Parse("20060102", posted[:8])
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: DTPOSTED %q is not a date", i+1, posted)
+		}
+		amount, err := parseStatementAmount(fields["TRNAMT"])
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+		}
+		if amount == 0 {
+			continue
+		}
+
+		tx := ImportedTransaction{
+			Date:        date,
+			Description: fields["NAME"],
+			Amount:      roundMoney(math.Abs(amount)),
+			Type:        "credit",
+			Reference:   fields["FITID"],
+			Currency:    currency,
+		}
+		if tx.Description == "" {
+			tx.Description = fields["MEMO"]
+		}
+		if amount < 0 {
+			tx.Type = "debit"
+		}
+		txns = append(txns, tx)
+	}
+	return txns, nil
+}
+
+// qifStatement reads Quicken Interchange Format exports from Quicken,
+// GnuCash and the like. Dates are month first unless DayFirst is set.
+// Investment accounts and the category and class lists are skipped.
+type qifStatement struct {
+	DayFirst bool
+}
+
+func (s qifStatement) Parse(r io.Reader) ([]ImportedTransaction, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(b)), "!") {
+		return nil, errors.New("not a QIF file")
+	}
+
+	txns := []ImportedTransaction{}
+	var section string
+	var tx ImportedTransaction
+	var amount float64
+	var memo string
+	for i, line := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line[0] == '!' {
+			if t, ok := strings.CutPrefix(line, "!Type:"); ok {
+				section = strings.ToLower(strings.TrimSpace(t))
+			}
+			continue
+		}
+		switch section {
+		case "bank", "cash", "ccard", "oth a", "oth l":
+		default:
+			continue
+		}
+
+		code, value := line[0], strings.TrimSpace(line[1:])
+		switch code {
+		case 'D':
+			tx.Date, err = s.date(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		case 'T', 'U':
+			amount, err = parseStatementAmount(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		case 'P':
+			tx.Description = value
+		case 'M':
+			memo = value
+		case 'N':
+			tx.Reference = value
+		case 'L':
+			// Transfers are written as [Account]; anything after a slash
+			// is a class, not part of the category.
+			if !strings.HasPrefix(value, "[") {
+				tx.Category, _, _ = strings.Cut(value, "/")
+			}
+		case '^':
+			if tx.Description == "" {
+				tx.Description = memo
+			}
+			if tx.Date.IsZero() {
+				return nil, fmt.Errorf("line %d: transaction has no date", i+1)
+			}
+			if amount != 0 {
+				tx.Type = "credit"
+				if amount < 0 {
+					tx.Type = "debit"
+				}
+				tx.Amount = roundMoney(math.Abs(amount))
+				txns = append(txns, tx)
+			}
+			tx, amount, memo = ImportedTransaction{}, 0, ""
+		}
+	}
+	return txns, nil
+}
+
+// date reads QIF dates, which come as 10/5/2026, 10/ 5'26, 10-05-26 or
+// 2026-10-05 depending on the program and its version.
+func (s qifStatement) date(v string) (time.Time, error) {
+	norm := strings.NewReplacer(" ", "", "'", "/", "-", "/", ".", "/").Replace(v)
+	layouts := []string{"1/2/2006", "1/2/06"}
+	if s.DayFirst {
+		layouts = []string{"2/1/2006", "2/1/06"}
+	}
+	layouts = append(layouts, "2006/1/2")
+	for _, layout := range layouts {
+		d, err := time.Parse(layout, norm)
+		if err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date %q is not in a known layout", v)
+}
+
+var (
+	gpayTitle = regexp.MustCompile(`^(Paid|Sent|Received)\s+₹\s*([\d,]+(?:\.\d+)?)(?:\s+(?:to|from)\s+(.+?))?(?:\s+using\s+.+)?$`)
+	ist       = time.FixedZone("IST", 5*60*60+30*60)
+)
+
+// gpayTakeout reads the Google Pay activity Google Takeout exports as
+// My Activity.json, one entry per payment titled like "Paid ₹250.00 to
+// Swiggy using Bank Account XXXXXX1234". Entries that aren't payments,
+// like rewards or failed attempts, are skipped. Times are UTC and are
+// dated in India's time zone.
+type gpayTakeout struct{}
+
+func (gpayTakeout) Parse(r io.Reader) ([]ImportedTransaction, error) {
+	var entries []struct {
+		Header  string    `json:"header"`
+		Title   string    `json:"title"`
+		Time    time.Time `json:"time"`
+		Details []struct {
+			Name string `json:"name"`
+		} `json:"details"`
+	}
+	err := json.NewDecoder(r).Decode(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("not a Google Takeout activity file: %w", err)
+	}
+
+	txns := []ImportedTransaction{}
+	for i, e := range entries {
+		m := gpayTitle.FindStringSubmatch(strings.TrimSpace(e.Title))
+		if m == nil || e.Header != "Google Pay" || failedActivity(e.Details) {
+			continue
+		}
+		amount, err := parseStatementAmount(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if amount == 0 {
+			continue
+		}
+
+		tx := ImportedTransaction{
+			Date:        e.Time.In(ist),
+			Description: m[3],
+			Amount:      roundMoney(amount),
+			Type:        "debit",
+			Currency:    "INR",
+		}
+		if m[1] == "Received" {
+			tx.Type = "credit"
+		}
+		if tx.Description == "" {
+			tx.Description = "UPI transfer"
+		}
+		txns = append(txns, tx)
+	}
+	return txns, nil
+}
+
+func failedActivity(details []struct {
+	Name string `json:"name"`
+}) bool {
+	for _, d := range details {
+		if strings.EqualFold(d.Name, "Failed") || strings.EqualFold(d.Name, "Cancelled") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// ImportMapping is a user's own description of a CSV statement layout,
+// saved under a name so it can be used with POST /import?mapping=.
+// Columns are named by their header, ignoring case.
+type ImportMapping struct {
+	bun.BaseModel `bun:"table:import_mapping,alias:im"`
+
+	ID         uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID     int       `bun:"user_id" json:"user_id"`
+	Name       string    `json:"name"`
+	DateColumn string    `json:"date_column"`
+	// DateFormat is written like DD/MM/YYYY; see dateLayout.
+	DateFormat        string `json:"date_format"`
+	DescriptionColumn string `json:"description_column"`
+	// Either AmountColumn, signed with money going out negative, or
+	// DebitColumn and CreditColumn. DebitsPositive flips the sign of
+	// AmountColumn for statements, like most card ones, that show charges
+	// as positive.
+	AmountColumn    string    `bun:",nullzero" json:"amount_column"`
+	DebitColumn     string    `bun:",nullzero" json:"debit_column"`
+	CreditColumn    string    `bun:",nullzero" json:"credit_column"`
+	DebitsPositive  bool      `json:"debits_positive"`
+	ReferenceColumn string    `bun:",nullzero" json:"reference_column"`
+	CurrencyColumn  string    `bun:",nullzero" json:"currency_column"`
+	CategoryColumn  string    `bun:",nullzero" json:"category_column"`
+	CreatedAt       time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+var dateFormatTokens = strings.NewReplacer(
+	"YYYY", "2006", "YY", "06", "MMM", "Jan", "MM", "01", "DD", "02",
+	"hh", "15", "mm", "04", "ss", "05",
+)
+
+// dateLayout turns a format like DD/MM/YYYY or YYYY-MM-DD hh:mm:ss into a
+// Go time layout.
+func (m *ImportMapping) dateLayout() string {
+	return dateFormatTokens.Replace(m.DateFormat)
+}
+
+func (m *ImportMapping) validate() string {
+	if m.Name == "" {
+		return "name is required"
+	}
+	if m.DateColumn == "" || m.DescriptionColumn == "" {
+		return "date_column and description_column are required"
+	}
+	if !strings.Contains(m.DateFormat, "YY") || !strings.Contains(m.DateFormat, "DD") {
+		return "date_format must give the year, month and day, e.g. DD/MM/YYYY"
+	}
+	if (m.AmountColumn == "") == (m.DebitColumn == "" && m.CreditColumn == "") {
+		return "give either amount_column or debit_column and credit_column"
+	}
+	if m.AmountColumn == "" && (m.DebitColumn == "" || m.CreditColumn == "") {
+		return "debit_column and credit_column go together"
+	}
+	return ""
+}
+
+func column(name string) []string {
+	if name == "" {
+		return nil
+	}
+	return []string{strings.ToLower(strings.TrimSpace(name))}
+}
+
+// importer reads statements laid out as the mapping describes.
+func (m *ImportMapping) importer() importer {
+	return csvStatement{
+		Date:        column(m.DateColumn),
+		DateLayouts: []string{m.dateLayout()},
+		Description: column(m.DescriptionColumn),
+		Amount:      column(m.AmountColumn),
+		Debit:       column(m.DebitColumn),
+		Credit:      column(m.CreditColumn),
+		Reference:   column(m.ReferenceColumn),
+		Currency:    column(m.CurrencyColumn),
+		Category:    column(m.CategoryColumn),
+		Negate:      m.DebitsPositive,
+	}
+}
+
+// findImportMapping returns sql.ErrNoRows when the user has no mapping
+// with that name.
+func (trackerDb *trackerDb) findImportMapping(ctx context.Context, userID int, name string) (*ImportMapping, error) {
+	m := new(ImportMapping)
+	err := trackerDb.db.NewSelect().Model(m).Where("user_id = ?", userID).Where("name = ?", name).Scan(ctx)
+	return m, err
+}
+
+func (trackerDb *trackerDb) addImportMapping(c echo.Context) error {
+	ctx := context.Background()
+
+	m := new(ImportMapping)
+	err := c.Bind(m)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if msg := m.validate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	m.ID = uuid.Nil
+
+	_, err = trackerDb.db.NewInsert().Model(m).Returning("*").Exec(ctx)
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) && pgErr.Field('C') == "23505" {
+		return respondError(c, http.StatusConflict, "An import mapping with that name already exists")
+	}
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, "", m)
+}
+
+func (trackerDb *trackerDb) getAllImportMappings(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	mappings := []ImportMapping{}
+	err := trackerDb.db.NewSelect().Model(&mappings).Where("user_id = ?", userID).Order("name").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting import mappings: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, mappings)
+}
+
+// updateImportMapping replaces everything about a mapping but its owner.
+func (trackerDb *trackerDb) updateImportMapping(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	m := new(ImportMapping)
+	err := c.Bind(m)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if msg := m.validate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+
+	err = trackerDb.db.NewUpdate().
+		Model(m).
+		ExcludeColumn("id", "user_id", "created_at").
+		Where("id = ?", id).
+		Returning("*").
+		Scan(ctx)
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) && pgErr.Field('C') == "23505" {
+		return respondError(c, http.StatusConflict, "An import mapping with that name already exists")
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Import mapping not found")
+	}
+	if err != nil {
+		log.Printf("Error while updating: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, m)
+}
+
+func (trackerDb *trackerDb) deleteImportMapping(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("import_mapping").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Import mapping not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
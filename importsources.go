@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// ImportSource is a place the tracker checks every hour for new statement
+// files, which it imports like uploads to POST /import. Only S3 buckets,
+// and services speaking the S3 API, are supported so far.
+type ImportSource struct {
+	bun.BaseModel `bun:"table:import_source,alias:isrc"`
+
+	ID     uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID int       `bun:"user_id" json:"user_id"`
+	Name   string    `json:"name"`
+	Kind   string    `json:"kind"`
+	// Files are read with the built-in Format or the user's saved Mapping.
+	Format  string `bun:",nullzero" json:"format"`
+	Mapping string `bun:",nullzero" json:"mapping"`
+	Bucket  string `json:"bucket"`
+	Prefix  string `bun:",nullzero" json:"prefix"`
+	Region  string `json:"region"`
+	// Endpoint is for S3-compatible services such as MinIO or R2; empty
+	// means AWS.
+	Endpoint    string `bun:",nullzero" json:"endpoint"`
+	AccessKeyID string `json:"access_key_id"`
+	// SecretAccessKey is write-only and never sent back.
+	SecretAccessKey string    `json:"secret_access_key,omitempty"`
+	LastPolledAt    time.Time `bun:",nullzero" json:"last_polled_at"`
+	LastError       string    `bun:",nullzero" json:"last_error"`
+	CreatedAt       time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// ImportSourceFile records a file that was picked up, so it is imported
+// only once.
+type ImportSourceFile struct {
+	bun.BaseModel `bun:"table:import_source_file,alias:isf"`
+
+	SourceID   uuid.UUID `bun:",pk,type:uuid" json:"source_id"`
+	Key        string    `bun:",pk" json:"key"`
+	JobID      uuid.UUID `bun:"type:uuid,nullzero" json:"job_id"`
+	ImportedAt time.Time `bun:",nullzero,default:now()" json:"imported_at"`
+}
+
+var s3Client = newOutboundClient(time.Minute)
+
+func (trackerDb *trackerDb) validateImportSource(ctx context.Context, src *ImportSource) (string, error) {
+	if src.Name == "" {
+		return "name is required", nil
+	}
+	switch src.Kind {
+	case "s3":
+	case "sftp", "imap":
+		return src.Kind + " sources are not supported yet", nil
+	default:
+		return "kind must be s3", nil
+	}
+	if src.Bucket == "" || src.AccessKeyID == "" || src.SecretAccessKey == "" {
+		return "bucket, access_key_id and secret_access_key are required", nil
+	}
+	if src.Region == "" {
+		src.Region = "us-east-1"
+	}
+	if src.Endpoint != "" {
+		u, err := url.Parse(src.Endpoint)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return "endpoint must be an https URL", nil
+		}
+	}
+	if (src.Format == "") == (src.Mapping == "") {
+		return "give either format or mapping", nil
+	}
+	_, _, err := trackerDb.resolveImporter(ctx, src.UserID, src.Format, src.Mapping)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "no import mapping named " + src.Mapping, nil
+	}
+	if errors.Is(err, errUnknownFormat) {
+		return err.Error(), nil
+	}
+	return "", err
+}
+
+// s3Object is what ListObjectsV2 says about a file.
+type s3Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+func (src *ImportSource) objectURL(key string, query url.Values) *url.URL {
+	return s3URL(src.Endpoint, src.Bucket, src.Region, key, query)
+}
+
+func (src *ImportSource) s3Get(ctx context.Context, u *url.URL) (*http.Response, error) {
+	return s3Do(ctx, s3Credentials{src.Region, src.AccessKeyID, src.SecretAccessKey}, http.MethodGet, u, nil)
+}
+
+// s3URL addresses key in bucket on AWS, or on the S3-compatible service at
+// endpoint if it is set.
+func s3URL(endpoint, bucket, region, key string, query url.Values) *url.URL {
+	u := &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}
+	if endpoint != "" {
+		// S3-compatible services are addressed path-style.
+		u, _ = url.Parse(strings.TrimRight(endpoint, "/"))
+		u.Path += "/" + bucket + "/" + key
+	}
+	u.RawPath = awsEscape(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return u
+}
+
+type s3Credentials struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// s3Do makes a request signed with AWS Signature Version 4 and fails
+// unless S3 answers 200.
+func s3Do(ctx context.Context, creds s3Credentials, method string, u *url.URL, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := hex.EncodeToString(sha256Sum(body))
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + creds.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sha256Sum([]byte(canonical)))
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{day, creds.Region, "s3", "aws4_request"} {
+		key = hmacSum(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSum(key, toSign))))
+
+	res, err := s3Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		var e struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		xml.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&e)
+		return nil, fmt.Errorf("s3: %s: %s %s", res.Status, e.Code, e.Message)
+	}
+	return res, nil
+}
+
+// listObjects returns every file under the source's prefix.
+func (src *ImportSource) listObjects(ctx context.Context) ([]s3Object, error) {
+	var objects []s3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if src.Prefix != "" {
+			query.Set("prefix", src.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := src.s3Get(ctx, src.objectURL("", query))
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (src *ImportSource) getObject(ctx context.Context, key string, limit int64) ([]byte, error) {
+	res, err := src.s3Get(ctx, src.objectURL(key, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return io.ReadAll(io.LimitReader(res.Body, limit+1))
+}
+
+// pollImportSource imports the files that have appeared in a source since
+// it was last checked and tells the user how each went. It returns how
+// many files it imported.
+func (trackerDb *trackerDb) pollImportSource(ctx context.Context, src *ImportSource) (int, error) {
+	n, err := trackerDb.importNewFiles(ctx, src)
+	src.LastError = ""
+	if err != nil {
+		src.LastError = err.Error()
+	} else {
+		src.LastPolledAt = time.Now()
+	}
+
+	_, uerr := trackerDb.db.NewUpdate().Model(src).Column("last_polled_at", "last_error").WherePK().Exec(ctx)
+	if err == nil {
+		err = uerr
+	}
+	return n, err
+}
+
+func (trackerDb *trackerDb) importNewFiles(ctx context.Context, src *ImportSource) (int, error) {
+	objects, err := src.listObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var seen []string
+	err = trackerDb.db.NewSelect().
+		Column("key").
+		TableExpr("import_source_file").
+		Where("source_id = ?", src.ID).
+		Scan(ctx, &seen)
+	if err != nil {
+		return 0, err
+	}
+	done := make(map[string]bool, len(seen))
+	for _, key := range seen {
+		done[key] = true
+	}
+
+	n := 0
+	for _, obj := range objects {
+		if done[obj.Key] || strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		err = trackerDb.importSourceFile(ctx, src, obj)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// importSourceFile imports one file and records it as done, even if its
+// import failed, so a bad file isn't retried every hour. The user hears
+// about the result either way.
+func (trackerDb *trackerDb) importSourceFile(ctx context.Context, src *ImportSource, obj s3Object) error {
+	file := &ImportSourceFile{SourceID: src.ID, Key: obj.Key}
+	var text string
+
+	format, imp, err := trackerDb.resolveImporter(ctx, src.UserID, src.Format, src.Mapping)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, errUnknownFormat) {
+		return fmt.Errorf("import mapping %q no longer exists", src.Mapping)
+	}
+	if err != nil {
+		return err
+	}
+
+	rule := trackerDb.statementUploads()
+	if obj.Size > rule.MaxSize {
+		text = fmt.Sprintf("Skipped %s from %s: %s", obj.Key, src.Name, rule.tooLarge())
+	} else {
+		data, err := src.getObject(ctx, obj.Key, rule.MaxSize)
+		if err != nil {
+			return err
+		}
+		// A file the scanner couldn't check is left for the next poll; any
+		// other rejection is final.
+		var rejected *UploadRejected
+		err = trackerDb.checkUpload(ctx, rule, data)
+		if errors.As(err, &rejected) && rejected.Code == "scan_failed" {
+			return err
+		}
+		if rejected != nil {
+			text = fmt.Sprintf("Skipped %s from %s: %s", obj.Key, src.Name, rejected)
+		} else {
+			job, err := trackerDb.newImportJob(ctx, src.UserID, format)
+			if err != nil {
+				return err
+			}
+			trackerDb.runImport(job, imp, data)
+			file.JobID = job.ID
+
+			if job.Status == "failed" {
+				text = fmt.Sprintf("Could not import %s from %s: %s", obj.Key, src.Name, job.Message)
+			} else {
+				text = fmt.Sprintf("Imported %s from %s: %d staged for review, %d already there, %d failed",
+					obj.Key, src.Name, job.Staged, job.Skipped, len(job.Errors))
+			}
+		}
+	}
+
+	_, err = trackerDb.db.NewInsert().Model(file).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	err = trackerDb.notify(ctx, src.UserID, text)
+	if err != nil {
+		log.Printf("Error while notifying user %d: %v", src.UserID, err)
+	}
+	return nil
+}
+
+// pollImportSources is the hourly job that checks every import source.
+func (trackerDb *trackerDb) pollImportSources(ctx context.Context, hour time.Time) error {
+	sources := []ImportSource{}
+	err := trackerDb.db.NewSelect().Model(&sources).Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range sources {
+		_, err = trackerDb.pollImportSource(ctx, &sources[i])
+		if err != nil {
+			log.Printf("Error while polling import source %s: %v", sources[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func (trackerDb *trackerDb) addImportSource(c echo.Context) error {
+	ctx := context.Background()
+
+	src := new(ImportSource)
+	err := c.Bind(src)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	msg, err := trackerDb.validateImportSource(ctx, src)
+	if err != nil {
+		log.Printf("Error while checking import source: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	src.ID = uuid.Nil
+	src.LastPolledAt = time.Time{}
+	src.LastError = ""
+
+	_, err = trackerDb.db.NewInsert().Model(src).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	src.SecretAccessKey = ""
+
+	return respondCreated(c, "", src)
+}
+
+func (trackerDb *trackerDb) getAllImportSources(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	sources := []ImportSource{}
+	err := trackerDb.db.NewSelect().
+		Model(&sources).
+		ExcludeColumn("secret_access_key").
+		Where("user_id = ?", userID).
+		Order("name").
+		Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting import sources: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, sources)
+}
+
+func (trackerDb *trackerDb) deleteImportSource(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("import_source").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Import source not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// pollImportSourceNow checks a source without waiting for the job.
+func (trackerDb *trackerDb) pollImportSourceNow(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	src := new(ImportSource)
+	err := trackerDb.db.NewSelect().Model(src).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Import source not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch import source: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	release, ok := trackerDb.imports.acquire(strconv.Itoa(src.UserID), concurrencyWait)
+	if !ok {
+		return respondBusy(c, "Too many imports running for this user; try again when one finishes")
+	}
+	defer release()
+
+	n, err := trackerDb.pollImportSource(ctx, src)
+	if err != nil {
+		log.Printf("Error while polling import source: %v", err)
+		return respondError(c, http.StatusBadGateway, err.Error())
+	}
+
+	return respondOK(c, map[string]int{"imported": n})
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the characters AWS leaves
+// alone when signing, and slashes too unless encodeSlash is set.
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// Invoice is a bill sent to a freelance client. Marking it paid books the
+// total as an income item in CategoryID.
+type Invoice struct {
+	bun.BaseModel `bun:"table:invoice,alias:inv"`
+
+	ID           uuid.UUID      `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID       int            `bun:"user_id" json:"user_id"`
+	Client       string         `json:"client"`
+	Number       string         `json:"number"`
+	IssuedOn     Date           `bun:"type:date,nullzero,default:current_date" json:"issued_on"`
+	DueOn        Date           `bun:"type:date,nullzero" json:"due_on"`
+	Status       string         `bun:",nullzero" json:"status"`
+	CategoryID   uuid.UUID      `bun:"type:uuid,nullzero" json:"category_id"`
+	IncomeItemID uuid.UUID      `bun:"type:uuid,nullzero" json:"income_item_id"`
+	CreatedAt    time.Time      `bun:",nullzero,default:now()" json:"created_at"`
+	Lines        []*InvoiceLine `bun:"rel:has-many,join:id=invoice_id" json:"lines"`
+	Total        float64        `bun:"-" json:"total"`
+}
+
+type InvoiceLine struct {
+	bun.BaseModel `bun:"table:invoice_line,alias:il"`
+
+	ID          uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	InvoiceID   uuid.UUID `bun:"type:uuid" json:"invoice_id"`
+	Description string    `json:"description"`
+	Quantity    float64   `json:"quantity"`
+	UnitPrice   float64   `json:"unit_price"`
+}
+
+func (inv *Invoice) computeTotal() {
+	inv.Total = 0
+	for _, line := range inv.Lines {
+		inv.Total += roundMoney(line.Quantity * line.UnitPrice)
+	}
+	inv.Total = roundCash(inv.Total)
+}
+
+func (trackerDb *trackerDb) addInvoice(c echo.Context) error {
+	ctx := context.Background()
+
+	inv := new(Invoice)
+	err := c.Bind(inv)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if len(inv.Lines) == 0 {
+		return respondError(c, http.StatusBadRequest, "An invoice needs at least one line")
+	}
+	inv.ID = uuid.Nil
+	inv.Status = ""
+	inv.IncomeItemID = uuid.Nil
+
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewInsert().Model(inv).Returning("*").Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range inv.Lines {
+			line.ID = uuid.Nil
+			line.InvoiceID = inv.ID
+			if line.Quantity == 0 {
+				line.Quantity = 1
+			}
+		}
+		_, err = tx.NewInsert().Model(&inv.Lines).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error while adding invoice: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	inv.computeTotal()
+
+	return respondCreated(c, apiPath(c, "/invoices/"+inv.ID.String()), inv)
+}
+
+func (trackerDb *trackerDb) getAllInvoices(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	q := trackerDb.db.NewSelect().
+		Model((*Invoice)(nil)).
+		Relation("Lines").
+		Where("inv.user_id = ?", userID).
+		Order("inv.created_at DESC")
+	if status := c.QueryParam("status"); status != "" {
+		q = q.Where("inv.status = ?", status)
+	}
+
+	invoices := []*Invoice{}
+	err := q.Scan(ctx, &invoices)
+	if err != nil {
+		log.Printf("Error while getting invoices: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	for _, inv := range invoices {
+		inv.computeTotal()
+	}
+
+	return respondOK(c, invoices)
+}
+
+func (trackerDb *trackerDb) getInvoice(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	inv := new(Invoice)
+	err := trackerDb.db.NewSelect().Model(inv).Relation("Lines").Where("inv.id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Invoice not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch invoice: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	inv.computeTotal()
+
+	return respondOK(c, inv)
+}
+
+// sendInvoice moves a draft invoice to sent. Delivering it to the client is
+// still up to the user; there is no mail transport in the server.
+func (trackerDb *trackerDb) sendInvoice(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	inv := new(Invoice)
+	err := trackerDb.db.NewUpdate().
+		Model(inv).
+		Set("status = 'sent'").
+		Where("id = ?", id).
+		Where("status = 'draft'").
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "No draft invoice with that id")
+	}
+	if err != nil {
+		log.Printf("Error while sending invoice: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, inv)
+}
+
+// payInvoice marks an invoice paid and records its total as an income item.
+func (trackerDb *trackerDb) payInvoice(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	inv := new(Invoice)
+	var income *Item
+	err := trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(inv).
+			Relation("Lines").
+			Where("inv.id = ?", id).
+			Where("inv.status <> 'paid'").
+			For("UPDATE OF inv").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		inv.computeTotal()
+
+		income = &Item{
+			Name:       fmt.Sprintf("Invoice %s (%s)", inv.Number, inv.Client),
+			Cost:       inv.Total,
+			Type:       "credit",
+			CategoryID: inv.CategoryID,
+			UserID:     inv.UserID,
+			ProfileID:  currentProfile(c),
+		}
+		err = trackerDb.insertItem(ctx, tx, income, c.QueryParam("override_cap") == "true")
+		if err != nil {
+			return err
+		}
+
+		inv.Status = "paid"
+		inv.IncomeItemID = income.ID
+		_, err = tx.NewUpdate().
+			Model(inv).
+			Column("status", "income_item_id").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "No unpaid invoice with that id")
+	}
+	if err != nil {
+		return respondItemError(c, err, "paying invoice")
+	}
+	trackerDb.fireHooks(income.UserID, eventItemCreated, income)
+
+	return respondOK(c, inv)
+}
@@ -0,0 +1,60 @@
+//go:build integration
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestInvoicePay(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v2/invoices", map[string]interface{}{
+		"user_id": userID,
+		"client":  "Acme",
+		"number":  "INV-1",
+		"lines": []map[string]interface{}{
+			{"description": "Design", "quantity": 2, "unit_price": 500.0},
+			{"description": "Hosting", "unit_price": 250.0},
+		},
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var inv Invoice
+	decodeData(t, rec, &inv)
+	if inv.Total != 1250 || inv.Status != "draft" {
+		t.Errorf("created %+v, want a draft totalling 1250", inv)
+	}
+	loc := rec.Header().Get("Location")
+
+	rec = request(t, http.MethodPost, loc+"/pay", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var paid Invoice
+	decodeData(t, rec, &paid)
+	if paid.Status != "paid" || paid.IncomeItemID == uuid.Nil {
+		t.Errorf("paid %+v, want it paid with an income item", paid)
+	}
+
+	items := listTestItems(t, userID)
+	if len(items) != 1 || items[0].ID != paid.IncomeItemID || items[0].Cost != 1250 || items[0].Type != "credit" {
+		t.Errorf("paying the invoice saved %+v, want one credit of 1250", items)
+	}
+
+	// It can't be paid twice.
+	rec = request(t, http.MethodPost, loc+"/pay", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestInvoiceErrors(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v2/invoices", map[string]interface{}{
+		"user_id": userID, "client": "Acme", "number": "INV-1",
+	})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = request(t, http.MethodGet, "/api/v2/invoices/"+uuid.NewString(), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
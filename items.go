@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// The item functions below hold the queries behind the item endpoints so
+// every API version runs the same logic and only maps the results
+// differently. Reads and updates by id are safe to repeat, so they are
+// retried on transient errors. Inserts go through RunInTx, which never
+// repeats a commit that may have gone through.
+
+// ItemsSummary totals every item a list request matched, not just the page
+// returned.
+type ItemsSummary struct {
+	Count   int     `json:"count" bun:"count"`
+	Debits  float64 `json:"debits" bun:"debits"`
+	Credits float64 `json:"credits" bun:"credits"`
+	Net     float64 `json:"net" bun:"-"`
+}
+
+// itemFilter picks the items a list request is about.
+type itemFilter struct {
+	UserID  string
+	Profile uuid.UUID
+	Period  period
+	Pinned  bool
+	// Excluded, when set, keeps only items that are or are not excluded
+	// from analytics.
+	Excluded *bool
+}
+
+// listItems returns the items matching f in statement order, each with its
+// category's name so clients don't have to look categories up. Running
+// balances count every earlier item in the ledger, including those before
+// f.Period, but not scheduled ones. A limit of 0 returns all of them.
+func (trackerDb *trackerDb) listItems(ctx context.Context, f itemFilter, limit, offset int) ([]GetAllItemsRow, ItemsSummary, error) {
+	balances := trackerDb.db.NewSelect().
+		TableExpr("item").
+		ColumnExpr("item.*").
+		ColumnExpr("c.name AS category_name").
+		ColumnExpr("SUM(CASE WHEN scheduled THEN 0 WHEN type = 'credit' THEN cost ELSE -cost END) OVER (ORDER BY item.created_at, item.id) AS running_balance").
+		Join("LEFT JOIN category c ON c.id = item.category_id").
+		Where("user_id = ?", f.UserID).
+		Apply(inProfile(f.Profile))
+	q := trackerDb.db.NewSelect().
+		TableExpr("(?) AS item", balances).
+		ColumnExpr("*").
+		OrderExpr("created_at, id")
+	q = f.Period.where(q, "created_at")
+	if f.Pinned {
+		q = q.Where("pinned")
+	}
+	if f.Excluded != nil {
+		q = q.Where("excluded = ?", *f.Excluded)
+	}
+	if limit != 0 {
+		q = q.Limit(limit).Offset(offset)
+	}
+
+	items := []GetAllItemsRow{}
+	err := retry(ctx, func() error { return q.Scan(ctx, &items) })
+	if err != nil {
+		return nil, ItemsSummary{}, err
+	}
+
+	var summary ItemsSummary
+	sq := trackerDb.db.NewSelect().
+		TableExpr("item").
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'debit'), 0) AS debits").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'credit'), 0) AS credits").
+		Where("user_id = ?", f.UserID).
+		Apply(inProfile(f.Profile))
+	sq = f.Period.where(sq, "created_at")
+	if f.Pinned {
+		sq = sq.Where("pinned")
+	}
+	if f.Excluded != nil {
+		sq = sq.Where("excluded = ?", *f.Excluded)
+	}
+	err = retry(ctx, func() error { return sq.Scan(ctx, &summary) })
+	summary.Debits = roundMoney(summary.Debits)
+	summary.Credits = roundMoney(summary.Credits)
+	summary.Net = roundMoney(summary.Credits - summary.Debits)
+	return items, summary, err
+}
+
+// findItem returns sql.ErrNoRows when there is no item with that id.
+func (trackerDb *trackerDb) findItem(ctx context.Context, id string) (GetItem, error) {
+	var item GetItem
+	err := retry(ctx, func() error {
+		return trackerDb.db.NewSelect().TableExpr("item").Where("id = ?", id).Scan(ctx, &item)
+	})
+	return item, err
+}
+
+// createItem fills in derived fields, saves the item and tells the user's
+// hooks about it. Items dated in the future are saved as scheduled. It
+// fails with a *QuotaExceeded if the user has used up their item quota
+// and, unless overrideCap is set, with a *CapExceeded if the item would
+// break its category's hard cap.
+func (trackerDb *trackerDb) createItem(ctx context.Context, item *Item, overrideCap bool) error {
+	err := trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return trackerDb.insertItem(ctx, tx, item, overrideCap)
+	})
+	if err != nil {
+		return err
+	}
+	trackerDb.fireHooks(item.UserID, eventItemCreated, item)
+	return nil
+}
+
+// insertItem is createItem inside the caller's transaction, for handlers
+// that make other changes along with the item. The caller fires the hooks
+// once the transaction commits. It also fails with an invalidItem if the
+// item is in a profile that isn't its user's.
+func (trackerDb *trackerDb) insertItem(ctx context.Context, tx bun.Tx, item *Item, overrideCap bool) error {
+	item.Cost = roundMoney(item.Cost)
+	if item.TaxRate != 0 && item.TaxAmount == 0 {
+		item.TaxAmount = roundMoney(item.Cost * item.TaxRate / (100 + item.TaxRate))
+	}
+	item.Scheduled = item.CreatedAt.After(time.Now())
+
+	err := checkItemProfile(ctx, tx, item)
+	if err != nil {
+		return err
+	}
+	err = checkQuota(ctx, tx, "item", "items", item.UserID, trackerDb.env.ItemQuota)
+	if err != nil {
+		return err
+	}
+	if !overrideCap {
+		err = checkCap(ctx, tx, item)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.NewInsert().Model(item).Returning("*").Exec(ctx)
+	return err
+}
+
+// itemSource creates an item from something else, like copyItem and
+// itemFromTemplate do.
+type itemSource func(ctx context.Context, id string, at time.Time, cost float64, overrideCap bool) (*Item, error)
+
+// copyItem creates a copy of an item, dated at and costing cost when
+// those are not zero. Bookkeeping that belongs to the original, like its
+// status, claim and invoice number, is not copied. It returns sql.ErrNoRows
+// when there is no item with that id, and otherwise fails like createItem.
+func (trackerDb *trackerDb) copyItem(ctx context.Context, id string, at time.Time, cost float64, overrideCap bool) (*Item, error) {
+	orig, err := trackerDb.findItem(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &Item{
+		Name:         orig.Name,
+		DisplayName:  orig.DisplayName,
+		Cost:         orig.Cost,
+		Type:         orig.Type,
+		CategoryID:   orig.CategoryID,
+		UserID:       orig.UserID,
+		CreatedAt:    at,
+		Reimbursable: orig.Reimbursable,
+		TaxRate:      orig.TaxRate,
+		TaxAmount:    orig.TaxAmount,
+		VendorTaxID:  orig.VendorTaxID,
+		LoanID:       orig.LoanID.UUID,
+		ProfileID:    orig.ProfileID.UUID,
+		CardID:       orig.CardID.UUID,
+		Excluded:     orig.Excluded,
+	}
+	if cost != 0 && cost != orig.Cost {
+		item.Cost = cost
+		item.TaxAmount = 0
+	}
+
+	err = trackerDb.createItem(ctx, item, overrideCap)
+	return item, err
+}
+
+// deriveItemFields adds what follows from an update's fields to it: the
+// cost is rounded like a new item's, and moving the item's date
+// reschedules it, or makes it a normal item if the new date has passed.
+func deriveItemFields(fields map[string]interface{}) {
+	if cost, ok := fields["cost"].(float64); ok {
+		fields["cost"] = roundMoney(cost)
+	}
+	if at, ok := fields["created_at"]; ok {
+		fields["scheduled"] = bun.SafeQuery("COALESCE(?::timestamp > now(), false)", at)
+	}
+}
+
+// updateItemFields sets the given columns on an item and returns the
+// result, or sql.ErrNoRows when there is no item with that id. Fields are
+// derived as in deriveItemFields.
+func (trackerDb *trackerDb) updateItemFields(ctx context.Context, id interface{}, fields map[string]interface{}) (GetItem, error) {
+	deriveItemFields(fields)
+
+	var item GetItem
+	err := retry(ctx, func() error {
+		return trackerDb.db.NewUpdate().
+			Model(&fields).
+			TableExpr("item").
+			Where("id = ?", id).
+			Returning("*").
+			Scan(ctx, &item)
+	})
+	return item, err
+}
+
+// invalidItem is a message for the client about why an item can't be
+// saved as it is.
+type invalidItem string
+
+func (e invalidItem) Error() string { return string(e) }
+
+// respondItemError answers a failed item create or update: 400 for an
+// invalidItem, 409 with the overage for a *CapExceeded, 403 for a
+// *QuotaExceeded and otherwise 500, logging err as failing while action.
+func respondItemError(c echo.Context, err error, action string) error {
+	var invalid invalidItem
+	if errors.As(err, &invalid) {
+		return respondError(c, http.StatusBadRequest, invalid.Error())
+	}
+	var exceeded *CapExceeded
+	if errors.As(err, &exceeded) {
+		return c.JSON(http.StatusConflict, Envelope{Message: exceeded.Error(), Data: exceeded})
+	}
+	var quota *QuotaExceeded
+	if errors.As(err, &quota) {
+		return c.JSON(http.StatusForbidden, Envelope{Message: quota.Error(), Data: quota})
+	}
+	log.Printf("Error while %s: %+v", action, err)
+	return respondError(c, http.StatusInternalServerError, "Internal server error")
+}
+
+// checkItemProfile returns an invalidItem if the item is in a profile that
+// isn't its user's.
+func checkItemProfile(ctx context.Context, db bun.IDB, item *Item) error {
+	if item.ProfileID == uuid.Nil {
+		return nil
+	}
+	owned, err := ownsProfile(ctx, db, item.UserID, item.ProfileID)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return invalidItem("profile_id is not one of the user's profiles")
+	}
+	return nil
+}
+
+// editItem sets the given columns on an item like updateItemFields, but
+// only keeps the change if the result is an item createItem would have
+// saved: it must pass Item.validate, belong to a profile of the item's
+// user and, unless overrideCap is set, stay within its category's hard
+// cap. It fails with an invalidItem or a *CapExceeded when it doesn't.
+func (trackerDb *trackerDb) editItem(ctx context.Context, id string, fields map[string]interface{}, overrideCap bool) (*Item, error) {
+	deriveItemFields(fields)
+	if status, ok := fields["status"]; ok {
+		if s, _ := status.(string); !validItemStatus(s) {
+			return nil, invalidItem(invalidStatusMsg)
+		}
+	}
+
+	item := new(Item)
+	err := trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewUpdate().
+			Model(&fields).
+			TableExpr("item").
+			Where("id = ?", id).
+			Returning("*").
+			Scan(ctx, item)
+		if err != nil {
+			return err
+		}
+		if msg := item.validate(); msg != "" {
+			return invalidItem(msg)
+		}
+		err = checkItemProfile(ctx, tx, item)
+		if err != nil {
+			return err
+		}
+		if overrideCap {
+			return nil
+		}
+		return checkCap(ctx, tx, item)
+	})
+	return item, err
+}
+
+// removeItem reports whether an item was deleted.
+func (trackerDb *trackerDb) removeItem(ctx context.Context, id string) (bool, error) {
+	var n int64
+	err := retry(ctx, func() error {
+		res, err := trackerDb.db.NewDelete().TableExpr("item").Where("id = ?", id).Exec(ctx)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n > 0, err
+}
+
+// promoteScheduledItems turns scheduled items whose date has come into
+// normal items, so they start counting towards balances.
+func (trackerDb *trackerDb) promoteScheduledItems(ctx context.Context, now time.Time) error {
+	return retry(ctx, func() error {
+		_, err := trackerDb.db.NewUpdate().
+			TableExpr("item").
+			Set("scheduled = false").
+			Where("scheduled").
+			Where("created_at <= ?", now).
+			Exec(ctx)
+		return err
+	})
+}
@@ -0,0 +1,153 @@
+//go:build integration
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestItemV2CRUD(t *testing.T) {
+	userID := newTestUser(t)
+
+	item := createTestItem(t, userID, map[string]interface{}{"name": "Groceries", "cost": 450.5})
+	if item.Name != "Groceries" || item.Cost != 450.5 || item.UserID != userID {
+		t.Fatalf("created %+v", item)
+	}
+	path := "/api/v2/items/" + item.ID.String()
+
+	rec := request(t, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var got ItemV2
+	decodeData(t, rec, &got)
+	if got.ID != item.ID || got.Cost != 450.5 {
+		t.Errorf("got %+v, want %+v", got, item)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/items?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var list []ItemV2
+	decodeData(t, rec, &list)
+	if len(list) != 1 || list[0].ID != item.ID {
+		t.Errorf("listed %+v, want just %s", list, item.ID)
+	}
+
+	rec = request(t, http.MethodPatch, path, map[string]interface{}{"name": "Vegetables", "cost": 300})
+	expectStatus(t, rec, http.StatusOK)
+	decodeData(t, rec, &got)
+	if got.Name != "Vegetables" || got.Cost != 300 {
+		t.Errorf("updated to %+v", got)
+	}
+
+	rec = request(t, http.MethodPatch, path, map[string]interface{}{"type": "refund"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = request(t, http.MethodPatch, path, map[string]interface{}{"cost": -5})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = request(t, http.MethodPatch, path, map[string]interface{}{"colour": "red"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = request(t, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decodeData(t, rec, &got)
+	if got.Type != "debit" || got.Cost != 300 {
+		t.Errorf("a rejected update changed the item to %+v", got)
+	}
+
+	rec = request(t, http.MethodDelete, path, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = request(t, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = request(t, http.MethodDelete, path, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestItemV2CreateValidation(t *testing.T) {
+	userID := newTestUser(t)
+
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+	}{
+		{"no name", map[string]interface{}{"name": ""}},
+		{"zero cost", map[string]interface{}{"cost": 0}},
+		{"negative cost", map[string]interface{}{"cost": -10}},
+		{"unknown type", map[string]interface{}{"type": "refund"}},
+		{"unknown status", map[string]interface{}{"status": "void"}},
+		{"bad latitude", map[string]interface{}{"location": map[string]interface{}{"latitude": 91, "longitude": 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]interface{}{"name": "Coffee", "cost": 120, "type": "debit", "user_id": userID}
+			for k, v := range tt.fields {
+				body[k] = v
+			}
+			rec := request(t, http.MethodPost, "/api/v2/items", body)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+
+	rec := request(t, http.MethodGet, fmt.Sprintf("/api/v2/items?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var list []ItemV2
+	decodeData(t, rec, &list)
+	if len(list) != 0 {
+		t.Errorf("invalid items were saved: %+v", list)
+	}
+}
+
+func TestItemV1CRUD(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v1/item", map[string]interface{}{
+		"name":      "Salary",
+		"cost":      50000,
+		"type":      "credit",
+		"user_id":   userID,
+		"createdAt": time.Now().UTC().Add(-time.Hour),
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var item Item
+	decodeData(t, rec, &item)
+	if item.Name != "Salary" || item.Type != "credit" {
+		t.Fatalf("created %+v", item)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/api/v1/items/"+item.ID.String() {
+		t.Errorf("Location is %q", loc)
+	}
+	path := "/api/v1/items/" + item.ID.String()
+
+	rec = request(t, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var got Item
+	decodeData(t, rec, &got)
+	if got.ID != item.ID || got.Cost != 50000 {
+		t.Errorf("got %+v, want %+v", got, item)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v1/items?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var list []Item
+	decodeData(t, rec, &list)
+	if len(list) != 1 || list[0].ID != item.ID {
+		t.Errorf("listed %+v, want just %s", list, item.ID)
+	}
+
+	rec = request(t, http.MethodPatch, "/api/v1/update/item", map[string]interface{}{
+		"id":   item.ID.String(),
+		"cost": 52000,
+	})
+	expectStatus(t, rec, http.StatusOK)
+	rec = request(t, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decodeData(t, rec, &got)
+	if got.Cost != 52000 {
+		t.Errorf("cost is %v after the update, want 52000", got.Cost)
+	}
+
+	rec = request(t, http.MethodDelete, path, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = request(t, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
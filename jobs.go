@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// jobRunKeep is how long job_run rows are kept, to see when jobs ran and
+// why they failed. Their slots are long past, so forgetting them can't let
+// a job run twice.
+const jobRunKeep = 30 * 24 * time.Hour
+
+// runDaily calls fn in the background once a day, just after midnight UTC,
+// with the day that has just ended.
+func (trackerDb *trackerDb) runDaily(name string, fn func(ctx context.Context, day time.Time) error) {
+	go func() {
+		for {
+			next := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			time.Sleep(time.Until(next))
+
+			day := next.AddDate(0, 0, -1)
+			trackerDb.runOnce(name, day, func(ctx context.Context) error { return fn(ctx, day) })
+		}
+	}()
+}
+
+// runHourly calls fn in the background at the start of every hour (UTC)
+// with that hour.
+func (trackerDb *trackerDb) runHourly(name string, fn func(ctx context.Context, hour time.Time) error) {
+	go func() {
+		for {
+			next := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+			time.Sleep(time.Until(next))
+
+			trackerDb.runOnce(name, next, func(ctx context.Context) error { return fn(ctx, next) })
+		}
+	}()
+}
+
+// runOnce runs a job for one slot, such as a day or an hour, unless another
+// replica has already claimed that slot. Every replica schedules every job;
+// the first to insert the slot's job_run row runs it and the others skip.
+// A replica that dies mid-run leaves the slot claimed, so a job may be
+// missed but is never run twice. A job that panics is recorded as failed.
+func (trackerDb *trackerDb) runOnce(name string, slot time.Time, fn func(ctx context.Context) error) {
+	ctx := context.Background()
+
+	res, err := trackerDb.db.NewRaw(
+		"INSERT INTO job_run (job, slot) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		name, slot,
+	).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while claiming job %s: %+v", name, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	err = func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Job %s panicked: %v\n%s", name, r, debug.Stack())
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return fn(ctx)
+	}()
+	if err != nil {
+		log.Printf("Error while running job %s: %+v", name, err)
+	}
+
+	var msg *string
+	if err != nil {
+		s := err.Error()
+		msg = &s
+	}
+	_, err = trackerDb.db.NewRaw(
+		"UPDATE job_run SET finished_at = now(), error = ? WHERE job = ? AND slot = ?",
+		msg, name, slot,
+	).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while recording job %s: %+v", name, err)
+	}
+}
+
+// pruneJobRuns is the daily job that forgets job runs older than
+// jobRunKeep.
+func (trackerDb *trackerDb) pruneJobRuns(ctx context.Context, day time.Time) error {
+	_, err := trackerDb.db.NewDelete().
+		TableExpr("job_run").
+		Where("slot < ?", day.Add(-jobRunKeep)).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// Loan is money lent to or borrowed from someone. Items whose loan_id points
+// at it are the repayments.
+type Loan struct {
+	bun.BaseModel `bun:"table:loan,alias:l"`
+
+	ID           uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID       int       `bun:"user_id" json:"user_id"`
+	Counterparty string    `json:"counterparty"`
+	Direction    string    `json:"direction"`
+	Amount       float64   `json:"amount"`
+	DueOn        Date      `bun:"type:date,nullzero" json:"due_on"`
+	CreatedAt    time.Time `bun:",nullzero,default:now()" json:"created_at"`
+	Repaid       float64   `bun:",scanonly" json:"repaid"`
+	Outstanding  float64   `bun:",scanonly" json:"outstanding"`
+}
+
+func selectLoans(db bun.IDB) *bun.SelectQuery {
+	return db.NewSelect().
+		ColumnExpr("l.*").
+		ColumnExpr("COALESCE(SUM(i.cost), 0) AS repaid").
+		ColumnExpr("l.amount - COALESCE(SUM(i.cost), 0) AS outstanding").
+		TableExpr("loan AS l").
+		Join("LEFT JOIN item i ON i.loan_id = l.id").
+		Group("l.id")
+}
+
+func (trackerDb *trackerDb) addLoan(c echo.Context) error {
+	ctx := context.Background()
+
+	loan := new(Loan)
+	err := c.Bind(loan)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if loan.Direction != "lent" && loan.Direction != "borrowed" {
+		return respondError(c, http.StatusBadRequest, "direction must be lent or borrowed")
+	}
+	loan.ID = uuid.Nil
+
+	_, err = trackerDb.db.NewInsert().Model(loan).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	loan.Outstanding = loan.Amount
+
+	return respondCreated(c, apiPath(c, "/loans/"+loan.ID.String()), loan)
+}
+
+func (trackerDb *trackerDb) getLoan(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	var loan Loan
+	err := selectLoans(trackerDb.db).Where("l.id = ?", id).Scan(ctx, &loan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Loan not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch loan: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, loan)
+}
+
+func (trackerDb *trackerDb) getAllLoans(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	loans := []Loan{}
+	err := selectLoans(trackerDb.db).
+		Where("l.user_id = ?", userID).
+		Order("l.created_at DESC").
+		Scan(ctx, &loans)
+	if err != nil {
+		log.Printf("Error while getting loans: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, loans)
+}
+
+type ReceivableRow struct {
+	Counterparty string  `bun:"counterparty" json:"counterparty"`
+	Owed         float64 `bun:"owed" json:"owed"`
+	Owing        float64 `bun:"owing" json:"owing"`
+	Net          float64 `bun:"-" json:"net"`
+	NextDueOn    Date    `bun:"next_due_on" json:"next_due_on"`
+	Overdue      bool    `bun:"-" json:"overdue"`
+}
+
+// getReceivables sums outstanding loans per counterparty: what they owe the
+// user, what the user owes them, and the earliest due date still open.
+func (trackerDb *trackerDb) getReceivables(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	rows := []ReceivableRow{}
+	err := trackerDb.db.NewSelect().
+		With("loans", selectLoans(trackerDb.db).Where("l.user_id = ?", userID)).
+		ColumnExpr("counterparty").
+		ColumnExpr("COALESCE(SUM(outstanding) FILTER (WHERE direction = 'lent'), 0) AS owed").
+		ColumnExpr("COALESCE(SUM(outstanding) FILTER (WHERE direction = 'borrowed'), 0) AS owing").
+		ColumnExpr("MIN(due_on) AS next_due_on").
+		TableExpr("loans").
+		Where("outstanding > 0.005").
+		Group("counterparty").
+		Order("counterparty").
+		Scan(ctx, &rows)
+	if err != nil {
+		log.Printf("Error while getting receivables: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	t := today()
+	for i := range rows {
+		rows[i].Net = rows[i].Owed - rows[i].Owing
+		rows[i].Overdue = !rows[i].NextDueOn.IsZero() && rows[i].NextDueOn.Before(t)
+	}
+
+	return respondOK(c, rows)
+}
+
+// loanRemindDays are how many days before a loan's due date users are
+// reminded of what is still outstanding on it.
+var loanRemindDays = []int{3, 0}
+
+// remindLoans is the daily job that tells users when a loan with something
+// outstanding falls due in one of loanRemindDays days.
+func (trackerDb *trackerDb) remindLoans(ctx context.Context, day time.Time) error {
+	loans := []Loan{}
+	err := selectLoans(trackerDb.db).
+		Where("l.due_on IN (?)", bun.In(remindDates(day, loanRemindDays))).
+		Having("l.amount - COALESCE(SUM(i.cost), 0) > 0.005").
+		Scan(ctx, &loans)
+	if err != nil {
+		return err
+	}
+
+	for _, loan := range loans {
+		money, err := trackerDb.moneyFormat(ctx, loan.UserID)
+		if err != nil {
+			return err
+		}
+		when := "today"
+		if loan.DueOn.After(day) {
+			when = "on " + loan.DueOn.Format("2 Jan")
+		}
+		what := fmt.Sprintf("%s owes you %s", loan.Counterparty, money.format(loan.Outstanding))
+		if loan.Direction == "borrowed" {
+			what = fmt.Sprintf("You owe %s %s", loan.Counterparty, money.format(loan.Outstanding))
+		}
+		err = trackerDb.notify(ctx, loan.UserID, fmt.Sprintf("%s, due %s", what, when))
+		if err != nil {
+			log.Printf("Error while reminding user %d about loan %s: %+v", loan.UserID, loan.ID, err)
+		}
+	}
+	return nil
+}
+
+// remindDates are the dates that fall the given numbers of days after day.
+func remindDates(day time.Time, days []int) []time.Time {
+	dates := make([]time.Time, len(days))
+	for i, d := range days {
+		dates[i] = day.AddDate(0, 0, d)
+	}
+	return dates
+}
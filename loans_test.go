@@ -0,0 +1,56 @@
+//go:build integration
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLoanRepayment(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v2/loans", map[string]interface{}{
+		"user_id": userID, "counterparty": "Asha", "direction": "lent", "amount": 1000.0,
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var loan Loan
+	decodeData(t, rec, &loan)
+	loc := rec.Header().Get("Location")
+	if loc != "/api/v2/loans/"+loan.ID.String() {
+		t.Errorf("Location is %q", loc)
+	}
+
+	createTestItem(t, userID, map[string]interface{}{"name": "Asha repaid", "cost": 400.0, "type": "credit", "loan_id": loan.ID})
+
+	rec = request(t, http.MethodGet, loc, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var got Loan
+	decodeData(t, rec, &got)
+	if got.Repaid != 400 || got.Outstanding != 600 {
+		t.Errorf("loan is %+v, want 400 repaid and 600 outstanding", got)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/receivables?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var rows []ReceivableRow
+	decodeData(t, rec, &rows)
+	if len(rows) != 1 || rows[0].Counterparty != "Asha" || rows[0].Net != 600 {
+		t.Errorf("receivables are %+v, want Asha owing 600", rows)
+	}
+}
+
+func TestLoanErrors(t *testing.T) {
+	userID := newTestUser(t)
+
+	rec := request(t, http.MethodPost, "/api/v2/loans", map[string]interface{}{
+		"user_id": userID, "counterparty": "Asha", "direction": "gifted", "amount": 1000.0,
+	})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = request(t, http.MethodGet, "/api/v2/loans/"+uuid.NewString(), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
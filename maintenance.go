@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo"
+)
+
+const defaultMaintenanceMessage = "The tracker is undergoing maintenance. Changes are paused; try again in a few minutes."
+
+// maintenanceMode is switched on by an admin while migrations or backups
+// run. Writes are refused with 503 in the meantime; reads keep working.
+type maintenanceMode struct {
+	mu      sync.RWMutex
+	enabled bool
+	message string
+}
+
+type MaintenanceStatus struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+func (m *maintenanceMode) status() MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return MaintenanceStatus{Enabled: m.enabled, Message: m.message}
+}
+
+func (m *maintenanceMode) set(s MaintenanceStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = s.Enabled
+	m.message = s.Message
+	if m.message == "" {
+		m.message = defaultMaintenanceMessage
+	}
+}
+
+// middleware refuses requests that can change data while maintenance is on.
+// The maintenance endpoint itself stays open so it can be switched off.
+func (m *maintenanceMode) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if strings.HasSuffix(c.Path(), "/admin/maintenance") {
+			return next(c)
+		}
+
+		s := m.status()
+		if !s.Enabled {
+			return next(c)
+		}
+		c.Response().Header().Set("Retry-After", "300")
+		return c.JSON(http.StatusServiceUnavailable, Envelope{Message: localize(c, s.Message), Data: s})
+	}
+}
+
+func (trackerDb *trackerDb) getMaintenance(c echo.Context) error {
+	return respondOK(c, trackerDb.maintenance.status())
+}
+
+// setMaintenance switches maintenance mode on or off. Only admins may call
+// it under the default policy.
+func (trackerDb *trackerDb) setMaintenance(c echo.Context) error {
+	s := new(MaintenanceStatus)
+	err := c.Bind(s)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	trackerDb.maintenance.set(*s)
+	log.Printf("Maintenance mode enabled: %v", s.Enabled)
+
+	return respondOK(c, trackerDb.maintenance.status())
+}
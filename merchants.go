@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// MerchantRule maps raw merchant names starting with Pattern, a merchantKey,
+// to a display name and category. Rules are learned from user corrections.
+type MerchantRule struct {
+	bun.BaseModel `bun:"table:merchant_rule,alias:mr"`
+
+	ID          uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID      int       `bun:"user_id" json:"user_id"`
+	Pattern     string    `json:"pattern"`
+	DisplayName string    `json:"display_name"`
+	CategoryID  uuid.UUID `bun:"type:uuid,nullzero" json:"category_id"`
+	CreatedAt   time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// builtinMerchants covers common prefixes before a user has taught any rules.
+var builtinMerchants = []struct {
+	prefix string
+	name   string
+}{
+	{"AMZN", "Amazon"},
+	{"AMAZON", "Amazon"},
+	{"FLIPKART", "Flipkart"},
+	{"SWIGGY", "Swiggy"},
+	{"ZOMATO", "Zomato"},
+	{"UBER", "Uber"},
+	{"OLA", "Ola"},
+	{"NETFLIX", "Netflix"},
+	{"SPOTIFY", "Spotify"},
+	{"GOOGLE", "Google"},
+	{"APPLE COM", "Apple"},
+	{"BIGBASKET", "BigBasket"},
+}
+
+var enrichmentClient = newOutboundClient(5 * time.Second)
+
+// merchantKey normalizes a raw name for matching: upper case, reference
+// codes after '*' dropped, everything but letters turned into single spaces.
+// "AMZN MKTP IN*2A3B" becomes "AMZN MKTP IN".
+func merchantKey(raw string) string {
+	raw, _, _ = strings.Cut(strings.ToUpper(raw), "*")
+	return strings.Join(strings.FieldsFunc(raw, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}), " ")
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+type merchantMatch struct {
+	DisplayName string
+	CategoryID  uuid.UUID
+}
+
+// enrichMerchant finds a display name and category hint for a raw merchant
+// name. The user's own rules win, then the built-in list, then the external
+// enrichment service if configured; otherwise the key is title-cased.
+func (trackerDb *trackerDb) enrichMerchant(ctx context.Context, userID int, raw string) (merchantMatch, error) {
+	key := merchantKey(raw)
+	if key == "" {
+		return merchantMatch{DisplayName: raw}, nil
+	}
+
+	var rule MerchantRule
+	err := trackerDb.db.NewSelect().
+		Model(&rule).
+		Where("user_id = ?", userID).
+		Where("? LIKE pattern || '%'", key).
+		OrderExpr("length(pattern) DESC").
+		Limit(1).
+		Scan(ctx)
+	if err == nil {
+		return merchantMatch{DisplayName: rule.DisplayName, CategoryID: rule.CategoryID}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return merchantMatch{}, err
+	}
+
+	for _, b := range builtinMerchants {
+		if strings.HasPrefix(key, b.prefix) {
+			return merchantMatch{DisplayName: b.name}, nil
+		}
+	}
+
+	if trackerDb.env.EnrichmentURL != "" {
+		m, err := trackerDb.lookupMerchant(ctx, raw)
+		if err == nil && m.DisplayName != "" {
+			return m, nil
+		}
+		if err != nil {
+			log.Printf("Error while calling enrichment service: %v", err)
+		}
+	}
+
+	return merchantMatch{DisplayName: titleCase(key)}, nil
+}
+
+func (trackerDb *trackerDb) lookupMerchant(ctx context.Context, raw string) (merchantMatch, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, trackerDb.env.EnrichmentURL+"?q="+url.QueryEscape(raw), nil)
+	if err != nil {
+		return merchantMatch{}, err
+	}
+	res, err := enrichmentClient.Do(req)
+	if err != nil {
+		return merchantMatch{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return merchantMatch{}, errors.New("enrichment service returned " + res.Status)
+	}
+
+	var out struct {
+		Name     string `json:"name"`
+		Category string `json:"category"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return merchantMatch{}, err
+	}
+
+	m := merchantMatch{DisplayName: out.Name}
+	if out.Category != "" {
+		m.CategoryID, err = trackerDb.categoryByName(ctx, out.Category)
+		if err != nil {
+			return merchantMatch{}, err
+		}
+	}
+	return m, nil
+}
+
+// categoryByName finds a category by name, ignoring case. It returns
+// uuid.Nil if there is none.
+func (trackerDb *trackerDb) categoryByName(ctx context.Context, name string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := trackerDb.db.NewSelect().
+		Column("id").
+		TableExpr("category").
+		Where("lower(name) = lower(?)", name).
+		Limit(1).
+		Scan(ctx, &id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, nil
+	}
+	return id, err
+}
+
+type CorrectMerchantRequest struct {
+	DisplayName string    `json:"display_name"`
+	CategoryID  uuid.UUID `json:"category_id"`
+}
+
+// correctMerchant fixes an item's display name (and category, if given) and
+// remembers the fix as a rule for future items from the same merchant.
+func (trackerDb *trackerDb) correctMerchant(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	req := new(CorrectMerchantRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if req.DisplayName == "" {
+		return respondError(c, http.StatusBadRequest, "display_name is required")
+	}
+
+	var item GetItem
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := tx.NewUpdate().
+			TableExpr("item").
+			Set("display_name = ?", req.DisplayName).
+			Where("id = ?", id).
+			Returning("*")
+		if req.CategoryID != uuid.Nil {
+			q = q.Set("category_id = ?", req.CategoryID)
+		}
+		err := q.Scan(ctx, &item)
+		if err != nil {
+			return err
+		}
+
+		key := merchantKey(item.Name)
+		if key == "" {
+			return nil
+		}
+		rule := &MerchantRule{
+			UserID:      item.UserID,
+			Pattern:     key,
+			DisplayName: req.DisplayName,
+			CategoryID:  req.CategoryID,
+		}
+		_, err = tx.NewInsert().
+			Model(rule).
+			On("CONFLICT (user_id, pattern) DO UPDATE").
+			Set("display_name = EXCLUDED.display_name").
+			Set("category_id = COALESCE(EXCLUDED.category_id, mr.category_id)").
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Item not found")
+	}
+	if err != nil {
+		log.Printf("Error while correcting merchant: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, item)
+}
+
+func (trackerDb *trackerDb) getAllMerchantRules(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	rules := []MerchantRule{}
+	err := trackerDb.db.NewSelect().Model(&rules).Where("user_id = ?", userID).Order("pattern").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting merchant rules: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, rules)
+}
+
+func (trackerDb *trackerDb) deleteMerchantRule(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("merchant_rule").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Merchant rule not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
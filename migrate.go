@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"log"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+//go:embed migrations/*.sql
+var sqlMigrations embed.FS
+
+// migrateDb applies any pending SQL migrations from the migrations directory.
+func migrateDb(db *bun.DB) {
+	ctx := context.Background()
+
+	migrations := migrate.NewMigrations()
+	err := migrations.Discover(sqlMigrations)
+	if err != nil {
+		log.Fatal("Can't load migrations: ", err)
+	}
+
+	migrator := migrate.NewMigrator(db, migrations)
+	err = migrator.Init(ctx)
+	if err != nil {
+		log.Fatal("Can't create migration tables: ", err)
+	}
+
+	err = migrator.Lock(ctx)
+	if err != nil {
+		log.Fatal("Can't lock migrations: ", err)
+	}
+	defer migrator.Unlock(ctx)
+
+	group, err := migrator.Migrate(ctx)
+	if err != nil {
+		log.Fatal("Migration failed: ", err)
+	}
+
+	if group.IsZero() {
+		log.Println("No new migrations to run")
+	} else {
+		log.Printf("Migrated to %s", group)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+func TestMigrationsApplied(t *testing.T) {
+	ctx := context.Background()
+
+	migrations := migrate.NewMigrations()
+	err := migrations.Discover(sqlMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := migrate.NewMigrator(testTracker.db, migrations)
+
+	missing, err := migrator.MissingMigrations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) > 0 {
+		t.Errorf("migrations not applied: %s", missing)
+	}
+
+	// Running them again must find nothing to do.
+	group, err := migrator.Migrate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !group.IsZero() {
+		t.Errorf("migrating again applied %s", group)
+	}
+}
+
+// TestModelsMatchSchema runs the startup schema check and selects every
+// model from its table, either of which fails if a model maps a table or
+// column the migrations don't create.
+func TestModelsMatchSchema(t *testing.T) {
+	ctx := context.Background()
+
+	err := checkSchema(testTracker.db)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, m := range models {
+		model := reflect.New(reflect.TypeOf(m).Elem()).Interface()
+		t.Run(reflect.TypeOf(m).Elem().Name(), func(t *testing.T) {
+			err := testTracker.db.NewSelect().Model(model).Limit(1).Scan(ctx)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// driftedItem maps a column no migration creates.
+type driftedItem struct {
+	bun.BaseModel `bun:"table:item"`
+
+	ID    uuid.UUID `bun:",pk"`
+	Color string
+}
+
+func TestCheckSchemaFailsOnDrift(t *testing.T) {
+	defer func(m []interface{}) { models = m }(models)
+	models = append(models, (*driftedItem)(nil))
+
+	err := checkSchema(testTracker.db)
+	if err == nil {
+		t.Error("checkSchema passed a model with a column the database doesn't have")
+	}
+}
+
+func TestItemRelations(t *testing.T) {
+	ctx := context.Background()
+	userID := newTestUser(t)
+	created := createTestItem(t, userID, nil)
+
+	item := new(Item)
+	err := testTracker.db.NewSelect().
+		Model(item).
+		Relation("User").
+		Relation("Category").
+		Where("i.id = ?", created.ID).
+		Scan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.User == nil || item.User.LegacyID != userID {
+		t.Errorf("item's user is %+v, want the one with legacy id %d", item.User, userID)
+	}
+}
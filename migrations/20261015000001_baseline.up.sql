@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS category (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS item (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL,
+    cost double precision NOT NULL,
+    type text NOT NULL,
+    category_id uuid REFERENCES category (id),
+    user_id integer NOT NULL,
+    "createdAt" timestamp NOT NULL DEFAULT now()
+);
@@ -0,0 +1,8 @@
+-- Existing items predate status tracking and are treated as cleared; new
+-- items start out pending.
+ALTER TABLE item ADD COLUMN status text NOT NULL DEFAULT 'cleared'
+    CHECK (status IN ('pending', 'cleared', 'reconciled'));
+
+--bun:split
+
+ALTER TABLE item ALTER COLUMN status SET DEFAULT 'pending';
@@ -0,0 +1,6 @@
+CREATE TABLE balance_snapshot (
+    user_id integer NOT NULL,
+    taken_on date NOT NULL,
+    balance double precision NOT NULL,
+    PRIMARY KEY (user_id, taken_on)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE item ADD COLUMN adjustment boolean NOT NULL DEFAULT false;
+
+--bun:split
+
+-- Adjustments are not spending in any category.
+ALTER TABLE item ALTER COLUMN category_id DROP NOT NULL;
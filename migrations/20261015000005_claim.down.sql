@@ -0,0 +1,8 @@
+ALTER TABLE item
+    DROP COLUMN reimbursable,
+    DROP COLUMN claim_id,
+    DROP COLUMN reimbursed;
+
+--bun:split
+
+DROP TABLE IF EXISTS claim;
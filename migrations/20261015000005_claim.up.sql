@@ -0,0 +1,15 @@
+CREATE TABLE claim (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    status text NOT NULL DEFAULT 'submitted' CHECK (status IN ('submitted', 'paid')),
+    reimbursement_item_id uuid REFERENCES item (id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+ALTER TABLE item
+    ADD COLUMN reimbursable boolean NOT NULL DEFAULT false,
+    ADD COLUMN claim_id uuid REFERENCES claim (id) ON DELETE SET NULL,
+    ADD COLUMN reimbursed boolean NOT NULL DEFAULT false;
@@ -0,0 +1,5 @@
+ALTER TABLE item
+    DROP COLUMN tax_rate,
+    DROP COLUMN tax_amount,
+    DROP COLUMN vendor_tax_id,
+    DROP COLUMN invoice_number;
@@ -0,0 +1,5 @@
+ALTER TABLE item
+    ADD COLUMN tax_rate double precision,
+    ADD COLUMN tax_amount double precision,
+    ADD COLUMN vendor_tax_id text,
+    ADD COLUMN invoice_number text;
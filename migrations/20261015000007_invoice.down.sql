@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS invoice_line;
+
+--bun:split
+
+DROP TABLE IF EXISTS invoice;
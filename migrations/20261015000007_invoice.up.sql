@@ -0,0 +1,23 @@
+CREATE TABLE invoice (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    client text NOT NULL,
+    number text NOT NULL,
+    issued_on date NOT NULL DEFAULT current_date,
+    due_on date,
+    status text NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'sent', 'paid')),
+    category_id uuid REFERENCES category (id),
+    income_item_id uuid REFERENCES item (id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    UNIQUE (user_id, number)
+);
+
+--bun:split
+
+CREATE TABLE invoice_line (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    invoice_id uuid NOT NULL REFERENCES invoice (id) ON DELETE CASCADE,
+    description text NOT NULL,
+    quantity double precision NOT NULL DEFAULT 1,
+    unit_price double precision NOT NULL
+);
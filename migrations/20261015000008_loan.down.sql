@@ -0,0 +1,5 @@
+ALTER TABLE item DROP COLUMN loan_id;
+
+--bun:split
+
+DROP TABLE IF EXISTS loan;
@@ -0,0 +1,13 @@
+CREATE TABLE loan (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    counterparty text NOT NULL,
+    direction text NOT NULL CHECK (direction IN ('lent', 'borrowed')),
+    amount double precision NOT NULL,
+    due_on date,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+ALTER TABLE item ADD COLUMN loan_id uuid REFERENCES loan (id) ON DELETE SET NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE bill (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    amount double precision NOT NULL,
+    due_day integer NOT NULL CHECK (due_day BETWEEN 1 AND 31),
+    autopay boolean NOT NULL DEFAULT false,
+    category_id uuid REFERENCES category (id),
+    last_paid_on date,
+    created_at timestamp NOT NULL DEFAULT now()
+);
@@ -0,0 +1,12 @@
+CREATE TABLE staged_item (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    source text NOT NULL,
+    name text NOT NULL DEFAULT '',
+    cost double precision NOT NULL DEFAULT 0,
+    type text NOT NULL DEFAULT 'debit',
+    category_id uuid REFERENCES category (id) ON DELETE SET NULL,
+    occurred_on date,
+    details jsonb,
+    created_at timestamp NOT NULL DEFAULT now()
+);
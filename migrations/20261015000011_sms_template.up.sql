@@ -0,0 +1,7 @@
+CREATE TABLE sms_template (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    bank text NOT NULL,
+    pattern text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now()
+);
@@ -0,0 +1,9 @@
+ALTER TABLE staged_item DROP COLUMN display_name;
+
+--bun:split
+
+ALTER TABLE item DROP COLUMN display_name;
+
+--bun:split
+
+DROP TABLE IF EXISTS merchant_rule;
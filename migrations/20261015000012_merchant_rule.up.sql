@@ -0,0 +1,17 @@
+CREATE TABLE merchant_rule (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    pattern text NOT NULL,
+    display_name text NOT NULL,
+    category_id uuid REFERENCES category (id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    UNIQUE (user_id, pattern)
+);
+
+--bun:split
+
+ALTER TABLE item ADD COLUMN display_name text;
+
+--bun:split
+
+ALTER TABLE staged_item ADD COLUMN display_name text;
@@ -0,0 +1,7 @@
+CREATE TABLE hook_subscription (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    event text NOT NULL,
+    target_url text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now()
+);
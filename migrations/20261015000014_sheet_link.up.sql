@@ -0,0 +1,9 @@
+CREATE TABLE sheet_link (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL UNIQUE,
+    spreadsheet_id text NOT NULL,
+    sheet_name text NOT NULL DEFAULT 'Transactions',
+    columns text[] NOT NULL,
+    last_synced_at timestamp,
+    created_at timestamp NOT NULL DEFAULT now()
+);
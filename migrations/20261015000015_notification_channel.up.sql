@@ -0,0 +1,7 @@
+CREATE TABLE notification_channel (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    kind text NOT NULL,
+    webhook_url text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+CREATE TABLE summary_setting (
+    user_id integer PRIMARY KEY,
+    enabled boolean NOT NULL DEFAULT true,
+    weekday integer NOT NULL DEFAULT 1,
+    hour integer NOT NULL DEFAULT 0
+);
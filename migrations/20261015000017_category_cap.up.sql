@@ -0,0 +1,7 @@
+CREATE TABLE category_cap (
+    user_id integer NOT NULL,
+    category_id uuid NOT NULL REFERENCES category (id) ON DELETE CASCADE,
+    amount double precision NOT NULL,
+    hard boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (user_id, category_id)
+);
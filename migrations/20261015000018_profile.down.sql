@@ -0,0 +1,5 @@
+ALTER TABLE item DROP COLUMN profile_id;
+
+--bun:split
+
+DROP TABLE IF EXISTS profile;
@@ -0,0 +1,15 @@
+CREATE TABLE profile (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+--bun:split
+
+ALTER TABLE item ADD COLUMN profile_id uuid REFERENCES profile (id);
+
+--bun:split
+
+CREATE INDEX item_profile_id_idx ON item (profile_id);
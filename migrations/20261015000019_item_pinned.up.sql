@@ -0,0 +1 @@
+ALTER TABLE item ADD COLUMN pinned boolean NOT NULL DEFAULT false;
@@ -0,0 +1,10 @@
+CREATE TABLE item_template (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    cost double precision NOT NULL,
+    type text NOT NULL DEFAULT 'debit',
+    category_id uuid REFERENCES category (id) ON DELETE SET NULL,
+    profile_id uuid REFERENCES profile (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+ALTER TABLE item
+    DROP COLUMN latitude,
+    DROP COLUMN longitude,
+    DROP COLUMN place;
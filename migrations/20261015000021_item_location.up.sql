@@ -0,0 +1,5 @@
+ALTER TABLE item
+    ADD COLUMN latitude double precision,
+    ADD COLUMN longitude double precision,
+    ADD COLUMN place text,
+    ADD CONSTRAINT item_location_check CHECK ((latitude IS NULL) = (longitude IS NULL));
@@ -0,0 +1,5 @@
+ALTER TABLE item
+    DROP COLUMN original_amount,
+    DROP COLUMN original_currency,
+    DROP COLUMN exchange_rate,
+    DROP COLUMN rate_date;
@@ -0,0 +1,9 @@
+ALTER TABLE item
+    ADD COLUMN original_amount double precision,
+    ADD COLUMN original_currency text,
+    ADD COLUMN exchange_rate double precision,
+    ADD COLUMN rate_date date,
+    ADD CONSTRAINT item_original_amount_check CHECK (
+        (original_amount IS NULL) = (original_currency IS NULL)
+        AND (original_amount IS NULL) = (exchange_rate IS NULL)
+    );
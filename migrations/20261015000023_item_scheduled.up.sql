@@ -0,0 +1,5 @@
+ALTER TABLE item ADD COLUMN scheduled boolean NOT NULL DEFAULT false;
+
+--bun:split
+
+CREATE INDEX item_scheduled_idx ON item ("createdAt") WHERE scheduled;
@@ -0,0 +1,18 @@
+CREATE TABLE import_job (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    format text NOT NULL,
+    status text NOT NULL DEFAULT 'running',
+    message text,
+    total integer NOT NULL DEFAULT 0,
+    processed integer NOT NULL DEFAULT 0,
+    staged integer NOT NULL DEFAULT 0,
+    skipped integer NOT NULL DEFAULT 0,
+    errors jsonb NOT NULL DEFAULT '[]',
+    created_at timestamp NOT NULL DEFAULT now(),
+    finished_at timestamp
+);
+
+--bun:split
+
+CREATE INDEX import_job_user_id_idx ON import_job (user_id, created_at);
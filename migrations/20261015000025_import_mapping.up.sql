@@ -0,0 +1,17 @@
+CREATE TABLE import_mapping (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    date_column text NOT NULL,
+    date_format text NOT NULL,
+    description_column text NOT NULL,
+    amount_column text,
+    debit_column text,
+    credit_column text,
+    debits_positive boolean NOT NULL DEFAULT false,
+    reference_column text,
+    currency_column text,
+    category_column text,
+    created_at timestamp NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
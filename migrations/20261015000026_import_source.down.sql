@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS import_source_file;
+
+--bun:split
+
+DROP TABLE IF EXISTS import_source;
@@ -0,0 +1,27 @@
+CREATE TABLE import_source (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    kind text NOT NULL,
+    format text,
+    mapping text,
+    bucket text NOT NULL,
+    prefix text,
+    region text NOT NULL,
+    endpoint text,
+    access_key_id text NOT NULL,
+    secret_access_key text NOT NULL,
+    last_polled_at timestamp,
+    last_error text,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE TABLE import_source_file (
+    source_id uuid NOT NULL REFERENCES import_source (id) ON DELETE CASCADE,
+    key text NOT NULL,
+    job_id uuid REFERENCES import_job (id) ON DELETE SET NULL,
+    imported_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (source_id, key)
+);
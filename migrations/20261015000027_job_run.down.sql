@@ -0,0 +1,5 @@
+ALTER TABLE import_job DROP COLUMN updated_at;
+
+--bun:split
+
+DROP TABLE IF EXISTS job_run;
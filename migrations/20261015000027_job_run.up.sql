@@ -0,0 +1,12 @@
+CREATE TABLE job_run (
+    job text NOT NULL,
+    slot timestamp NOT NULL,
+    started_at timestamp NOT NULL DEFAULT now(),
+    finished_at timestamp,
+    error text,
+    PRIMARY KEY (job, slot)
+);
+
+--bun:split
+
+ALTER TABLE import_job ADD COLUMN updated_at timestamp NOT NULL DEFAULT now();
@@ -0,0 +1,16 @@
+CREATE TABLE hook_delivery (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    hook_id uuid NOT NULL REFERENCES hook_subscription (id) ON DELETE CASCADE,
+    event text NOT NULL,
+    payload jsonb NOT NULL,
+    status_code integer,
+    error text,
+    response_body text,
+    latency_ms bigint NOT NULL,
+    retry_of uuid REFERENCES hook_delivery (id) ON DELETE SET NULL,
+    attempted_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE INDEX hook_delivery_hook_id_idx ON hook_delivery (hook_id, attempted_at);
@@ -0,0 +1 @@
+ALTER TABLE item ADD COLUMN excluded boolean NOT NULL DEFAULT false;
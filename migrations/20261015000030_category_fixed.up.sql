@@ -0,0 +1 @@
+ALTER TABLE category ADD COLUMN fixed boolean NOT NULL DEFAULT false;
@@ -0,0 +1,4 @@
+CREATE TABLE user_preference (
+    user_id integer PRIMARY KEY,
+    locale text NOT NULL DEFAULT 'en'
+);
@@ -0,0 +1,5 @@
+DROP VIEW IF EXISTS item_legacy;
+
+--bun:split
+
+ALTER TABLE item RENAME COLUMN created_at TO "createdAt";
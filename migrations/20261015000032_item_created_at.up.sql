@@ -0,0 +1,9 @@
+ALTER TABLE item RENAME COLUMN "createdAt" TO created_at;
+
+--bun:split
+
+-- Hand-written queries and reporting tools that still select "createdAt"
+-- can read item_legacy instead of item until they move to created_at.
+-- It is read-only and holds up dropping item columns, so drop it once
+-- nothing reads it.
+CREATE VIEW item_legacy AS SELECT item.*, created_at AS "createdAt" FROM item;
@@ -0,0 +1,24 @@
+DO $$
+DECLARE
+    t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY[
+        'item', 'balance_snapshot', 'claim', 'invoice', 'loan', 'bill', 'staged_item',
+        'sms_template', 'merchant_rule', 'hook_subscription', 'sheet_link',
+        'notification_channel', 'summary_setting', 'category_cap', 'profile',
+        'item_template', 'import_job', 'import_mapping', 'import_source',
+        'user_preference'
+    ] LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS register_user ON %I', t);
+        EXECUTE format('ALTER TABLE %I DROP CONSTRAINT IF EXISTS %I', t, t || '_user_id_fkey');
+    END LOOP;
+END
+$$;
+
+--bun:split
+
+DROP FUNCTION IF EXISTS register_user();
+
+--bun:split
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,39 @@
+-- Users keep the integer ids every table and the API already use as
+-- legacy_id, and get a UUID for auth and sharing to key on.
+CREATE TABLE users (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    legacy_id integer NOT NULL UNIQUE,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+-- There is no sign-up yet, so a user is registered the first time anything
+-- is saved under their id. Once users are created explicitly, drop the
+-- register_user triggers and the foreign keys will refuse unknown ids.
+CREATE FUNCTION register_user() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO users (legacy_id) VALUES (NEW.user_id) ON CONFLICT DO NOTHING;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+--bun:split
+
+DO $$
+DECLARE
+    t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY[
+        'item', 'balance_snapshot', 'claim', 'invoice', 'loan', 'bill', 'staged_item',
+        'sms_template', 'merchant_rule', 'hook_subscription', 'sheet_link',
+        'notification_channel', 'summary_setting', 'category_cap', 'profile',
+        'item_template', 'import_job', 'import_mapping', 'import_source',
+        'user_preference'
+    ] LOOP
+        EXECUTE format('INSERT INTO users (legacy_id) SELECT DISTINCT user_id FROM %I ON CONFLICT DO NOTHING', t);
+        EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I FOREIGN KEY (user_id) REFERENCES users (legacy_id)', t, t || '_user_id_fkey');
+        EXECUTE format('CREATE TRIGGER register_user BEFORE INSERT OR UPDATE OF user_id ON %I FOR EACH ROW EXECUTE FUNCTION register_user()', t);
+    END LOOP;
+END
+$$;
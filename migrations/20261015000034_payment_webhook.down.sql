@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS payment_event;
+
+--bun:split
+
+DROP TABLE IF EXISTS payment_webhook;
@@ -0,0 +1,25 @@
+CREATE TABLE payment_webhook (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL REFERENCES users (legacy_id),
+    provider text NOT NULL CHECK (provider IN ('stripe', 'razorpay')),
+    secret text NOT NULL,
+    category_id uuid REFERENCES category (id),
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE TRIGGER register_user BEFORE INSERT OR UPDATE OF user_id ON payment_webhook
+    FOR EACH ROW EXECUTE FUNCTION register_user();
+
+--bun:split
+
+-- Processors retry deliveries, so each payment is recorded and turned into
+-- an item only once.
+CREATE TABLE payment_event (
+    webhook_id uuid NOT NULL REFERENCES payment_webhook (id) ON DELETE CASCADE,
+    payment_id text NOT NULL,
+    item_id uuid REFERENCES item (id) ON DELETE SET NULL,
+    received_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (webhook_id, payment_id)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS wallet_pass_device;
+
+--bun:split
+
+DROP TABLE IF EXISTS wallet_pass;
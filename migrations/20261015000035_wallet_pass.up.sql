@@ -0,0 +1,26 @@
+-- A user's budget pass. Budget and spent are what the pass last showed, so
+-- the hourly refresh only pushes passes whose numbers have changed.
+CREATE TABLE wallet_pass (
+    user_id integer PRIMARY KEY REFERENCES users (legacy_id),
+    serial uuid NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    auth_token text NOT NULL,
+    budget numeric NOT NULL DEFAULT 0,
+    spent numeric NOT NULL DEFAULT 0,
+    google boolean NOT NULL DEFAULT false,
+    updated_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE TRIGGER register_user BEFORE INSERT OR UPDATE OF user_id ON wallet_pass
+    FOR EACH ROW EXECUTE FUNCTION register_user();
+
+--bun:split
+
+-- Devices that added a pass to Apple Wallet and want push updates for it.
+CREATE TABLE wallet_pass_device (
+    device_id text NOT NULL,
+    serial uuid NOT NULL REFERENCES wallet_pass (serial) ON DELETE CASCADE,
+    push_token text NOT NULL,
+    PRIMARY KEY (device_id, serial)
+);
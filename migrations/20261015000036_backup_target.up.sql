@@ -0,0 +1,27 @@
+-- Where and how often a user's data is backed up. secret is the S3 secret
+-- access key or the WebDAV password.
+CREATE TABLE backup_target (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL REFERENCES users (legacy_id),
+    name text NOT NULL,
+    kind text NOT NULL CHECK (kind IN ('s3', 'webdav')),
+    schedule text NOT NULL CHECK (schedule IN ('weekly', 'monthly')),
+    format text NOT NULL CHECK (format IN ('json', 'csv')),
+    endpoint text,
+    bucket text,
+    prefix text,
+    region text,
+    access_key_id text,
+    username text,
+    secret text NOT NULL,
+    last_run_at timestamp,
+    last_status text,
+    last_error text,
+    last_file text,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE TRIGGER register_user BEFORE INSERT OR UPDATE OF user_id ON backup_target
+    FOR EACH ROW EXECUTE FUNCTION register_user();
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS record_item_history ON item;
+
+--bun:split
+
+DROP FUNCTION IF EXISTS record_item_history();
+
+--bun:split
+
+DROP TABLE IF EXISTS item_history;
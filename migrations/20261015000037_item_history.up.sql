@@ -0,0 +1,33 @@
+-- Every change to an item, with the row as it was before the change (NULL
+-- for inserts), so one user's items can be put back as they were at an
+-- earlier time.
+CREATE TABLE item_history (
+    id bigserial PRIMARY KEY,
+    item_id uuid NOT NULL,
+    user_id integer NOT NULL,
+    op text NOT NULL CHECK (op IN ('insert', 'update', 'delete')),
+    old jsonb,
+    changed_at timestamp NOT NULL DEFAULT clock_timestamp()
+);
+
+--bun:split
+
+CREATE INDEX item_history_user_changed_at ON item_history (user_id, changed_at);
+
+--bun:split
+
+CREATE FUNCTION record_item_history() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO item_history (item_id, user_id, op) VALUES (NEW.id, NEW.user_id, 'insert');
+        RETURN NULL;
+    END IF;
+    INSERT INTO item_history (item_id, user_id, op, old) VALUES (OLD.id, OLD.user_id, lower(TG_OP), to_jsonb(OLD));
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+--bun:split
+
+CREATE TRIGGER record_item_history AFTER INSERT OR UPDATE OR DELETE ON item
+    FOR EACH ROW EXECUTE FUNCTION record_item_history();
@@ -0,0 +1,5 @@
+ALTER TABLE staged_item DROP COLUMN import_batch_id;
+
+--bun:split
+
+ALTER TABLE item DROP COLUMN import_batch_id;
@@ -0,0 +1,15 @@
+ALTER TABLE item ADD COLUMN import_batch_id uuid REFERENCES import_job (id) ON DELETE SET NULL;
+
+--bun:split
+
+CREATE INDEX item_import_batch_id_idx ON item (import_batch_id) WHERE import_batch_id IS NOT NULL;
+
+--bun:split
+
+ALTER TABLE staged_item ADD COLUMN import_batch_id uuid REFERENCES import_job (id) ON DELETE SET NULL;
+
+--bun:split
+
+UPDATE staged_item SET import_batch_id = (details->>'import_id')::uuid
+    WHERE source = 'import' AND details->>'import_id' IS NOT NULL
+    AND EXISTS (SELECT 1 FROM import_job WHERE id = (details->>'import_id')::uuid);
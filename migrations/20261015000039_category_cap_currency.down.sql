@@ -0,0 +1,3 @@
+ALTER TABLE category_cap
+    DROP COLUMN currency,
+    DROP COLUMN exchange_rate;
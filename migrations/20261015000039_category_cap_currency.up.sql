@@ -0,0 +1,4 @@
+ALTER TABLE category_cap
+    ADD COLUMN currency text,
+    ADD COLUMN exchange_rate double precision,
+    ADD CONSTRAINT category_cap_currency_check CHECK ((currency IS NULL) = (exchange_rate IS NULL));
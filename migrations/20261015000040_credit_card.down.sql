@@ -0,0 +1,5 @@
+ALTER TABLE item DROP COLUMN card_id;
+
+--bun:split
+
+DROP TABLE IF EXISTS credit_card;
@@ -0,0 +1,24 @@
+-- A credit card whose statement closes on statement_day each month and is
+-- due on the next due_day after that. Items charged to it carry card_id.
+CREATE TABLE credit_card (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id integer NOT NULL REFERENCES users (legacy_id),
+    name text NOT NULL,
+    statement_day integer NOT NULL CHECK (statement_day BETWEEN 1 AND 31),
+    due_day integer NOT NULL CHECK (due_day BETWEEN 1 AND 31),
+    credit_limit double precision,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+--bun:split
+
+CREATE TRIGGER register_user BEFORE INSERT OR UPDATE OF user_id ON credit_card
+    FOR EACH ROW EXECUTE FUNCTION register_user();
+
+--bun:split
+
+ALTER TABLE item ADD COLUMN card_id uuid REFERENCES credit_card (id) ON DELETE SET NULL;
+
+--bun:split
+
+CREATE INDEX item_card_id_idx ON item (card_id, created_at) WHERE card_id IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE credit_card
+    DROP COLUMN spending_limit,
+    DROP COLUMN alert_percent,
+    DROP COLUMN limit_alerted_on;
@@ -0,0 +1,7 @@
+-- A monthly spending limit on a card, separate from its credit limit and
+-- from category caps. Users are alerted once a month when charges reach
+-- alert_percent of it.
+ALTER TABLE credit_card
+    ADD COLUMN spending_limit double precision CHECK (spending_limit > 0),
+    ADD COLUMN alert_percent integer NOT NULL DEFAULT 80 CHECK (alert_percent BETWEEN 1 AND 100),
+    ADD COLUMN limit_alerted_on date;
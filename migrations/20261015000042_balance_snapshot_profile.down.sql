@@ -0,0 +1,13 @@
+DELETE FROM balance_snapshot WHERE profile_id IS NOT NULL;
+
+--bun:split
+
+DROP INDEX balance_snapshot_ledger_idx;
+
+--bun:split
+
+ALTER TABLE balance_snapshot ADD PRIMARY KEY (user_id, taken_on);
+
+--bun:split
+
+ALTER TABLE balance_snapshot DROP COLUMN profile_id;
@@ -0,0 +1,12 @@
+-- Snapshots are taken per ledger. Existing ones, taken across all of a
+-- user's ledgers, are kept as the default ledger's.
+ALTER TABLE balance_snapshot ADD COLUMN profile_id uuid REFERENCES profile (id) ON DELETE CASCADE;
+
+--bun:split
+
+ALTER TABLE balance_snapshot DROP CONSTRAINT balance_snapshot_pkey;
+
+--bun:split
+
+CREATE UNIQUE INDEX balance_snapshot_ledger_idx
+    ON balance_snapshot (user_id, (COALESCE(profile_id, '00000000-0000-0000-0000-000000000000'::uuid)), taken_on);
@@ -0,0 +1,33 @@
+ALTER TABLE users ALTER COLUMN legacy_id DROP DEFAULT;
+
+--bun:split
+
+DROP SEQUENCE IF EXISTS users_legacy_id_seq;
+
+--bun:split
+
+CREATE FUNCTION register_user() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO users (legacy_id) VALUES (NEW.user_id) ON CONFLICT DO NOTHING;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+--bun:split
+
+DO $$
+DECLARE
+    t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY[
+        'item', 'balance_snapshot', 'claim', 'invoice', 'loan', 'bill', 'staged_item',
+        'sms_template', 'merchant_rule', 'hook_subscription', 'sheet_link',
+        'notification_channel', 'summary_setting', 'category_cap', 'profile',
+        'item_template', 'import_job', 'import_mapping', 'import_source',
+        'user_preference', 'payment_webhook', 'wallet_pass', 'backup_target',
+        'credit_card'
+    ] LOOP
+        EXECUTE format('CREATE TRIGGER register_user BEFORE INSERT OR UPDATE OF user_id ON %I FOR EACH ROW EXECUTE FUNCTION register_user()', t);
+    END LOOP;
+END
+$$;
@@ -0,0 +1,36 @@
+-- Users are now created with POST /users or by the seed command, so the
+-- register_user triggers go and the user_id foreign keys refuse ids that
+-- were never registered.
+DO $$
+DECLARE
+    t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY[
+        'item', 'balance_snapshot', 'claim', 'invoice', 'loan', 'bill', 'staged_item',
+        'sms_template', 'merchant_rule', 'hook_subscription', 'sheet_link',
+        'notification_channel', 'summary_setting', 'category_cap', 'profile',
+        'item_template', 'import_job', 'import_mapping', 'import_source',
+        'user_preference', 'payment_webhook', 'wallet_pass', 'backup_target',
+        'credit_card'
+    ] LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS register_user ON %I', t);
+    END LOOP;
+END
+$$;
+
+--bun:split
+
+DROP FUNCTION IF EXISTS register_user();
+
+--bun:split
+
+-- Users registered without an id get the next one after every id in use.
+CREATE SEQUENCE users_legacy_id_seq OWNED BY users.legacy_id;
+
+--bun:split
+
+SELECT setval('users_legacy_id_seq', COALESCE(max(legacy_id), 0) + 1, false) FROM users;
+
+--bun:split
+
+ALTER TABLE users ALTER COLUMN legacy_id SET DEFAULT nextval('users_legacy_id_seq');
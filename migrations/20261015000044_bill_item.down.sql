@@ -0,0 +1,2 @@
+ALTER TABLE bill
+    DROP COLUMN item_id;
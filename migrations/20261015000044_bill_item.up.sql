@@ -0,0 +1,3 @@
+-- The recurring item a bill stands for, if any.
+ALTER TABLE bill
+    ADD COLUMN item_id uuid REFERENCES item (id) ON DELETE SET NULL;
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/currency"
+)
+
+// moneyRounding is how amounts are rounded to the currency's minor unit,
+// and to a coarser cash increment where the ledger's currency has one. It
+// is set up from the environment when the server starts.
+var moneyRounding = rounding{decimals: 2}
+
+type rounding struct {
+	// halfEven rounds halves to the even cent (banker's rounding) instead
+	// of away from zero, so rounding errors don't build up in one
+	// direction over many items.
+	halfEven bool
+	// decimals is how many digits the currency's minor unit has: 2 for
+	// cents, 0 for currencies like JPY and 3 for ones like KWD.
+	decimals int
+	// cash is the smallest coin, e.g. 0.05, for currencies that round cash
+	// totals. Zero means amounts are only rounded to the minor unit.
+	cash float64
+}
+
+// newRounding reads ROUNDING_MODE ("half_up", the default, or "half_even")
+// and CASH_ROUNDING, a list like "CHF:0.05,DKK:0.50" of which the entry for
+// the currency code applies. Amounts are rounded to the currency's minor
+// unit, or to cents if code is empty or unknown.
+func newRounding(mode, cashRounding, code string) (rounding, error) {
+	r := rounding{decimals: 2}
+	if cur, err := currency.ParseISO(code); err == nil {
+		r.decimals, _ = currency.Standard.Rounding(cur)
+	}
+
+	switch mode {
+	case "", "half_up":
+	case "half_even":
+		r.halfEven = true
+	default:
+		return r, fmt.Errorf("unknown rounding mode %q", mode)
+	}
+
+	for _, entry := range strings.Split(cashRounding, ",") {
+		if entry == "" {
+			continue
+		}
+		cur, inc, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return r, fmt.Errorf("cash rounding %q is not CODE:INCREMENT", entry)
+		}
+		step, err := strconv.ParseFloat(inc, 64)
+		if err != nil || step <= 0 {
+			return r, fmt.Errorf("cash rounding %q has an invalid increment", entry)
+		}
+		if strings.EqualFold(code, cur) {
+			r.cash = step
+		}
+	}
+	return r, nil
+}
+
+func (r rounding) round(x float64) float64 {
+	if r.halfEven {
+		return math.RoundToEven(x)
+	}
+	return math.Round(x)
+}
+
+// minor rounds x to a whole number of minor units, e.g. cents. x is first
+// snapped to a millionth so that binary noise, like 2.675 being stored as
+// 2.67499999..., doesn't decide which way a half goes.
+func (r rounding) minor(x float64) float64 {
+	return r.round(math.Round(x*1e6) / math.Pow10(6-r.decimals))
+}
+
+// money rounds an amount to the minor unit.
+func (r rounding) money(x float64) float64 {
+	return r.minor(x) / math.Pow10(r.decimals)
+}
+
+// roundCash rounds an amount to the cash increment.
+func (r rounding) roundCash(x float64) float64 {
+	if r.cash == 0 {
+		return r.money(x)
+	}
+	unit := math.Pow10(r.decimals)
+	step := math.Max(math.Round(r.cash*unit), 1)
+	return r.round(r.minor(x)/step) * step / unit
+}
+
+// roundMoney rounds an amount to the currency's minor unit, e.g. cents.
+func roundMoney(x float64) float64 {
+	return moneyRounding.money(x)
+}
+
+// roundCash rounds an amount that is settled as a whole, like an invoice
+// total, to the currency's cash increment.
+func roundCash(x float64) float64 {
+	return moneyRounding.roundCash(x)
+}
@@ -0,0 +1,147 @@
+package main
+
+import "testing"
+
+func TestNewRounding(t *testing.T) {
+	tests := []struct {
+		mode, cashRounding, currency string
+		want                         rounding
+	}{
+		{"", "", "", rounding{decimals: 2}},
+		{"half_up", "", "INR", rounding{decimals: 2}},
+		{"half_even", "", "INR", rounding{halfEven: true, decimals: 2}},
+		{"", "", "JPY", rounding{decimals: 0}},
+		{"", "", "KWD", rounding{decimals: 3}},
+		{"", "", "XXY", rounding{decimals: 2}},
+		{"", "CHF:0.05,DKK:0.50", "CHF", rounding{decimals: 2, cash: 0.05}},
+		{"", "CHF:0.05, DKK:0.50", "dkk", rounding{decimals: 2, cash: 0.5}},
+		{"", "CHF:0.05", "INR", rounding{decimals: 2}},
+	}
+	for _, tt := range tests {
+		got, err := newRounding(tt.mode, tt.cashRounding, tt.currency)
+		if err != nil {
+			t.Errorf("newRounding(%q, %q, %q): %v", tt.mode, tt.cashRounding, tt.currency, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("newRounding(%q, %q, %q) = %+v, want %+v", tt.mode, tt.cashRounding, tt.currency, got, tt.want)
+		}
+	}
+
+	for _, bad := range []struct{ mode, cashRounding string }{
+		{"half_down", ""},
+		{"", "CHF"},
+		{"", "CHF:0"},
+		{"", "CHF:-0.05"},
+		{"", "CHF:five"},
+	} {
+		_, err := newRounding(bad.mode, bad.cashRounding, "CHF")
+		if err == nil {
+			t.Errorf("newRounding(%q, %q) accepted it", bad.mode, bad.cashRounding)
+		}
+	}
+}
+
+func TestRoundMoney(t *testing.T) {
+	defer func(r rounding) { moneyRounding = r }(moneyRounding)
+
+	halfUp := rounding{decimals: 2}
+	halfEven := rounding{halfEven: true, decimals: 2}
+	yenHalfUp := rounding{decimals: 0}
+	yenHalfEven := rounding{halfEven: true, decimals: 0}
+	dinarHalfUp := rounding{decimals: 3}
+	dinarHalfEven := rounding{halfEven: true, decimals: 3}
+
+	tests := []struct {
+		name string
+		r    rounding
+		x    float64
+		want float64
+	}{
+		{"half up, tie", halfUp, 0.125, 0.13},
+		{"half up, tie stored below", halfUp, 2.675, 2.68},
+		{"half up, tie stored above", halfUp, 1.005, 1.01},
+		{"half up, negative tie", halfUp, -2.675, -2.68},
+		{"half up, smallest negative tie", halfUp, -0.005, -0.01},
+		{"half up, below tie", halfUp, 2.674999, 2.67},
+		{"half up, sum noise", halfUp, 0.1 + 0.2, 0.3},
+
+		{"half even, tie to even", halfEven, 0.125, 0.12},
+		{"half even, tie up to even", halfEven, 0.135, 0.14},
+		{"half even, tie stored below", halfEven, 2.675, 2.68},
+		{"half even, tie stored above", halfEven, 1.005, 1},
+		{"half even, negative tie", halfEven, -0.125, -0.12},
+		{"half even, negative tie up", halfEven, -2.675, -2.68},
+		{"half even, above tie", halfEven, 0.125001, 0.13},
+		{"half even, noise below a millionth", halfEven, 0.1250000001, 0.12},
+		{"half even, zero", halfEven, 0, 0},
+
+		{"no decimals, half up, tie", yenHalfUp, 2.5, 3},
+		{"no decimals, half up, negative tie", yenHalfUp, -2.5, -3},
+		{"no decimals, half even, tie", yenHalfEven, 2.5, 2},
+		{"no decimals, half even, odd tie", yenHalfEven, 3.5, 4},
+		{"no decimals, half even, negative tie", yenHalfEven, -2.5, -2},
+		{"no decimals, fraction", yenHalfEven, 1234.4, 1234},
+
+		{"three decimals, half up, tie", dinarHalfUp, 1.0005, 1.001},
+		{"three decimals, half up, negative tie", dinarHalfUp, -1.2345, -1.235},
+		{"three decimals, half even, tie", dinarHalfEven, 1.0005, 1},
+		{"three decimals, half even, odd tie", dinarHalfEven, 1.0015, 1.002},
+		{"three decimals, half even, negative tie", dinarHalfEven, -1.2345, -1.234},
+		{"three decimals, kept", dinarHalfEven, 12.345, 12.345},
+	}
+	for _, tt := range tests {
+		moneyRounding = tt.r
+		if got := roundMoney(tt.x); got != tt.want {
+			t.Errorf("%s: roundMoney(%v) = %v, want %v", tt.name, tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestRoundCash(t *testing.T) {
+	defer func(r rounding) { moneyRounding = r }(moneyRounding)
+
+	tests := []struct {
+		name string
+		r    rounding
+		x    float64
+		want float64
+	}{
+		{"no increment", rounding{decimals: 2}, 1.024, 1.02},
+		{"down to increment", rounding{decimals: 2, cash: 0.05}, 1.02, 1},
+		{"up to increment", rounding{decimals: 2, cash: 0.05}, 1.03, 1.05},
+		{"half up, tie", rounding{decimals: 2, cash: 0.05}, 1.025, 1.05},
+		{"half even, rounded to cents first", rounding{halfEven: true, decimals: 2, cash: 0.05}, 1.025, 1},
+		{"half up, tie of a larger coin", rounding{decimals: 2, cash: 0.5}, 12.25, 12.5},
+		{"half even, tie of a larger coin", rounding{halfEven: true, decimals: 2, cash: 0.5}, 12.25, 12},
+		{"half even, negative tie", rounding{halfEven: true, decimals: 2, cash: 0.5}, -12.25, -12},
+		{"half up, negative tie", rounding{decimals: 2, cash: 0.5}, -12.25, -12.5},
+		{"three decimals", rounding{decimals: 3, cash: 0.005}, 1.0025, 1.005},
+		{"no decimals", rounding{decimals: 0, cash: 10}, 1234, 1230},
+		{"increment below the minor unit", rounding{decimals: 0, cash: 0.5}, 12.4, 12},
+	}
+	for _, tt := range tests {
+		moneyRounding = tt.r
+		if got := roundCash(tt.x); got != tt.want {
+			t.Errorf("%s: roundCash(%v) = %v, want %v", tt.name, tt.x, got, tt.want)
+		}
+	}
+}
+
+// TestInvoiceTotal checks that a total is the sum of its lines as shown,
+// each rounded to cents, and not the rounded sum of the unrounded lines.
+func TestInvoiceTotal(t *testing.T) {
+	defer func(r rounding) { moneyRounding = r }(moneyRounding)
+	moneyRounding = rounding{decimals: 2}
+
+	inv := Invoice{Lines: []*InvoiceLine{
+		{Quantity: 1, UnitPrice: 0.125},
+		{Quantity: 1, UnitPrice: 0.125},
+		{Quantity: 3, UnitPrice: 0.335},
+	}}
+	inv.computeTotal()
+	// 0.13 + 0.13 + 1.01, where the unrounded lines add up to 1.255.
+	if inv.Total != 1.27 {
+		t.Errorf("total is %v, want 1.27", inv.Total)
+	}
+}
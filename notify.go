@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// NotificationChannel is somewhere a user's notifications are delivered.
+// Slack and Discord channels are incoming webhooks.
+type NotificationChannel struct {
+	bun.BaseModel `bun:"table:notification_channel,alias:nc"`
+
+	ID         uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID     int       `bun:"user_id" json:"user_id"`
+	Kind       string    `json:"kind"`
+	WebhookURL string    `json:"webhook_url"`
+	CreatedAt  time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// webhookKinds holds, for each channel kind, the URL prefixes its webhooks
+// live under and how a message is wrapped for it.
+var webhookKinds = map[string]struct {
+	prefixes []string
+	payload  func(text string) interface{}
+}{
+	"slack": {
+		prefixes: []string{"https://hooks.slack.com/"},
+		payload:  func(text string) interface{} { return map[string]string{"text": text} },
+	},
+	"discord": {
+		prefixes: []string{"https://discord.com/api/webhooks/", "https://discordapp.com/api/webhooks/"},
+		payload:  func(text string) interface{} { return map[string]string{"content": text} },
+	},
+}
+
+var notifyClient = newOutboundClient(10 * time.Second)
+
+func (ch *NotificationChannel) send(ctx context.Context, text string) error {
+	body, err := json.Marshal(webhookKinds[ch.Kind].payload(text))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	res, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s webhook: %s", ch.Kind, res.Status)
+	}
+	return nil
+}
+
+// notify sends text to every channel the user has set up. A failing
+// channel is logged and does not stop the others.
+func (trackerDb *trackerDb) notify(ctx context.Context, userID int, text string) error {
+	channels := []NotificationChannel{}
+	err := trackerDb.db.NewSelect().Model(&channels).Where("user_id = ?", userID).Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range channels {
+		err = ch.send(ctx, text)
+		if err != nil {
+			log.Printf("Error while notifying channel %s: %v", ch.ID, err)
+		}
+	}
+	return nil
+}
+
+func (trackerDb *trackerDb) addNotificationChannel(c echo.Context) error {
+	ctx := context.Background()
+
+	ch := new(NotificationChannel)
+	err := c.Bind(ch)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	kind, ok := webhookKinds[ch.Kind]
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "kind must be slack or discord")
+	}
+	valid := false
+	for _, p := range kind.prefixes {
+		valid = valid || strings.HasPrefix(ch.WebhookURL, p)
+	}
+	if !valid {
+		return respondError(c, http.StatusBadRequest, "webhook_url is not a "+ch.Kind+" incoming webhook")
+	}
+
+	_, err = trackerDb.db.NewInsert().Model(ch).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, "", ch)
+}
+
+func (trackerDb *trackerDb) getAllNotificationChannels(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	channels := []NotificationChannel{}
+	err := trackerDb.db.NewSelect().Model(&channels).Where("user_id = ?", userID).Order("created_at").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting notification channels: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, channels)
+}
+
+func (trackerDb *trackerDb) deleteNotificationChannel(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("notification_channel").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Notification channel not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// testNotificationChannel sends a test message so the user can check the
+// webhook works.
+func (trackerDb *trackerDb) testNotificationChannel(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	var ch NotificationChannel
+	err := trackerDb.db.NewSelect().Model(&ch).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Notification channel not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch notification channel: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	err = ch.send(ctx, "Test notification from finance tracker")
+	if err != nil {
+		return respondError(c, http.StatusBadGateway, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, Envelope{Message: "ok"})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// ocrBackend extracts text from an image.
+type ocrBackend interface {
+	Text(ctx context.Context, image []byte) (string, error)
+}
+
+func newOCRBackend(env *Env) ocrBackend {
+	switch env.OcrBackend {
+	case "google":
+		return &googleVisionOCR{
+			apiKey: env.OcrApiKey,
+			client: newOutboundClient(30 * time.Second),
+		}
+	default:
+		return tesseractOCR{}
+	}
+}
+
+// tesseractOCR shells out to a locally installed tesseract binary.
+type tesseractOCR struct{}
+
+func (tesseractOCR) Text(ctx context.Context, image []byte) (string, error) {
+	cmd := exec.CommandContext(ctx, "tesseract", "stdin", "stdout")
+	cmd.Stdin = bytes.NewReader(image)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("tesseract: %w", err)
+	}
+	return string(out), nil
+}
+
+// googleVisionOCR calls the Cloud Vision images:annotate REST endpoint.
+type googleVisionOCR struct {
+	apiKey string
+	client *http.Client
+}
+
+func (g *googleVisionOCR) Text(ctx context.Context, image []byte) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{
+				"image":    map[string]interface{}{"content": base64.StdEncoding.EncodeToString(image)},
+				"features": []interface{}{map[string]interface{}{"type": "DOCUMENT_TEXT_DETECTION"}},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := "https://vision.googleapis.com/v1/images:annotate?key=" + url.QueryEscape(g.apiKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	res, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return "", fmt.Errorf("vision api: %s: %s", res.Status, msg)
+	}
+
+	var out struct {
+		Responses []struct {
+			FullTextAnnotation struct {
+				Text string `json:"text"`
+			} `json:"fullTextAnnotation"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"responses"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return "", err
+	}
+	if len(out.Responses) == 0 {
+		return "", nil
+	}
+	if out.Responses[0].Error != nil {
+		return "", fmt.Errorf("vision api: %s", out.Responses[0].Error.Message)
+	}
+	return out.Responses[0].FullTextAnnotation.Text, nil
+}
+
+type ReceiptLine struct {
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+type Receipt struct {
+	Merchant string
+	Date     time.Time
+	Total    float64
+	Lines    []ReceiptLine
+}
+
+var (
+	receiptAmountRe = regexp.MustCompile(`(\d[\d,]*\.\d{2})\s*$`)
+	receiptDates    = []struct {
+		re     *regexp.Regexp
+		layout string
+	}{
+		{regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2})\b`), "2006-01-02"},
+		{regexp.MustCompile(`\b(\d{2}/\d{2}/\d{4})\b`), "02/01/2006"},
+		{regexp.MustCompile(`\b(\d{2}-\d{2}-\d{4})\b`), "02-01-2006"},
+		{regexp.MustCompile(`\b(\d{2}/\d{2}/\d{2})\b`), "02/01/06"},
+	}
+	receiptSkipWords = []string{"tax", "gst", "vat", "change", "cash", "card", "tender", "discount"}
+)
+
+// parseReceipt picks the merchant (first line with letters), the first date,
+// the total (last line mentioning a total, or else the largest amount) and
+// the priced lines out of OCR text. Dates are read day-first.
+func parseReceipt(text string) Receipt {
+	var r Receipt
+	var largest float64
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lower := strings.ToLower(line)
+
+		if r.Merchant == "" && strings.IndexFunc(line, isLetter) >= 0 {
+			r.Merchant = line
+			continue
+		}
+
+		if r.Date.IsZero() {
+			for _, d := range receiptDates {
+				if m := d.re.FindString(line); m != "" {
+					if t, err := time.Parse(d.layout, m); err == nil {
+						r.Date = t
+						break
+					}
+				}
+			}
+		}
+
+		m := receiptAmountRe.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(line[m[2]:m[3]], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		largest = max(largest, amount)
+
+		if strings.Contains(lower, "total") && !strings.Contains(lower, "sub") {
+			r.Total = amount
+			continue
+		}
+		if containsAny(lower, receiptSkipWords) || strings.Contains(lower, "total") {
+			continue
+		}
+
+		desc := strings.TrimSpace(line[:m[2]])
+		if strings.IndexFunc(desc, isLetter) >= 0 {
+			r.Lines = append(r.Lines, ReceiptLine{Description: desc, Amount: amount})
+		}
+	}
+
+	if r.Total == 0 {
+		r.Total = largest
+	}
+	return r
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestReceipt runs an uploaded receipt photo through OCR and stages the
+// extracted merchant, date and total for the user to confirm.
+func (trackerDb *trackerDb) ingestReceipt(c echo.Context) error {
+	image, err := trackerDb.readUpload(c, "receipt", trackerDb.receiptUploads())
+	var rejected *UploadRejected
+	if errors.As(err, &rejected) {
+		return respondRejected(c, rejected)
+	}
+	if err != nil {
+		log.Printf("Error while reading receipt: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	userID, err := strconv.Atoi(c.FormValue("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id is required")
+	}
+
+	release, ok := trackerDb.imports.acquire(strconv.Itoa(userID), concurrencyWait)
+	if !ok {
+		return respondBusy(c, "Too many imports running for this user; try again when one finishes")
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	text, err := trackerDb.ocr.Text(ctx, image)
+	if err != nil {
+		log.Printf("Error while running OCR: %+v", err)
+		return respondError(c, http.StatusBadGateway, "Could not read the receipt")
+	}
+	receipt := parseReceipt(text)
+
+	staged := &StagedItem{
+		UserID:     userID,
+		Source:     "receipt",
+		Name:       receipt.Merchant,
+		Cost:       receipt.Total,
+		Type:       "debit",
+		OccurredOn: Date{receipt.Date},
+		Details: map[string]interface{}{
+			"lines": receipt.Lines,
+			"text":  text,
+		},
+	}
+	err = trackerDb.stage(ctx, staged)
+	if err != nil {
+		log.Printf("Error while staging item: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, staged)
+}
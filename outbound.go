@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// breakerThreshold consecutive failures to a host open its circuit.
+	breakerThreshold = 5
+	// breakerCooldown is how long an open circuit refuses calls before one
+	// trial call is let through.
+	breakerCooldown = 30 * time.Second
+	// outboundAttempts is how many times an idempotent call is tried.
+	outboundAttempts = 3
+	// outboundConnsPerHost caps connections to any one third party so a slow
+	// one ties up a bounded number of goroutines.
+	outboundConnsPerHost = 16
+)
+
+var errCircuitOpen = errors.New("circuit open: host is failing, not calling it for now")
+
+type OutboundStats struct {
+	Host         string  `json:"host"`
+	Requests     int64   `json:"requests"`
+	Failures     int64   `json:"failures"`
+	Retries      int64   `json:"retries"`
+	Rejected     int64   `json:"rejected"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	Open         bool    `json:"open"`
+}
+
+type circuit struct {
+	stats     OutboundStats
+	latency   time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// outboundTransport is shared by every client that calls a third party. It
+// keeps a circuit breaker and counters per host, and retries idempotent
+// calls that fail with a network error or 5xx.
+type outboundTransport struct {
+	base  http.RoundTripper
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+var outbound = &outboundTransport{
+	base:  newBaseTransport(),
+	hosts: map[string]*circuit{},
+}
+
+func newBaseTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxConnsPerHost = outboundConnsPerHost
+	return t
+}
+
+// newOutboundClient returns a client for one integration. timeout bounds a
+// whole call including retries.
+func newOutboundClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: outbound}
+}
+
+func (t *outboundTransport) circuit(host string) *circuit {
+	c, ok := t.hosts[host]
+	if !ok {
+		c = &circuit{stats: OutboundStats{Host: host}}
+		t.hosts[host] = c
+	}
+	return c
+}
+
+// allow reports whether a call to host may go ahead. Once the cooldown has
+// passed, a single call is let through to probe whether the host is back.
+func (t *outboundTransport) allow(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.circuit(host)
+	if c.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(c.openUntil) || c.probing {
+		c.stats.Rejected++
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+func (t *outboundTransport) record(host string, failed bool, retried int, took time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.circuit(host)
+	c.stats.Requests++
+	c.stats.Retries += int64(retried)
+	c.latency += took
+
+	if !failed {
+		c.failures = 0
+		c.openUntil = time.Time{}
+		c.probing = false
+		return
+	}
+	c.stats.Failures++
+	c.failures++
+	if c.probing || c.failures >= breakerThreshold {
+		if c.openUntil.IsZero() || c.probing {
+			log.Printf("Opening circuit to %s after %d failures", host, c.failures)
+		}
+		c.openUntil = time.Now().Add(breakerCooldown)
+		c.probing = false
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if !t.allow(host) {
+		return nil, errCircuitOpen
+	}
+
+	attempts := 1
+	if idempotent(req.Method) && (req.Body == nil || req.GetBody != nil) {
+		attempts = outboundAttempts
+	}
+
+	start := time.Now()
+	var res *http.Response
+	var err error
+	retried := 0
+calls:
+	for attempt := 1; ; attempt++ {
+		res, err = t.base.RoundTrip(req)
+		if err == nil && res.StatusCode < 500 || attempt == attempts {
+			break
+		}
+
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(retryBase << attempt)))):
+		case <-req.Context().Done():
+			break calls
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				res = nil
+				break
+			}
+		}
+		retried++
+	}
+
+	t.record(host, err != nil || res.StatusCode >= 500, retried, time.Since(start))
+	return res, err
+}
+
+func (t *outboundTransport) stats() []OutboundStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]OutboundStats, 0, len(t.hosts))
+	for _, c := range t.hosts {
+		s := c.stats
+		s.Open = !c.openUntil.IsZero()
+		if s.Requests > 0 {
+			s.AvgLatencyMs = float64(c.latency.Milliseconds()) / float64(s.Requests)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+	return stats
+}
+
+// getOutboundStats lists call counts, failures and circuit state for every
+// third party the server has called since it started. Only admins may call
+// it under the default policy.
+func (trackerDb *trackerDb) getOutboundStats(c echo.Context) error {
+	return respondOK(c, outbound.stats())
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+	"golang.org/x/text/currency"
+)
+
+// PaymentWebhook receives a payment processor's webhooks for one user and
+// turns their captured payments into income items. Secret is the signing
+// secret the processor shows when the webhook is set up; it is write-only
+// and never sent back.
+type PaymentWebhook struct {
+	bun.BaseModel `bun:"table:payment_webhook,alias:pw"`
+
+	ID         uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID     int       `bun:"user_id" json:"user_id"`
+	Provider   string    `json:"provider"`
+	Secret     string    `json:"secret,omitempty"`
+	CategoryID uuid.UUID `bun:"type:uuid,nullzero" json:"category_id"`
+	CreatedAt  time.Time `bun:",nullzero,default:now()" json:"created_at"`
+	// URL is where to point the processor's webhook.
+	URL string `bun:"-" json:"url"`
+}
+
+// PaymentEvent records a payment that came in through a webhook.
+type PaymentEvent struct {
+	bun.BaseModel `bun:"table:payment_event,alias:pe"`
+
+	WebhookID  uuid.UUID `bun:",pk,type:uuid" json:"webhook_id"`
+	PaymentID  string    `bun:",pk" json:"payment_id"`
+	ItemID     uuid.UUID `bun:"type:uuid,nullzero" json:"item_id"`
+	ReceivedAt time.Time `bun:",nullzero,default:now()" json:"received_at"`
+}
+
+// stripeTolerance is how old a Stripe signature's timestamp may be before
+// the delivery is treated as a replay.
+const stripeTolerance = 5 * time.Minute
+
+// maxPaymentEventSize bounds webhook bodies; real events are a few KB.
+const maxPaymentEventSize = 1 << 20
+
+var errBadSignature = errors.New("invalid signature")
+
+// payment is a captured payment read from a processor's event. Amount is
+// in the currency's minor unit, e.g. paise.
+type payment struct {
+	ID          string
+	Amount      int64
+	Currency    string
+	Description string
+	At          time.Time
+}
+
+// paymentProvider verifies a delivery and extracts the payment from it.
+// parse returns a nil payment for events that aren't captured payments.
+type paymentProvider struct {
+	verify func(h http.Header, body []byte, secret string, now time.Time) error
+	parse  func(body []byte) (*payment, error)
+}
+
+var paymentProviders = map[string]paymentProvider{
+	"stripe":   {verify: verifyStripe, parse: parseStripe},
+	"razorpay": {verify: verifyRazorpay, parse: parseRazorpay},
+}
+
+// verifyStripe checks the Stripe-Signature header, "t=<unix>,v1=<hex>",
+// where v1 is an HMAC-SHA256 of "<t>.<body>". Stripe sends several v1
+// signatures while a secret is being rolled.
+func verifyStripe(h http.Header, body []byte, secret string, now time.Time) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(h.Get("Stripe-Signature"), ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || now.Sub(time.Unix(t, 0)).Abs() > stripeTolerance {
+		return errBadSignature
+	}
+
+	want := hmacSum([]byte(secret), ts+"."+string(body))
+	for _, sig := range sigs {
+		got, err := hex.DecodeString(sig)
+		if err == nil && hmac.Equal(got, want) {
+			return nil
+		}
+	}
+	return errBadSignature
+}
+
+// parseStripe reads payment_intent.succeeded events.
+func parseStripe(body []byte) (*payment, error) {
+	var ev struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID             string `json:"id"`
+				AmountReceived int64  `json:"amount_received"`
+				Currency       string `json:"currency"`
+				Description    string `json:"description"`
+				Created        int64  `json:"created"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	err := json.Unmarshal(body, &ev)
+	if err != nil || ev.Type != "payment_intent.succeeded" {
+		return nil, err
+	}
+	o := ev.Data.Object
+	return &payment{ID: o.ID, Amount: o.AmountReceived, Currency: o.Currency, Description: o.Description, At: time.Unix(o.Created, 0)}, nil
+}
+
+// verifyRazorpay checks X-Razorpay-Signature, a hex HMAC-SHA256 of the
+// body.
+func verifyRazorpay(h http.Header, body []byte, secret string, now time.Time) error {
+	got, err := hex.DecodeString(h.Get("X-Razorpay-Signature"))
+	if err != nil || !hmac.Equal(got, hmacSum([]byte(secret), string(body))) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// parseRazorpay reads payment.captured events.
+func parseRazorpay(body []byte) (*payment, error) {
+	var ev struct {
+		Event   string `json:"event"`
+		Payload struct {
+			Payment struct {
+				Entity struct {
+					ID          string `json:"id"`
+					Amount      int64  `json:"amount"`
+					Currency    string `json:"currency"`
+					Description string `json:"description"`
+					CreatedAt   int64  `json:"created_at"`
+				} `json:"entity"`
+			} `json:"payment"`
+		} `json:"payload"`
+	}
+	err := json.Unmarshal(body, &ev)
+	if err != nil || ev.Event != "payment.captured" {
+		return nil, err
+	}
+	e := ev.Payload.Payment.Entity
+	return &payment{ID: e.ID, Amount: e.Amount, Currency: e.Currency, Description: e.Description, At: time.Unix(e.CreatedAt, 0)}, nil
+}
+
+// majorUnits converts an amount in code's minor unit, e.g. paise or cents,
+// into the currency itself.
+func majorUnits(amount int64, code string) (float64, error) {
+	cur, err := currency.ParseISO(code)
+	if err != nil {
+		return 0, err
+	}
+	scale, _ := currency.Standard.Rounding(cur)
+	return roundMoney(float64(amount) / math.Pow10(scale)), nil
+}
+
+func (trackerDb *trackerDb) addPaymentWebhook(c echo.Context) error {
+	ctx := context.Background()
+
+	hook := new(PaymentWebhook)
+	err := c.Bind(hook)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if _, ok := paymentProviders[hook.Provider]; !ok {
+		return respondError(c, http.StatusBadRequest, "provider must be stripe or razorpay")
+	}
+	if hook.Secret == "" {
+		return respondError(c, http.StatusBadRequest, "secret is required")
+	}
+	hook.ID = uuid.Nil
+
+	_, err = trackerDb.db.NewInsert().Model(hook).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	hook.Secret = ""
+	hook.URL = apiPath(c, "/payments/"+hook.ID.String()+"/webhook")
+
+	return respondCreated(c, "", hook)
+}
+
+func (trackerDb *trackerDb) getAllPaymentWebhooks(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	hooks := []PaymentWebhook{}
+	err := trackerDb.db.NewSelect().
+		Model(&hooks).
+		ExcludeColumn("secret").
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting payment webhooks: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	for i := range hooks {
+		hooks[i].URL = apiPath(c, "/payments/"+hooks[i].ID.String()+"/webhook")
+	}
+
+	return respondOK(c, hooks)
+}
+
+func (trackerDb *trackerDb) deletePaymentWebhook(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("payment_webhook").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Payment webhook not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// receivePayment is the endpoint processors deliver events to. Captured
+// payments in the ledger's currency become cleared income items; others
+// are staged for the user to convert and confirm. Each payment is only
+// recorded once however often it is delivered. Events other than captured
+// payments are acknowledged and ignored.
+func (trackerDb *trackerDb) receivePayment(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	hook := new(PaymentWebhook)
+	err := trackerDb.db.NewSelect().Model(hook).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Payment webhook not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch payment webhook: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPaymentEventSize))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	provider := paymentProviders[hook.Provider]
+	if provider.verify(c.Request().Header, body, hook.Secret, time.Now()) != nil {
+		return respondError(c, http.StatusUnauthorized, "Invalid signature")
+	}
+	p, err := provider.parse(body)
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if p == nil {
+		return respondOK(c, nil)
+	}
+	amount, err := majorUnits(p.Amount, strings.ToUpper(p.Currency))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	event := &PaymentEvent{WebhookID: hook.ID, PaymentID: p.ID}
+	res, err := trackerDb.db.NewInsert().Model(event).On("CONFLICT DO NOTHING").Exec(ctx)
+	if err != nil {
+		log.Printf("Error while recording payment: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondOK(c, nil)
+	}
+
+	event.ItemID, err = trackerDb.recordPayment(ctx, hook, p, amount)
+	if err != nil {
+		log.Printf("Error while recording payment %s: %+v", p.ID, err)
+		// Forget the payment so the processor's retry can record it.
+		_, _ = trackerDb.db.NewDelete().Model(event).WherePK().Exec(ctx)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if event.ItemID != uuid.Nil {
+		_, err = trackerDb.db.NewUpdate().Model(event).Column("item_id").WherePK().Exec(ctx)
+		if err != nil {
+			log.Printf("Error while linking payment %s to its item: %+v", p.ID, err)
+		}
+	}
+
+	return respondOK(c, event)
+}
+
+// recordPayment saves p as an item, or stages it when it isn't in the
+// ledger's currency, and returns the item's id if it made one.
+func (trackerDb *trackerDb) recordPayment(ctx context.Context, hook *PaymentWebhook, p *payment, amount float64) (uuid.UUID, error) {
+	name := p.Description
+	if name == "" {
+		name = fmt.Sprintf("%s payment %s", strings.ToUpper(hook.Provider[:1])+hook.Provider[1:], p.ID)
+	}
+	code := strings.ToUpper(p.Currency)
+	if p.At.Unix() <= 0 {
+		p.At = time.Now()
+	}
+
+	if trackerDb.env.Currency != "" && code != trackerDb.env.Currency {
+		return uuid.Nil, trackerDb.stage(ctx, &StagedItem{
+			UserID:     hook.UserID,
+			Source:     hook.Provider,
+			Name:       name,
+			Cost:       amount,
+			Type:       "credit",
+			CategoryID: hook.CategoryID,
+			OccurredOn: Date{p.At.UTC()},
+			Details:    map[string]interface{}{"payment_id": p.ID, "currency": code, "amount": amount},
+		})
+	}
+
+	item := &Item{
+		Name:       name,
+		Cost:       amount,
+		Type:       "credit",
+		CategoryID: hook.CategoryID,
+		UserID:     hook.UserID,
+		CreatedAt:  p.At.UTC(),
+		Status:     "cleared",
+	}
+	err := trackerDb.createItem(ctx, item, true)
+	return item.ID, err
+}
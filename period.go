@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// period is a half-open [start, end) window over item timestamps. The zero
+// value covers all time.
+type period struct {
+	start time.Time
+	end   time.Time
+}
+
+// parsePeriod accepts "2024", "2024-03", "2024-03-15" or a range of those
+// joined by "..", e.g. "2024-01..2024-03". Both ends of a range cover their
+// whole unit, so "2024-01..2024-03" is January through March.
+func parsePeriod(s string) (period, error) {
+	if s == "" {
+		return period{}, nil
+	}
+
+	from, to, isRange := strings.Cut(s, "..")
+	if !isRange {
+		to = from
+	}
+
+	start, _, err := parsePeriodUnit(from)
+	if err != nil {
+		return period{}, err
+	}
+	_, end, err := parsePeriodUnit(to)
+	if err != nil {
+		return period{}, err
+	}
+	if !end.After(start) {
+		return period{}, fmt.Errorf("period %q ends before it starts", s)
+	}
+
+	return period{start: start, end: end}, nil
+}
+
+var periodLayouts = []struct {
+	layout string
+	next   func(time.Time) time.Time
+}{
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+func parsePeriodUnit(s string) (time.Time, time.Time, error) {
+	for _, l := range periodLayouts {
+		t, err := time.Parse(l.layout, s)
+		if err == nil {
+			return t, l.next(t), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q", s)
+}
+
+func (p period) isZero() bool {
+	return p.start.IsZero() && p.end.IsZero()
+}
+
+// days returns the length of the period in days, or 0 for the zero period.
+func (p period) days() float64 {
+	return p.end.Sub(p.start).Hours() / 24
+}
+
+// where restricts q to rows whose column falls inside the period.
+func (p period) where(q *bun.SelectQuery, column string) *bun.SelectQuery {
+	if p.isZero() {
+		return q
+	}
+	return q.
+		Where("? >= ?", bun.Ident(column), p.start).
+		Where("? < ?", bun.Ident(column), p.end)
+}
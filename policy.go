@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	roleAdmin   = "admin"
+	roleAuditor = "auditor"
+	roleUser    = "user"
+)
+
+// PolicyRule allows or denies a role an action on a resource. Resource is a
+// route path without the /api/vN prefix, e.g. "/items/:id"; a trailing "*"
+// matches any suffix. Action is an HTTP method. "*" matches any role,
+// resource or action.
+type PolicyRule struct {
+	Role     string `json:"role"`
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	Allow    bool   `json:"allow"`
+}
+
+// policy is checked in order and the first matching rule decides. Requests
+// no rule matches are denied.
+type policy []PolicyRule
+
+var defaultPolicy = policy{
+	{Role: roleAdmin, Resource: "*", Action: "*", Allow: true},
+	{Role: roleAuditor, Resource: "*", Action: http.MethodGet, Allow: true},
+	{Role: roleAuditor, Resource: "*", Action: http.MethodHead, Allow: true},
+	{Role: roleAuditor, Resource: "/sheet-link/sync", Action: http.MethodPost, Allow: true},
+	{Role: roleAuditor, Resource: "*", Action: "*", Allow: false},
+	{Role: roleUser, Resource: "/admin/maintenance", Action: http.MethodGet, Allow: true},
+	{Role: roleUser, Resource: "/admin/*", Action: "*", Allow: false},
+	{Role: roleUser, Resource: "*", Action: "*", Allow: true},
+}
+
+// loadPolicy reads the rules from a JSON file, or returns defaultPolicy when
+// no file is configured.
+func loadPolicy(file string) (policy, error) {
+	if file == "" {
+		return defaultPolicy, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p policy
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", file, err)
+	}
+	return p, nil
+}
+
+func matches(pattern, value string) bool {
+	if pattern == "*" || pattern == value {
+		return true
+	}
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	return wildcard && strings.HasPrefix(value, prefix)
+}
+
+func (p policy) allows(role, resource, action string) bool {
+	for _, r := range p {
+		if matches(r.Role, role) && matches(r.Resource, resource) && matches(r.Action, action) {
+			return r.Allow
+		}
+	}
+	return false
+}
+
+// requestRole is admin for requests carrying the X-Admin-Token configured
+// in ADMIN_TOKEN, auditor for those carrying the X-Auditor-Token configured
+// in AUDITOR_TOKEN and user for everything else.
+func (trackerDb *trackerDb) requestRole(c echo.Context) string {
+	if hasToken(c, "X-Admin-Token", trackerDb.env.AdminToken) {
+		return roleAdmin
+	}
+	if hasToken(c, "X-Auditor-Token", trackerDb.env.AuditorToken) {
+		return roleAuditor
+	}
+	return roleUser
+}
+
+func hasToken(c echo.Context, header, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(c.Request().Header.Get(header)), []byte(token)) == 1
+}
+
+// authorize enforces the policy on every route in the group, so handlers
+// don't check roles themselves.
+func (trackerDb *trackerDb) authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		role := trackerDb.requestRole(c)
+		resource := strings.TrimPrefix(c.Path(), apiPath(c, ""))
+		if !trackerDb.policy.allows(role, resource, c.Request().Method) {
+			log.Printf("Denied %s %s to role %s", c.Request().Method, c.Path(), role)
+			return respondError(c, http.StatusForbidden, "You are not allowed to do that")
+		}
+		return next(c)
+	}
+}
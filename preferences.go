@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// UserPreference holds per-user display settings. Locale is a BCP 47 tag,
+// e.g. en-IN, and decides how amounts are written in the weekly summary and
+// the calendar feed.
+type UserPreference struct {
+	bun.BaseModel `bun:"table:user_preference,alias:up"`
+
+	UserID int    `bun:"user_id,pk" json:"user_id"`
+	Locale string `json:"locale"`
+}
+
+var defaultUserPreference = UserPreference{Locale: "en"}
+
+// userLocale returns the user's locale, or English if they haven't set one.
+func (trackerDb *trackerDb) userLocale(ctx context.Context, userID int) (language.Tag, error) {
+	pref := defaultUserPreference
+	pref.UserID = userID
+	err := trackerDb.db.NewSelect().Model(&pref).WherePK().Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return language.English, err
+	}
+	return language.Make(pref.Locale), nil
+}
+
+// moneyFormat writes amounts in the ledger currency the way a locale does,
+// e.g. ₹1,23,456.78 for en-IN and $123,456.78 for en-US.
+type moneyFormat struct {
+	printer *message.Printer
+	symbol  string
+	digits  int
+}
+
+func newMoneyFormat(locale language.Tag, code string) moneyFormat {
+	f := moneyFormat{printer: message.NewPrinter(locale), digits: 2}
+	if unit, err := currency.ParseISO(code); err == nil {
+		f.symbol = f.printer.Sprint(currency.NarrowSymbol(unit.Amount(nil)))
+		f.digits, _ = currency.Standard.Rounding(unit)
+	}
+	return f
+}
+
+func (f moneyFormat) format(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	n := number.Decimal(math.Abs(amount), number.MinFractionDigits(f.digits), number.MaxFractionDigits(f.digits))
+	return sign + f.symbol + f.printer.Sprint(n)
+}
+
+// moneyFormat returns how to write amounts for the user.
+func (trackerDb *trackerDb) moneyFormat(ctx context.Context, userID int) (moneyFormat, error) {
+	locale, err := trackerDb.userLocale(ctx, userID)
+	return newMoneyFormat(locale, trackerDb.env.Currency), err
+}
+
+func (trackerDb *trackerDb) putPreferences(c echo.Context) error {
+	ctx := context.Background()
+
+	pref := new(UserPreference)
+	*pref = defaultUserPreference
+	err := c.Bind(pref)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	locale, err := language.Parse(pref.Locale)
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "locale must be a language tag like en-IN")
+	}
+	pref.Locale = locale.String()
+
+	_, err = trackerDb.db.NewInsert().
+		Model(pref).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("locale = EXCLUDED.locale").
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, pref)
+}
+
+func (trackerDb *trackerDb) getPreferences(c echo.Context) error {
+	ctx := context.Background()
+	userID, err := strconv.Atoi(c.QueryParam("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+
+	pref := defaultUserPreference
+	pref.UserID = userID
+	err = trackerDb.db.NewSelect().Model(&pref).WherePK().Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Could not fetch preferences: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, pref)
+}
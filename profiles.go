@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"github.com/uptrace/bun/schema"
+)
+
+// profileHeader selects which of a user's ledgers a request works on.
+// Without it requests use the default ledger, whose items have no profile.
+const profileHeader = "X-Profile-ID"
+
+// Profile is a separate ledger, e.g. business expenses kept apart from
+// personal ones.
+type Profile struct {
+	bun.BaseModel `bun:"table:profile,alias:p"`
+
+	ID        uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID    int       `bun:"user_id" json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// profileScope resolves the X-Profile-ID header for the handlers behind it.
+// The profile must belong to the user_id the request names. Requests that
+// name none where requestUserID looks, like deletes by id and uploads, are
+// checked when they write an item.
+func (trackerDb *trackerDb) profileScope(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Request().Header.Get(profileHeader)
+		if header == "" {
+			return next(c)
+		}
+
+		id, err := uuid.Parse(header)
+		if err != nil {
+			return respondError(c, http.StatusBadRequest, profileHeader+" must be a UUID")
+		}
+		q := trackerDb.db.NewSelect().Model((*Profile)(nil)).Where("id = ?", id)
+		if userID := requestUserID(c); userID != "" {
+			q = q.Where("user_id = ?", userID)
+		}
+		exists, err := q.Exists(context.Background())
+		if err != nil {
+			log.Printf("Could not fetch profile: %+v", err)
+			return respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		if !exists {
+			return respondError(c, http.StatusNotFound, "Profile not found")
+		}
+
+		c.Set("profile_id", id)
+		return next(c)
+	}
+}
+
+// userIDBodyLimit is how much of a JSON body requestUserID reads looking
+// for a user_id. Larger bodies are passed on unread and name no user.
+const userIDBodyLimit = 64 << 10
+
+// requestUserID is the user_id a request names in its query string,
+// urlencoded form or JSON body, or "" if it names none. Multipart bodies
+// are left for the handler to parse, and what was read of a JSON body is
+// put back for it.
+func requestUserID(c echo.Context) string {
+	if id := c.QueryParam("user_id"); id != "" {
+		return id
+	}
+	req := c.Request()
+	contentType := req.Header.Get(echo.HeaderContentType)
+	if strings.HasPrefix(contentType, echo.MIMEApplicationForm) {
+		return c.FormValue("user_id")
+	}
+	if req.Body == nil || !strings.HasPrefix(contentType, echo.MIMEApplicationJSON) {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, userIDBodyLimit+1))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+	if err != nil || len(body) > userIDBodyLimit {
+		return ""
+	}
+
+	var named struct {
+		UserID interface{} `json:"user_id"`
+	}
+	if json.Unmarshal(body, &named) != nil || named.UserID == nil {
+		return ""
+	}
+	return fmt.Sprint(named.UserID)
+}
+
+// ownsProfile reports whether the profile is one of the user's.
+func ownsProfile(ctx context.Context, db bun.IDB, userID int, id uuid.UUID) (bool, error) {
+	return db.NewSelect().
+		Model((*Profile)(nil)).
+		Where("id = ?", id).
+		Where("user_id = ?", userID).
+		Exists(ctx)
+}
+
+// currentProfile is the profile the request selected, or uuid.Nil for the
+// default ledger.
+func currentProfile(c echo.Context) uuid.UUID {
+	id, _ := c.Get("profile_id").(uuid.UUID)
+	return id
+}
+
+// inProfile restricts an item query to one ledger.
+func inProfile(id uuid.UUID) func(*bun.SelectQuery) *bun.SelectQuery {
+	return func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where("?", profileCond("profile_id", id))
+	}
+}
+
+// profileCond is the condition that column is the ledger id, for queries
+// inProfile can't be applied to.
+func profileCond(column string, id uuid.UUID) schema.QueryWithArgs {
+	if id == uuid.Nil {
+		return bun.SafeQuery("? IS NULL", bun.Ident(column))
+	}
+	return bun.SafeQuery("? = ?", bun.Ident(column), id)
+}
+
+func (trackerDb *trackerDb) addProfile(c echo.Context) error {
+	ctx := context.Background()
+
+	profile := new(Profile)
+	err := c.Bind(profile)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if profile.Name == "" {
+		return respondError(c, http.StatusBadRequest, "name is required")
+	}
+	profile.ID = uuid.Nil
+
+	_, err = trackerDb.db.NewInsert().Model(profile).Returning("*").Exec(ctx)
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) && pgErr.Field('C') == "23505" {
+		return respondError(c, http.StatusConflict, "A profile with that name already exists")
+	}
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, "", profile)
+}
+
+func (trackerDb *trackerDb) getAllProfiles(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	profiles := []Profile{}
+	err := trackerDb.db.NewSelect().Model(&profiles).Where("user_id = ?", userID).Order("created_at").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting profiles: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, profiles)
+}
+
+// deleteProfile only removes empty profiles; items have to be deleted or
+// moved first.
+func (trackerDb *trackerDb) deleteProfile(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("profile").Where("id = ?", id).Exec(ctx)
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) && pgErr.Field('C') == "23503" {
+		return respondError(c, http.StatusConflict, "Profile still has items")
+	}
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Profile not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+//go:build integration
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// createTestProfile adds a profile for the user through POST
+// /api/v2/profiles.
+func createTestProfile(t *testing.T, userID int, name string) Profile {
+	t.Helper()
+
+	rec := request(t, http.MethodPost, "/api/v2/profiles", map[string]interface{}{"user_id": userID, "name": name})
+	expectStatus(t, rec, http.StatusCreated)
+	var profile Profile
+	decodeData(t, rec, &profile)
+	return profile
+}
+
+func TestProfileLedger(t *testing.T) {
+	userID := newTestUser(t)
+	profile := createTestProfile(t, userID, "Business")
+	createTestItem(t, userID, nil)
+
+	rec := request(t, http.MethodPost, "/api/v2/items", map[string]interface{}{
+		"name": "Printer", "cost": 9000.0, "type": "debit", "user_id": userID,
+	}, profileHeader, profile.ID.String())
+	expectStatus(t, rec, http.StatusCreated)
+	var item ItemV2
+	decodeData(t, rec, &item)
+	if item.ProfileID == nil || *item.ProfileID != profile.ID {
+		t.Errorf("item is in profile %v, want %s", item.ProfileID, profile.ID)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/items?user_id=%d", userID), nil, profileHeader, profile.ID.String())
+	expectStatus(t, rec, http.StatusOK)
+	var items []ItemV2
+	decodeData(t, rec, &items)
+	if len(items) != 1 || items[0].ID != item.ID {
+		t.Errorf("profile lists %+v, want just the printer", items)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/profiles?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var profiles []Profile
+	decodeData(t, rec, &profiles)
+	if len(profiles) != 1 || profiles[0].ID != profile.ID {
+		t.Errorf("profiles are %+v, want just %s", profiles, profile.ID)
+	}
+
+	empty := createTestProfile(t, userID, "Side project")
+	rec = request(t, http.MethodDelete, "/api/v2/profiles/"+empty.ID.String(), nil)
+	expectStatus(t, rec, http.StatusNoContent)
+}
+
+func TestProfileErrors(t *testing.T) {
+	userID := newTestUser(t)
+	profile := createTestProfile(t, userID, "Business")
+
+	rec := request(t, http.MethodPost, "/api/v2/profiles", map[string]interface{}{"user_id": userID, "name": "Business"})
+	expectStatus(t, rec, http.StatusConflict)
+
+	// Someone else's profile.
+	other := newTestUser(t)
+	rec = request(t, http.MethodPost, "/api/v2/items", map[string]interface{}{
+		"name": "Printer", "cost": 9000.0, "type": "debit", "user_id": other,
+	}, profileHeader, profile.ID.String())
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// A profile with items can't be deleted.
+	rec = request(t, http.MethodPost, "/api/v2/items", map[string]interface{}{
+		"name": "Printer", "cost": 9000.0, "type": "debit", "user_id": userID,
+	}, profileHeader, profile.ID.String())
+	expectStatus(t, rec, http.StatusCreated)
+	rec = request(t, http.MethodDelete, "/api/v2/profiles/"+profile.ID.String(), nil)
+	expectStatus(t, rec, http.StatusConflict)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+// QuotaExceeded is returned with a 403 when a write would take a user past
+// one of the per-user limits configured for the instance.
+type QuotaExceeded struct {
+	Resource string `json:"resource"`
+	Limit    int    `json:"limit"`
+}
+
+func (e *QuotaExceeded) Error() string {
+	return fmt.Sprintf("You have reached this instance's limit of %d %s; delete some before adding more", e.Limit, e.Resource)
+}
+
+// checkQuota fails with a *QuotaExceeded if the user already has limit rows
+// in table. A limit of 0 means no limit.
+func checkQuota(ctx context.Context, db bun.IDB, table, resource string, userID, limit int) error {
+	if limit == 0 {
+		return nil
+	}
+
+	n, err := db.NewSelect().TableExpr(table).Where("user_id = ?", userID).Count(ctx)
+	if err != nil {
+		return err
+	}
+	if n >= limit {
+		return &QuotaExceeded{Resource: resource, Limit: limit}
+	}
+	return nil
+}
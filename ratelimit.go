@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// rateLimitWindow is how long a client's request count runs before it is
+// reset.
+const rateLimitWindow = time.Minute
+
+// rateLimiter counts requests per client in fixed one-minute windows and
+// refuses them with 429 once a client has used up its limit. Requests
+// aren't authenticated yet, so a client is its IP address. Counts are kept
+// in memory, so each replica enforces the limit on its own.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	clients map[string]*rateWindow
+	swept   time.Time
+}
+
+type rateWindow struct {
+	count int
+	reset time.Time
+}
+
+// RateLimitStatus is a client's standing in the current window. Limit is 0
+// when the instance has no rate limit.
+type RateLimitStatus struct {
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+func newRateLimiter(limit int) *rateLimiter {
+	return &rateLimiter{limit: limit, clients: map[string]*rateWindow{}}
+}
+
+// take counts one request from client and returns its status afterwards.
+// The request is allowed if Remaining is not negative.
+func (l *rateLimiter) take(client string, now time.Time) RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget clients whose window has run out, so the map doesn't grow
+	// with every address ever seen.
+	if now.Sub(l.swept) > rateLimitWindow {
+		for k, w := range l.clients {
+			if !now.Before(w.reset) {
+				delete(l.clients, k)
+			}
+		}
+		l.swept = now
+	}
+
+	w := l.clients[client]
+	if w == nil || !now.Before(w.reset) {
+		w = &rateWindow{reset: now.Add(rateLimitWindow)}
+		l.clients[client] = w
+	}
+	w.count++
+	return l.status(w)
+}
+
+// peek returns client's status without counting a request.
+func (l *rateLimiter) peek(client string, now time.Time) RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := l.clients[client]
+	if w == nil || !now.Before(w.reset) {
+		w = &rateWindow{reset: now.Add(rateLimitWindow)}
+	}
+	return l.status(w)
+}
+
+func (l *rateLimiter) status(w *rateWindow) RateLimitStatus {
+	return RateLimitStatus{Limit: l.limit, Used: w.count, Remaining: l.limit - w.count, Reset: w.reset}
+}
+
+// middleware counts every request and reports the client's standing in
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (Unix
+// seconds), so clients can back off before they are refused.
+func (l *rateLimiter) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if l.limit == 0 {
+			return next(c)
+		}
+
+		now := time.Now()
+		s := l.take(c.RealIP(), now)
+		h := c.Response().Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(s.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(max(s.Remaining, 0)))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(s.Reset.Unix(), 10))
+		if s.Remaining < 0 {
+			h.Set("Retry-After", strconv.Itoa(int(s.Reset.Sub(now).Seconds())+1))
+			s.Remaining = 0
+			return c.JSON(http.StatusTooManyRequests, Envelope{Message: localize(c, "Too many requests; slow down and try again after the reset time"), Data: s})
+		}
+		return next(c)
+	}
+}
+
+// getRateLimit reports the caller's limit, what is left of it and when it
+// resets. The request itself has already been counted.
+func (trackerDb *trackerDb) getRateLimit(c echo.Context) error {
+	s := trackerDb.rateLimit.peek(c.RealIP(), time.Now())
+	s.Remaining = max(s.Remaining, 0)
+	return respondOK(c, s)
+}
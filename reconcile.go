@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+func (trackerDb *trackerDb) clearItem(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	var item GetItem
+	err := trackerDb.db.NewUpdate().
+		TableExpr("item").
+		Set("status = 'cleared'").
+		Where("id = ?", id).
+		Where("status = 'pending'").
+		Returning("*").
+		Scan(ctx, &item)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "No pending item with that id")
+	}
+	if err != nil {
+		log.Printf("Error while clearing item: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, item)
+}
+
+type ReconcileRequest struct {
+	UserID           int     `json:"user_id"`
+	StatementBalance float64 `json:"statement_balance"`
+}
+
+type ReconcileResult struct {
+	ClearedBalance   float64 `json:"cleared_balance"`
+	StatementBalance float64 `json:"statement_balance"`
+	Difference       float64 `json:"difference"`
+	Reconciled       int64   `json:"reconciled"`
+}
+
+var errBalanceMismatch = errors.New("cleared items do not add up to the statement balance")
+
+// reconcile checks that the user's cleared and previously reconciled items
+// add up to the statement balance and, if they do, locks the cleared ones in
+// as reconciled. There are no accounts yet, so the whole ledger, the one
+// X-Profile-ID selects, is one statement.
+func (trackerDb *trackerDb) reconcile(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(ReconcileRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	inLedger := profileCond("profile_id", currentProfile(c))
+	result := ReconcileResult{StatementBalance: req.StatementBalance}
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			ColumnExpr("COALESCE(SUM(CASE WHEN type = 'credit' THEN cost ELSE -cost END), 0)").
+			TableExpr("item").
+			Where("user_id = ?", req.UserID).
+			Where("?", inLedger).
+			Where("status IN ('cleared', 'reconciled')").
+			Scan(ctx, &result.ClearedBalance)
+		if err != nil {
+			return err
+		}
+
+		result.Difference = roundMoney(req.StatementBalance - result.ClearedBalance)
+		if result.Difference != 0 {
+			return errBalanceMismatch
+		}
+
+		res, err := tx.NewUpdate().
+			TableExpr("item").
+			Set("status = 'reconciled'").
+			Where("user_id = ?", req.UserID).
+			Where("?", inLedger).
+			Where("status = 'cleared'").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		result.Reconciled, err = res.RowsAffected()
+		return err
+	})
+	if errors.Is(err, errBalanceMismatch) {
+		return c.JSON(http.StatusConflict, Envelope{Message: err.Error(), Data: result})
+	}
+	if err != nil {
+		log.Printf("Error while reconciling: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, result)
+}
+
+type AdjustRequest struct {
+	UserID  int     `json:"user_id"`
+	Balance float64 `json:"balance"`
+}
+
+// adjustBalance adds an adjustment item that brings the user's computed
+// balance in the X-Profile-ID ledger in line with the real one, e.g. after
+// untracked cash spending. Adjustments are left out of analytics by
+// default.
+func (trackerDb *trackerDb) adjustBalance(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(AdjustRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	profile := currentProfile(c)
+	var balance float64
+	err = trackerDb.db.NewSelect().
+		ColumnExpr("COALESCE(SUM(CASE WHEN type = 'credit' THEN cost ELSE -cost END), 0)").
+		TableExpr("item").
+		Where("user_id = ?", req.UserID).
+		Apply(inProfile(profile)).
+		Where("NOT scheduled").
+		Scan(ctx, &balance)
+	if err != nil {
+		log.Printf("Error while getting balance: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	diff := roundMoney(req.Balance - balance)
+	if diff == 0 {
+		return c.JSON(http.StatusOK, Envelope{Message: "balance already matches"})
+	}
+
+	item := &Item{
+		Name:       "Balance adjustment",
+		Cost:       math.Abs(diff),
+		Type:       "credit",
+		UserID:     req.UserID,
+		Status:     "cleared",
+		Adjustment: true,
+		ProfileID:  profile,
+	}
+	if diff < 0 {
+		item.Type = "debit"
+	}
+
+	err = trackerDb.createItem(ctx, item, c.QueryParam("override_cap") == "true")
+	if err != nil {
+		return respondItemError(c, err, "adjusting balance")
+	}
+
+	return respondCreated(c, apiPath(c, "/items/"+item.ID.String()), item)
+}
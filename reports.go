@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+type TaxSummaryRow struct {
+	Quarter          string  `bun:"quarter" json:"quarter"`
+	TaxablePurchases float64 `bun:"taxable_purchases" json:"taxable_purchases"`
+	InputTax         float64 `bun:"input_tax" json:"input_tax"`
+	TaxableSales     float64 `bun:"taxable_sales" json:"taxable_sales"`
+	OutputTax        float64 `bun:"output_tax" json:"output_tax"`
+	NetTax           float64 `bun:"-" json:"net_tax"`
+}
+
+// getTaxSummary totals GST/VAT per quarter over items that carry a tax
+// amount: input tax paid on debits and output tax collected on credits.
+func (trackerDb *trackerDb) getTaxSummary(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	rows := []TaxSummaryRow{}
+	q := trackerDb.reports.NewSelect().
+		ColumnExpr("TO_CHAR(created_at, 'YYYY-\"Q\"Q') AS quarter").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'debit'), 0) AS taxable_purchases").
+		ColumnExpr("COALESCE(SUM(tax_amount) FILTER (WHERE type = 'debit'), 0) AS input_tax").
+		ColumnExpr("COALESCE(SUM(cost) FILTER (WHERE type = 'credit'), 0) AS taxable_sales").
+		ColumnExpr("COALESCE(SUM(tax_amount) FILTER (WHERE type = 'credit'), 0) AS output_tax").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Where("tax_amount IS NOT NULL").
+		Group("quarter").
+		Order("quarter")
+	err = p.where(q, "created_at").Scan(ctx, &rows)
+	if err != nil {
+		log.Printf("Error while getting tax summary: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	for i := range rows {
+		rows[i].NetTax = rows[i].OutputTax - rows[i].InputTax
+	}
+
+	return respondOK(c, rows)
+}
+
+type IncomeStatementLine struct {
+	Type     string  `bun:"type" json:"-"`
+	Category string  `bun:"category" json:"category"`
+	Amount   float64 `bun:"amount" json:"amount"`
+}
+
+// IncomeStatement is income and expenses per category over a period, and
+// the net income left.
+type IncomeStatement struct {
+	From          Date                  `json:"from"`
+	To            Date                  `json:"to"`
+	Income        []IncomeStatementLine `json:"income"`
+	TotalIncome   float64               `json:"total_income"`
+	Expenses      []IncomeStatementLine `json:"expenses"`
+	TotalExpenses float64               `json:"total_expenses"`
+	NetIncome     float64               `json:"net_income"`
+}
+
+// getIncomeStatement reports the user's income and expenses by category
+// over ?period=, which is required. It counts what analytics counts, so
+// reimbursed expenses, adjustments and excluded items are left out.
+func (trackerDb *trackerDb) getIncomeStatement(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if p.isZero() {
+		return respondError(c, http.StatusBadRequest, "period is required")
+	}
+
+	lines := []IncomeStatementLine{}
+	q := trackerDb.reports.NewSelect().
+		ColumnExpr("i.type").
+		ColumnExpr("COALESCE(c.name, 'Uncategorized') AS category").
+		ColumnExpr("SUM(i.cost) AS amount").
+		TableExpr("item i").
+		Join("LEFT JOIN category c ON i.category_id = c.id").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
+		GroupExpr("i.type, c.name").
+		OrderExpr("amount DESC")
+	err = p.where(q, "i.created_at").Scan(ctx, &lines)
+	if err != nil {
+		log.Printf("Error while getting income statement: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	statement := IncomeStatement{
+		From:     Date{p.start},
+		To:       Date{p.end.AddDate(0, 0, -1)},
+		Income:   []IncomeStatementLine{},
+		Expenses: []IncomeStatementLine{},
+	}
+	for _, l := range lines {
+		l.Amount = roundMoney(l.Amount)
+		if l.Type == "credit" {
+			statement.Income = append(statement.Income, l)
+			statement.TotalIncome += l.Amount
+		} else {
+			statement.Expenses = append(statement.Expenses, l)
+			statement.TotalExpenses += l.Amount
+		}
+	}
+	statement.TotalIncome = roundMoney(statement.TotalIncome)
+	statement.TotalExpenses = roundMoney(statement.TotalExpenses)
+	statement.NetIncome = roundMoney(statement.TotalIncome - statement.TotalExpenses)
+
+	return respondOK(c, statement)
+}
+
+type BalanceSheetLine struct {
+	Name   string  `bun:"name" json:"name"`
+	Amount float64 `bun:"amount" json:"amount"`
+}
+
+// BalanceSheet is what the user owns and owes at the end of AsOf. Equity
+// is what is left of the assets once the liabilities are paid.
+type BalanceSheet struct {
+	AsOf             Date               `json:"as_of"`
+	Assets           []BalanceSheetLine `json:"assets"`
+	TotalAssets      float64            `json:"total_assets"`
+	Liabilities      []BalanceSheetLine `json:"liabilities"`
+	TotalLiabilities float64            `json:"total_liabilities"`
+	Equity           float64            `json:"equity"`
+}
+
+// loanBalance is what is outstanding with one counterparty in one
+// direction.
+type loanBalance struct {
+	Counterparty string  `bun:"counterparty"`
+	Direction    string  `bun:"direction"`
+	Outstanding  float64 `bun:"outstanding"`
+}
+
+// getBalanceSheet reports the user's position at the end of ?as_of=
+// (today by default). The tracker has no accounts, so the sheet is built
+// from what it does know: cash is the balance of items not charged to a
+// card, each card's unpaid charges are a liability, and loans are a
+// receivable or a liability by direction. Cash and card balances are for
+// the X-Profile-ID ledger.
+func (trackerDb *trackerDb) getBalanceSheet(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+	profile := currentProfile(c)
+
+	asOf := Date{today()}
+	if s := c.QueryParam("as_of"); s != "" {
+		if asOf.parse(s) != nil {
+			return respondError(c, http.StatusBadRequest, "as_of must be a date like 2024-03-31")
+		}
+	}
+	end := asOf.AddDate(0, 0, 1)
+
+	var cash float64
+	err := trackerDb.reports.NewSelect().
+		ColumnExpr("COALESCE(SUM(CASE WHEN type = 'credit' THEN cost ELSE -cost END), 0)").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Apply(inProfile(profile)).
+		Where("card_id IS NULL").
+		Where("created_at < ?", end).
+		Scan(ctx, &cash)
+	if err != nil {
+		log.Printf("Error while getting balance sheet: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	cards := []BalanceSheetLine{}
+	err = trackerDb.reports.NewSelect().
+		ColumnExpr("cr.name").
+		ColumnExpr("SUM(CASE WHEN i.type = 'debit' THEN i.cost ELSE -i.cost END) AS amount").
+		TableExpr("credit_card AS cr").
+		Join("JOIN item AS i ON i.card_id = cr.id").
+		Where("cr.user_id = ?", userID).
+		Where("?", profileCond("i.profile_id", profile)).
+		Where("i.created_at < ?", end).
+		GroupExpr("cr.id, cr.name").
+		OrderExpr("cr.name").
+		Scan(ctx, &cards)
+	if err != nil {
+		log.Printf("Error while getting balance sheet: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	loans := []loanBalance{}
+	err = trackerDb.reports.NewRaw(`
+		SELECT l.counterparty, l.direction, SUM(l.amount - COALESCE(r.repaid, 0)) AS outstanding
+		FROM loan AS l
+		LEFT JOIN LATERAL (
+			SELECT SUM(cost) AS repaid FROM item WHERE loan_id = l.id AND created_at < ?
+		) AS r ON true
+		WHERE l.user_id = ? AND l.created_at < ?
+		GROUP BY l.counterparty, l.direction
+		ORDER BY l.counterparty`,
+		end, userID, end,
+	).Scan(ctx, &loans)
+	if err != nil {
+		log.Printf("Error while getting balance sheet: %+v", err)
+		return respondQueryError(c, err)
+	}
+
+	sheet := BalanceSheet{
+		AsOf:        asOf,
+		Assets:      []BalanceSheetLine{{Name: "Cash", Amount: roundMoney(cash)}},
+		Liabilities: []BalanceSheetLine{},
+	}
+	for _, card := range cards {
+		card.Amount = roundMoney(card.Amount)
+		if card.Amount > 0 {
+			sheet.Liabilities = append(sheet.Liabilities, card)
+		} else if card.Amount < 0 {
+			// Overpaid, so the card owes the user.
+			sheet.Assets = append(sheet.Assets, BalanceSheetLine{Name: card.Name, Amount: -card.Amount})
+		}
+	}
+	for _, l := range loans {
+		amount := roundMoney(l.Outstanding)
+		if amount <= 0 {
+			continue
+		}
+		if l.Direction == "lent" {
+			sheet.Assets = append(sheet.Assets, BalanceSheetLine{Name: "Lent to " + l.Counterparty, Amount: amount})
+		} else {
+			sheet.Liabilities = append(sheet.Liabilities, BalanceSheetLine{Name: "Borrowed from " + l.Counterparty, Amount: amount})
+		}
+	}
+
+	for _, a := range sheet.Assets {
+		sheet.TotalAssets += a.Amount
+	}
+	for _, l := range sheet.Liabilities {
+		sheet.TotalLiabilities += l.Amount
+	}
+	sheet.TotalAssets = roundMoney(sheet.TotalAssets)
+	sheet.TotalLiabilities = roundMoney(sheet.TotalLiabilities)
+	sheet.Equity = roundMoney(sheet.TotalAssets - sheet.TotalLiabilities)
+
+	return respondOK(c, sheet)
+}
@@ -0,0 +1,50 @@
+//go:build integration
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestBalanceSheet(t *testing.T) {
+	userID := newTestUser(t)
+	createTestItem(t, userID, map[string]interface{}{"name": "Salary", "cost": 1000.0, "type": "credit"})
+	card := createTestCard(t, userID)
+	createTestItem(t, userID, map[string]interface{}{"name": "Groceries", "cost": 300.0, "card_id": card.ID})
+
+	rec := request(t, http.MethodPost, "/api/v2/loans", map[string]interface{}{
+		"user_id": userID, "counterparty": "Asha", "direction": "lent", "amount": 200.0,
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var loan Loan
+	decodeData(t, rec, &loan)
+	createTestItem(t, userID, map[string]interface{}{"name": "Asha repaid", "cost": 50.0, "type": "credit", "loan_id": loan.ID})
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/reports/balance-sheet?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var sheet BalanceSheet
+	decodeData(t, rec, &sheet)
+	// The groceries went on the card, so they are owed rather than paid.
+	wantAssets := []BalanceSheetLine{{"Cash", 1050}, {"Lent to Asha", 150}}
+	wantLiabilities := []BalanceSheetLine{{"Visa", 300}}
+	if !reflect.DeepEqual(sheet.Assets, wantAssets) || !reflect.DeepEqual(sheet.Liabilities, wantLiabilities) {
+		t.Errorf("balance sheet is %+v, want assets %+v and liabilities %+v", sheet, wantAssets, wantLiabilities)
+	}
+	if sheet.TotalAssets != 1200 || sheet.TotalLiabilities != 300 || sheet.Equity != 900 {
+		t.Errorf("totals are %v and %v with equity %v, want 1200, 300 and 900", sheet.TotalAssets, sheet.TotalLiabilities, sheet.Equity)
+	}
+
+	// Before any of it happened.
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/reports/balance-sheet?user_id=%d&as_of=2020-01-01", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	decodeData(t, rec, &sheet)
+	if sheet.Equity != 0 || len(sheet.Liabilities) != 0 {
+		t.Errorf("balance sheet in 2020 is %+v, want it empty", sheet)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/reports/balance-sheet?user_id=%d&as_of=March", userID), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// API versions reported in the API-Version header. v1 went to 1.1 when all
+// endpoints moved to Envelope.
+const (
+	apiV1Version = "1.1"
+	apiV2Version = "2.0"
+)
+
+// Envelope is the body of every JSON response. Message is "ok" on success
+// and says what went wrong otherwise. Meta is only set on paginated lists.
+type Envelope struct {
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+	Meta    *PageMeta   `json:"meta,omitempty"`
+}
+
+type PageMeta struct {
+	Total   int           `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+	Summary *ItemsSummary `json:"summary,omitempty"`
+}
+
+func apiVersionHeader(version string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set("API-Version", version)
+			return next(c)
+		}
+	}
+}
+
+// deprecated marks responses from an API version that has a successor, so
+// clients can notice before it goes away.
+func deprecated(successor string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set("Deprecation", "true")
+			c.Response().Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+			return next(c)
+		}
+	}
+}
+
+// respondOK writes data in an Envelope, or as CSV when the client asks for
+// CSV.
+func respondOK(c echo.Context, data interface{}) error {
+	if wantsCSV(c) {
+		return writeCSV(c, http.StatusOK, data)
+	}
+
+	return c.JSON(http.StatusOK, Envelope{Message: "ok", Data: data})
+}
+
+// respondPage is respondOK for one page of a longer list.
+func respondPage(c echo.Context, data interface{}, meta PageMeta) error {
+	if wantsCSV(c) {
+		return writeCSV(c, http.StatusOK, data)
+	}
+
+	return c.JSON(http.StatusOK, Envelope{Message: "ok", Data: data, Meta: &meta})
+}
+
+// respondCreated answers a create with 201 and the new resource and, when
+// the resource can be fetched on its own, a Location header pointing at it.
+func respondCreated(c echo.Context, location string, data interface{}) error {
+	if location != "" {
+		c.Response().Header().Set(echo.HeaderLocation, location)
+	}
+
+	return c.JSON(http.StatusCreated, Envelope{Message: "ok", Data: data})
+}
+
+// respondError answers with an error message in the client's language.
+func respondError(c echo.Context, code int, message string) error {
+	return c.JSON(code, Envelope{Message: localize(c, message)})
+}
+
+// respondQueryError answers a failed analytics or report query: 504 if it
+// ran out of time, so the client knows to ask for less, and 500 otherwise.
+func respondQueryError(c echo.Context, err error) error {
+	if queryTimedOut(err) {
+		return respondError(c, http.StatusGatewayTimeout, "This report took too long; try a shorter period or fewer filters")
+	}
+	return respondError(c, http.StatusInternalServerError, "Internal server error")
+}
+
+// pageParams reads ?limit= and ?offset=. A limit of 0 means the client did
+// not ask for a page.
+func pageParams(c echo.Context) (limit, offset int, ok bool) {
+	var err error
+	if l := c.QueryParam("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > 1000 {
+			return 0, 0, false
+		}
+	}
+	if o := c.QueryParam("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+// boolParam reads an optional true/false query parameter. It returns nil
+// when the parameter is absent and ok false when it is not a boolean.
+func boolParam(c echo.Context, name string) (v *bool, ok bool) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return nil, true
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, false
+	}
+	return &b, true
+}
+
+// apiPath prefixes path with the API version of the current route, so
+// handlers shared between versions link within their own version.
+func apiPath(c echo.Context, path string) string {
+	parts := strings.SplitN(c.Path(), "/", 4)
+	if len(parts) < 3 || parts[1] != "api" {
+		return path
+	}
+	return "/api/" + parts[2] + path
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// itemHistoryKeep is how far back item history, and so a restore, reaches.
+const itemHistoryKeep = 90 * 24 * time.Hour
+
+// RestoreRequest asks for one user's items to be put back as they were at
+// At. Nothing changes unless Confirm is the token returned by a dry run for
+// the same time.
+type RestoreRequest struct {
+	At      time.Time `json:"at"`
+	DryRun  bool      `json:"dry_run"`
+	Confirm string    `json:"confirm"`
+}
+
+// RestorePlan is what a restore does: items created since At are removed,
+// items deleted since are recreated and items changed since are reverted.
+type RestorePlan struct {
+	UserID   int          `json:"user_id"`
+	At       time.Time    `json:"at"`
+	Remove   []GetItem    `json:"remove"`
+	Recreate []GetItem    `json:"recreate"`
+	Revert   []ItemRevert `json:"revert"`
+	Confirm  string       `json:"confirm,omitempty"`
+	Restored bool         `json:"restored"`
+}
+
+// ItemRevert is an item as it is now and as it will be after the restore.
+type ItemRevert struct {
+	Current  GetItem `json:"current"`
+	Restored GetItem `json:"restored"`
+}
+
+var errRestoreChanged = errors.New("the user's items changed since the dry run; run it again")
+
+// firstChanges selects, for each of the user's items changed after at, the
+// first change: its old row is the item as it was at at, or NULL if the
+// item didn't exist yet.
+func firstChanges(db bun.IDB, userID int, at time.Time) *bun.SelectQuery {
+	return db.NewSelect().
+		DistinctOn("item_id").
+		Column("item_id", "old").
+		TableExpr("item_history").
+		Where("user_id = ?", userID).
+		Where("changed_at > ?", at).
+		OrderExpr("item_id, id")
+}
+
+// planRestore works out what restoring userID's items to at would change.
+func planRestore(ctx context.Context, db bun.IDB, userID int, at time.Time) (RestorePlan, error) {
+	plan := RestorePlan{UserID: userID, At: at, Remove: []GetItem{}, Recreate: []GetItem{}, Revert: []ItemRevert{}}
+	changes := firstChanges(db, userID, at)
+
+	err := db.NewSelect().
+		ColumnExpr("i.*").
+		TableExpr("item AS i").
+		Join("JOIN (?) AS f ON f.item_id = i.id", changes).
+		Where("f.old IS NULL").
+		OrderExpr("i.id").
+		Scan(ctx, &plan.Remove)
+	if err != nil {
+		return plan, err
+	}
+
+	err = db.NewRaw(`
+		SELECT r.* FROM (?) AS f, jsonb_populate_record(NULL::item, f.old) AS r
+		WHERE f.old IS NOT NULL AND NOT EXISTS (SELECT 1 FROM item WHERE id = f.item_id)
+		ORDER BY r.id`, changes).
+		Scan(ctx, &plan.Recreate)
+	if err != nil {
+		return plan, err
+	}
+
+	var current, restored []GetItem
+	err = db.NewSelect().
+		ColumnExpr("i.*").
+		TableExpr("item AS i").
+		Join("JOIN (?) AS f ON f.item_id = i.id", changes).
+		Where("f.old IS NOT NULL AND to_jsonb(i) <> f.old").
+		OrderExpr("i.id").
+		Scan(ctx, &current)
+	if err != nil {
+		return plan, err
+	}
+	err = db.NewRaw(`
+		SELECT r.* FROM item AS i
+		JOIN (?) AS f ON f.item_id = i.id, jsonb_populate_record(NULL::item, f.old) AS r
+		WHERE f.old IS NOT NULL AND to_jsonb(i) <> f.old
+		ORDER BY i.id`, changes).
+		Scan(ctx, &restored)
+	if err != nil {
+		return plan, err
+	}
+	for i := range min(len(current), len(restored)) {
+		plan.Revert = append(plan.Revert, ItemRevert{Current: current[i], Restored: restored[i]})
+	}
+	return plan, nil
+}
+
+// token identifies exactly what the plan changes, so a restore only goes
+// ahead if it would do what the dry run showed.
+func (p RestorePlan) token() string {
+	p.Confirm = ""
+	b, _ := json.Marshal(p)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// applyRestore carries out the restore planRestore describes. The changes
+// it makes are themselves recorded in the history, so a restore can be
+// undone by restoring to just before it.
+func applyRestore(ctx context.Context, db bun.IDB, userID int, at time.Time) error {
+	changes := firstChanges(db, userID, at)
+
+	_, err := db.NewRaw(`
+		DELETE FROM item AS i USING (?) AS f
+		WHERE f.item_id = i.id AND f.old IS NULL`, changes).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewRaw(`
+		INSERT INTO item
+		SELECT r.* FROM (?) AS f, jsonb_populate_record(NULL::item, f.old) AS r
+		WHERE f.old IS NOT NULL AND NOT EXISTS (SELECT 1 FROM item WHERE id = f.item_id)`, changes).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+	err = db.NewSelect().
+		Column("column_name").
+		TableExpr("information_schema.columns").
+		Where("table_schema = current_schema()").
+		Where("table_name = 'item'").
+		Where("column_name <> 'id'").
+		Scan(ctx, &columns)
+	if err != nil {
+		return err
+	}
+	sets := make([]string, len(columns))
+	for i, col := range columns {
+		ident := `"` + strings.ReplaceAll(col, `"`, `""`) + `"`
+		sets[i] = ident + " = r." + ident
+	}
+	_, err = db.NewRaw(`
+		UPDATE item AS i SET ?
+		FROM (?) AS f, jsonb_populate_record(NULL::item, f.old) AS r
+		WHERE f.item_id = i.id AND f.old IS NOT NULL AND to_jsonb(i) <> f.old`,
+		bun.Safe(strings.Join(sets, ", ")), changes).
+		Exec(ctx)
+	return err
+}
+
+// restoreUser serves POST /admin/users/:user_id/restore, which puts one
+// user's items back as they were at a given time, such as just before a
+// botched import, without touching anyone else's. A dry run shows what
+// would be removed, recreated and reverted, with a confirm token; the
+// restore itself must send that token back, and is refused with a 409 if
+// the plan has changed since.
+func (trackerDb *trackerDb) restoreUser(c echo.Context) error {
+	ctx := context.Background()
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+	req := new(RestoreRequest)
+	err = c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if req.At.IsZero() {
+		return respondError(c, http.StatusBadRequest, "at is required")
+	}
+	req.At = req.At.UTC()
+	if !req.DryRun && req.Confirm == "" {
+		return respondError(c, http.StatusBadRequest, "run with dry_run=true first and send back its confirm token")
+	}
+
+	var since bun.NullTime
+	err = trackerDb.db.NewSelect().
+		ColumnExpr("min(changed_at)").
+		TableExpr("item_history").
+		Scan(ctx, &since)
+	if err != nil {
+		log.Printf("Error while getting item history: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if !since.IsZero() && req.At.Before(since.Time) {
+		return respondError(c, http.StatusBadRequest, "item history only goes back to "+since.Format(time.RFC3339))
+	}
+
+	var plan RestorePlan
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		plan, err = planRestore(ctx, tx, userID, req.At)
+		if err != nil {
+			return err
+		}
+		plan.Confirm = plan.token()
+		if req.DryRun {
+			return nil
+		}
+
+		if req.Confirm != plan.Confirm {
+			return errRestoreChanged
+		}
+		plan.Confirm = ""
+		err = applyRestore(ctx, tx, userID, req.At)
+		if err != nil {
+			return err
+		}
+		plan.Restored = true
+		return nil
+	})
+	if errors.Is(err, errRestoreChanged) {
+		return respondError(c, http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error while restoring user %d: %+v", userID, err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	if plan.Restored {
+		log.Printf("Restored user %d's items to %s: %d removed, %d recreated, %d reverted",
+			userID, req.At.Format(time.RFC3339), len(plan.Remove), len(plan.Recreate), len(plan.Revert))
+	}
+	return respondOK(c, plan)
+}
+
+// pruneItemHistory is the daily job that forgets item history older than
+// itemHistoryKeep.
+func (trackerDb *trackerDb) pruneItemHistory(ctx context.Context, day time.Time) error {
+	_, err := trackerDb.db.NewDelete().
+		TableExpr("item_history").
+		Where("changed_at < ?", day.Add(-itemHistoryKeep)).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+const (
+	retryAttempts = 4
+	retryBase     = 50 * time.Millisecond
+	retryCap      = time.Second
+)
+
+// transient reports whether err is a database failure that is likely to go
+// away on its own: a lost race with another transaction, a dropped
+// connection, or the server restarting or failing over.
+func transient(err error) bool {
+	var unknown errCommitUnknown
+	if errors.As(err, &unknown) {
+		return false
+	}
+
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) {
+		code := pgErr.Field('C')
+		switch {
+		case serializationFailure(err):
+			return true
+		case strings.HasPrefix(code, "08"), strings.HasPrefix(code, "57P"):
+			return true
+		case code == "25006":
+			// The old primary is read-only while it steps down.
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &netErr)
+}
+
+// serializationFailure reports whether Postgres rolled the transaction back
+// because it conflicted with another one.
+func serializationFailure(err error) bool {
+	var pgErr pgdriver.Error
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	code := pgErr.Field('C')
+	return code == "40001" || code == "40P01"
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, or runs out of attempts. Waits between attempts grow
+// exponentially up to retryCap, with full jitter so that clients that failed
+// together don't retry together.
+func retry(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < retryAttempts; attempt++ {
+		if attempt > 0 {
+			wait := retryBase << (attempt - 1)
+			if wait > retryCap {
+				wait = retryCap
+			}
+			select {
+			case <-time.After(time.Duration(rand.Int63n(int64(wait)))):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+		err = fn()
+		if err == nil || !transient(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// routes mounts the API. Each version registers its own item endpoints,
+// whose request and response shapes differ, on top of the routes they
+// share. v1 is deprecated in favour of v2.
+func (trackerDb *trackerDb) routes(e *echo.Echo) {
+	apiv1 := e.Group("/api/v1", apiVersionHeader(apiV1Version), deprecated("/api/v2"), trackerDb.authorize, trackerDb.profileScope, trackerDb.registeredUser, trackerDb.limitExports)
+	apiv1.GET("/hello", func(c echo.Context) error {
+		return c.String(http.StatusOK, "Welcome")
+	})
+	apiv1.POST("/item", trackerDb.addItem)
+	apiv1.GET("/items", trackerDb.getAllItems, etag)
+	apiv1.GET("/items/pinned", trackerDb.getPinnedItems)
+	apiv1.GET("/items/:id", trackerDb.getItemFromId)
+	apiv1.POST("/items/:id/duplicate", trackerDb.duplicateItem)
+	apiv1.POST("/items/from-template/:id", trackerDb.addItemFromTemplate)
+	apiv1.DELETE("/items/:id", trackerDb.deleteItem)
+	apiv1.PATCH("/update/item", trackerDb.updateItem)
+	trackerDb.sharedRoutes(apiv1)
+
+	apiv2 := e.Group("/api/v2", apiVersionHeader(apiV2Version), trackerDb.authorize, trackerDb.profileScope, trackerDb.registeredUser, trackerDb.limitExports)
+	apiv2.GET("/items", trackerDb.getItemsV2, etag)
+	apiv2.POST("/items", trackerDb.createItemV2)
+	apiv2.GET("/items/pinned", trackerDb.getPinnedItemsV2)
+	apiv2.GET("/items/:id", trackerDb.getItemV2)
+	apiv2.PATCH("/items/:id", trackerDb.updateItemV2)
+	apiv2.POST("/items/:id/duplicate", trackerDb.duplicateItemV2)
+	apiv2.POST("/items/from-template/:id", trackerDb.addItemFromTemplateV2)
+	apiv2.DELETE("/items/:id", trackerDb.deleteItem)
+	trackerDb.sharedRoutes(apiv2)
+
+	e.GET("/version", trackerDb.getVersion)
+	trackerDb.walletRoutes(e)
+	trackerDb.debugRoutes(e)
+}
+
+// sharedRoutes are the endpoints that behave the same in every version.
+func (trackerDb *trackerDb) sharedRoutes(g *echo.Group) {
+	g.GET("/dashboard-data", trackerDb.getDashboardData, etag)
+	g.GET("/dashboard/categories/:id/items", trackerDb.getCategoryItems, etag)
+	g.GET("/charts/monthly.png", trackerDb.getMonthlyChart("png"), etag)
+	g.GET("/charts/monthly.svg", trackerDb.getMonthlyChart("svg"), etag)
+	g.POST("/items/:id/clear", trackerDb.clearItem)
+	g.POST("/items/bulk-delete", trackerDb.bulkDeleteItems)
+	g.POST("/reconcile", trackerDb.reconcile)
+	g.GET("/balance-history", trackerDb.getBalanceHistory)
+	g.GET("/forecast", trackerDb.getForecast)
+	g.POST("/adjust", trackerDb.adjustBalance)
+	g.POST("/claims", trackerDb.addClaim)
+	g.GET("/claims", trackerDb.getAllClaims)
+	g.GET("/claims/:id", trackerDb.getClaim)
+	g.POST("/claims/:id/pay", trackerDb.payClaim)
+	g.GET("/reports/tax-summary", trackerDb.getTaxSummary)
+	g.GET("/reports/income-statement", trackerDb.getIncomeStatement)
+	g.GET("/reports/balance-sheet", trackerDb.getBalanceSheet)
+	g.POST("/invoices", trackerDb.addInvoice)
+	g.GET("/invoices", trackerDb.getAllInvoices)
+	g.GET("/invoices/:id", trackerDb.getInvoice)
+	g.POST("/invoices/:id/send", trackerDb.sendInvoice)
+	g.POST("/invoices/:id/pay", trackerDb.payInvoice)
+	g.POST("/loans", trackerDb.addLoan)
+	g.GET("/loans", trackerDb.getAllLoans)
+	g.GET("/loans/:id", trackerDb.getLoan)
+	g.GET("/receivables", trackerDb.getReceivables)
+	g.POST("/bills", trackerDb.addBill)
+	g.GET("/bills", trackerDb.getAllBills)
+	g.GET("/bills/upcoming", trackerDb.getUpcomingBills)
+	g.GET("/bills/:id", trackerDb.getBill)
+	g.POST("/bills/:id/pay", trackerDb.payBill)
+	g.POST("/credit-cards", trackerDb.addCreditCard)
+	g.GET("/credit-cards", trackerDb.getAllCreditCards)
+	g.DELETE("/credit-cards/:id", trackerDb.deleteCreditCard)
+	g.PUT("/credit-cards/:id/limit", trackerDb.putCardLimit)
+	g.GET("/credit-cards/:id/statements", trackerDb.getCardStatements)
+	g.POST("/credit-cards/:id/pay", trackerDb.payCardStatement)
+	g.GET("/staged-items", trackerDb.getAllStagedItems)
+	g.POST("/staged-items/:id/confirm", trackerDb.confirmStagedItem)
+	g.DELETE("/staged-items/:id", trackerDb.deleteStagedItem)
+	g.POST("/ingest/receipt", trackerDb.ingestReceipt)
+	g.POST("/ingest/email", trackerDb.ingestEmail)
+	g.POST("/payments/:id/webhook", trackerDb.receivePayment)
+	g.POST("/payment-webhooks", trackerDb.addPaymentWebhook)
+	g.GET("/payment-webhooks", trackerDb.getAllPaymentWebhooks)
+	g.DELETE("/payment-webhooks/:id", trackerDb.deletePaymentWebhook)
+	g.POST("/ingest/sms", trackerDb.ingestSMS)
+	g.POST("/import", trackerDb.importStatement)
+	g.GET("/import/formats", trackerDb.getImportFormats)
+	g.GET("/imports/:id", trackerDb.getImportJob)
+	g.GET("/imports/:id/errors", trackerDb.getImportErrors)
+	g.DELETE("/imports/:id/items", trackerDb.rollbackImport)
+	g.POST("/import-mappings", trackerDb.addImportMapping)
+	g.GET("/import-mappings", trackerDb.getAllImportMappings)
+	g.PUT("/import-mappings/:id", trackerDb.updateImportMapping)
+	g.DELETE("/import-mappings/:id", trackerDb.deleteImportMapping)
+	g.POST("/import-sources", trackerDb.addImportSource)
+	g.GET("/import-sources", trackerDb.getAllImportSources)
+	g.DELETE("/import-sources/:id", trackerDb.deleteImportSource)
+	g.POST("/import-sources/:id/poll", trackerDb.pollImportSourceNow)
+	g.POST("/backup-targets", trackerDb.addBackupTarget)
+	g.GET("/backup-targets", trackerDb.getAllBackupTargets)
+	g.DELETE("/backup-targets/:id", trackerDb.deleteBackupTarget)
+	g.POST("/backup-targets/:id/run", trackerDb.runBackupNow)
+	g.POST("/sms-templates", trackerDb.addSMSTemplate)
+	g.GET("/sms-templates", trackerDb.getAllSMSTemplates)
+	g.DELETE("/sms-templates/:id", trackerDb.deleteSMSTemplate)
+	g.PUT("/items/:id/merchant", trackerDb.correctMerchant)
+	g.GET("/items/:id/suggest-category", trackerDb.getCategorySuggestions)
+	g.GET("/merchant-rules", trackerDb.getAllMerchantRules)
+	g.DELETE("/merchant-rules/:id", trackerDb.deleteMerchantRule)
+	g.POST("/hooks", trackerDb.subscribeHook)
+	g.DELETE("/hooks/:id", trackerDb.unsubscribeHook)
+	g.GET("/hooks/:id/deliveries", trackerDb.getHookDeliveries)
+	g.POST("/hooks/:id/deliveries/:delivery_id/retry", trackerDb.retryHookDelivery)
+	g.GET("/triggers/new-items", trackerDb.getNewItemsTrigger)
+	g.POST("/actions/items", trackerDb.createItemAction)
+	g.PUT("/sheet-link", trackerDb.linkSheet)
+	g.GET("/sheet-link", trackerDb.getSheetLink)
+	g.DELETE("/sheet-link", trackerDb.unlinkSheet)
+	g.POST("/sheet-link/sync", trackerDb.syncSheetNow)
+	g.POST("/notification-channels", trackerDb.addNotificationChannel)
+	g.GET("/notification-channels", trackerDb.getAllNotificationChannels)
+	g.DELETE("/notification-channels/:id", trackerDb.deleteNotificationChannel)
+	g.POST("/notification-channels/:id/test", trackerDb.testNotificationChannel)
+	g.PUT("/preferences", trackerDb.putPreferences)
+	g.GET("/preferences", trackerDb.getPreferences)
+	g.PUT("/summary-settings", trackerDb.putSummarySetting)
+	g.GET("/summary-settings", trackerDb.getSummarySetting)
+	g.POST("/item-templates", trackerDb.addItemTemplate)
+	g.GET("/item-templates", trackerDb.getAllItemTemplates)
+	g.PUT("/item-templates/:id", trackerDb.updateItemTemplate)
+	g.DELETE("/item-templates/:id", trackerDb.deleteItemTemplate)
+	g.POST("/profiles", trackerDb.addProfile)
+	g.GET("/profiles", trackerDb.getAllProfiles)
+	g.DELETE("/profiles/:id", trackerDb.deleteProfile)
+	g.PUT("/category-caps/:category_id", trackerDb.putCategoryCap)
+	g.GET("/category-caps", trackerDb.getAllCategoryCaps)
+	g.GET("/category-caps/progress", trackerDb.getCapProgress)
+	g.DELETE("/category-caps/:category_id", trackerDb.deleteCategoryCap)
+	g.GET("/wallet/apple", trackerDb.getApplePass)
+	g.GET("/wallet/google", trackerDb.getGooglePass)
+	g.GET("/calendar-token", trackerDb.getCalendarToken)
+	g.GET("/calendar.ics", trackerDb.getCalendar)
+	g.POST("/users", trackerDb.addUser)
+	g.GET("/me", trackerDb.getMe)
+	g.GET("/me/summary", trackerDb.getWidgetSummary, etag)
+	g.GET("/me/rate-limit", trackerDb.getRateLimit)
+	g.GET("/admin/maintenance", trackerDb.getMaintenance)
+	g.PUT("/admin/maintenance", trackerDb.setMaintenance)
+	g.GET("/admin/outbound", trackerDb.getOutboundStats)
+	g.POST("/admin/seed-demo", trackerDb.seedDemoData)
+	g.POST("/admin/users/:user_id/restore", trackerDb.restoreUser)
+	g.GET("/analytics/stats", trackerDb.getStats)
+	g.GET("/analytics/top", trackerDb.getTop)
+	g.GET("/analytics/compare", trackerDb.getCompare)
+	g.GET("/analytics/aggregate", trackerDb.getAggregate)
+	g.GET("/analytics/locations", trackerDb.getLocations)
+	g.GET("/analytics/category-monthly", trackerDb.getCategoryMonthly)
+	g.GET("/analytics/health", trackerDb.getHealth)
+	g.PATCH("/categories/:id", trackerDb.updateCategory)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/uptrace/bun"
+)
+
+// models are the bun models of every table the server writes. Each maps
+// its table's columns, so a column added to a model without a migration,
+// or a migration that renames one, shows up in checkSchema.
+var models = []interface{}{
+	(*User)(nil),
+	(*Item)(nil),
+	(*Category)(nil),
+	(*CategoryCap)(nil),
+	(*Bill)(nil),
+	(*Claim)(nil),
+	(*Invoice)(nil),
+	(*InvoiceLine)(nil),
+	(*Loan)(nil),
+	(*Profile)(nil),
+	(*ItemTemplate)(nil),
+	(*StagedItem)(nil),
+	(*MerchantRule)(nil),
+	(*HookSubscription)(nil),
+	(*HookDelivery)(nil),
+	(*NotificationChannel)(nil),
+	(*SMSTemplate)(nil),
+	(*SheetLink)(nil),
+	(*ImportJob)(nil),
+	(*ImportMapping)(nil),
+	(*ImportSource)(nil),
+	(*ImportSourceFile)(nil),
+	(*PaymentWebhook)(nil),
+	(*PaymentEvent)(nil),
+	(*WalletPass)(nil),
+	(*WalletPassDevice)(nil),
+	(*BackupTarget)(nil),
+	(*CreditCard)(nil),
+	(*SummarySetting)(nil),
+	(*UserPreference)(nil),
+}
+
+// checkSchema compares the models with the migrated database, logs every
+// table or column a model maps that the database doesn't have and fails if
+// there are any, so the server doesn't start on a schema its queries would
+// fail against. Columns the database has and no model maps are fine;
+// queries select them by name.
+func checkSchema(db *bun.DB) error {
+	ctx := context.Background()
+
+	drift := 0
+	for _, m := range models {
+		table := db.Table(reflect.TypeOf(m).Elem())
+
+		columns := []string{}
+		err := db.NewSelect().
+			TableExpr("information_schema.columns").
+			Column("column_name").
+			Where("table_schema = current_schema()").
+			Where("table_name = ?", table.Name).
+			Scan(ctx, &columns)
+		if err != nil {
+			return fmt.Errorf("can't check the schema of %s: %w", table.Name, err)
+		}
+		if len(columns) == 0 {
+			log.Printf("Schema drift: table %s for model %s does not exist", table.Name, table.TypeName)
+			drift++
+			continue
+		}
+
+		have := make(map[string]bool, len(columns))
+		for _, c := range columns {
+			have[c] = true
+		}
+		for _, f := range table.Fields {
+			if !have[f.Name] {
+				log.Printf("Schema drift: %s.%s is mapped by %s.%s but not in the database", table.Name, f.Name, table.TypeName, f.GoName)
+				drift++
+			}
+		}
+	}
+
+	if drift > 0 {
+		return fmt.Errorf("found %d schema differences; add a migration for them", drift)
+	}
+	return nil
+}
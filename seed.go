@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// demoMonths is how much history the demo data covers, ending this month.
+const demoMonths = 12
+
+// demoCategory describes the transactions generated in one category:
+// about PerMonth of them a month, on Day if it is set and on random days
+// otherwise, costing between Min and Max. Cap, if set, becomes a soft
+// monthly cap.
+type demoCategory struct {
+	Name      string
+	Type      string
+	Fixed     bool
+	Merchants []string
+	PerMonth  float64
+	Day       int
+	Min, Max  float64
+	Cap       float64
+}
+
+var demoCategories = []demoCategory{
+	{Name: "Salary", Type: "credit", Merchants: []string{"Acme Corp payroll"}, PerMonth: 1, Day: 1, Min: 85000, Max: 85000},
+	{Name: "Freelance", Type: "credit", Merchants: []string{"Upwork", "Client transfer"}, PerMonth: 0.6, Min: 5000, Max: 25000},
+	{Name: "Interest", Type: "credit", Merchants: []string{"Savings interest"}, PerMonth: 1, Day: 28, Min: 150, Max: 400},
+	{Name: "Rent", Type: "debit", Fixed: true, Merchants: []string{"Landlord"}, PerMonth: 1, Day: 3, Min: 25000, Max: 25000},
+	{Name: "Utilities", Type: "debit", Fixed: true, Merchants: []string{"Electricity board", "Water supply", "Airtel broadband"}, PerMonth: 3, Min: 500, Max: 3500},
+	{Name: "Groceries", Type: "debit", Merchants: []string{"BigBasket", "DMart", "Reliance Fresh", "Kirana store"}, PerMonth: 9, Min: 300, Max: 2500, Cap: 12000},
+	{Name: "Dining", Type: "debit", Merchants: []string{"Swiggy", "Zomato", "Starbucks", "Cafe Coffee Day"}, PerMonth: 7, Min: 200, Max: 1800, Cap: 8000},
+	{Name: "Transport", Type: "debit", Merchants: []string{"Uber", "Ola", "Metro card recharge", "Indian Oil"}, PerMonth: 10, Min: 80, Max: 600, Cap: 5000},
+	{Name: "Entertainment", Type: "debit", Merchants: []string{"Netflix", "BookMyShow", "Spotify"}, PerMonth: 2, Min: 199, Max: 1500, Cap: 2500},
+	{Name: "Health", Type: "debit", Merchants: []string{"Apollo Pharmacy", "Practo"}, PerMonth: 1, Min: 300, Max: 3000},
+	{Name: "Shopping", Type: "debit", Merchants: []string{"Amazon", "Flipkart", "Myntra"}, PerMonth: 3, Min: 500, Max: 6000, Cap: 10000},
+}
+
+var errDemoUserHasItems = errors.New("the demo user already has items; pick an unused user_id")
+
+// SeedResult counts what seedDemo created.
+type SeedResult struct {
+	UserID     int `json:"user_id"`
+	Items      int `json:"items"`
+	Categories int `json:"categories"`
+	Caps       int `json:"caps"`
+}
+
+// seedDemo fills an unused user with a year of randomized but plausible
+// transactions and budgets, for developing and demoing clients against,
+// registering the user first if it isn't. It fails with
+// errDemoUserHasItems rather than mix demo data into a real ledger.
+func (trackerDb *trackerDb) seedDemo(ctx context.Context, userID int, now time.Time, rng *rand.Rand) (SeedResult, error) {
+	result := SeedResult{UserID: userID}
+	err := trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		result = SeedResult{UserID: userID}
+
+		err := ensureUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		n, err := tx.NewSelect().TableExpr("item").Where("user_id = ?", userID).Count(ctx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return errDemoUserHasItems
+		}
+
+		ids, created, err := ensureDemoCategories(ctx, tx)
+		if err != nil {
+			return err
+		}
+		result.Categories = created
+
+		items := []Item{}
+		caps := []CategoryCap{}
+		start := time.Date(now.Year(), now.Month()-demoMonths+1, 1, 0, 0, 0, 0, time.UTC)
+		for i, dc := range demoCategories {
+			if dc.Cap != 0 {
+				caps = append(caps, CategoryCap{UserID: userID, CategoryID: ids[i], Amount: dc.Cap})
+			}
+			for month := start; month.Before(now); month = month.AddDate(0, 1, 0) {
+				items = append(items, dc.generate(rng, userID, ids[i], month, now)...)
+			}
+		}
+
+		if len(items) > 0 {
+			_, err = tx.NewInsert().Model(&items).Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if len(caps) > 0 {
+			_, err = tx.NewInsert().Model(&caps).Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		result.Items = len(items)
+		result.Caps = len(caps)
+		return nil
+	})
+	return result, err
+}
+
+// ensureDemoCategories looks up the category of each of demoCategories,
+// creating those that don't exist, and returns their ids in the same order
+// along with how many it created.
+func ensureDemoCategories(ctx context.Context, db bun.IDB) ([]uuid.UUID, int, error) {
+	ids := make([]uuid.UUID, len(demoCategories))
+	created := 0
+	for i, dc := range demoCategories {
+		category := &Category{Name: dc.Name, Fixed: dc.Fixed}
+		err := db.NewSelect().Model(category).Where("lower(name) = lower(?)", dc.Name).Limit(1).Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			category.ID = uuid.New()
+			_, err = db.NewInsert().Model(category).Exec(ctx)
+			created++
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		ids[i] = category.ID
+	}
+	return ids, created, nil
+}
+
+// generate makes dc's transactions for the month starting at month, leaving
+// out any that would fall after now.
+func (dc demoCategory) generate(rng *rand.Rand, userID int, categoryID uuid.UUID, month, now time.Time) []Item {
+	days := month.AddDate(0, 1, -1).Day()
+	count := int(dc.PerMonth*(0.7+0.6*rng.Float64()) + 0.5)
+	if dc.Day != 0 {
+		count = min(count, 1)
+	}
+
+	items := []Item{}
+	for i := 0; i < count; i++ {
+		day := dc.Day
+		if day == 0 {
+			day = 1 + rng.Intn(days)
+		}
+		at := month.AddDate(0, 0, day-1).Add(time.Duration(8*60+rng.Intn(14*60)) * time.Minute)
+		if at.After(now) {
+			continue
+		}
+		items = append(items, Item{
+			Name:       dc.Merchants[rng.Intn(len(dc.Merchants))],
+			Cost:       roundMoney(dc.Min + rng.Float64()*(dc.Max-dc.Min)),
+			Type:       dc.Type,
+			CategoryID: categoryID,
+			UserID:     userID,
+			CreatedAt:  at,
+		})
+	}
+	return items
+}
+
+// bulkBatchSize is how many items seedBulk inserts per statement.
+const bulkBatchSize = 5000
+
+// seedBulk inserts count items for userID, spread at random over the last
+// demoMonths months and the demo categories, to measure listing and
+// analytics queries against a realistically large ledger. It registers the
+// user if needed. Unlike seedDemo it adds to whatever the user already
+// has, and commits each batch on its own so millions of items don't sit in
+// one transaction.
+func (trackerDb *trackerDb) seedBulk(ctx context.Context, userID, count int, now time.Time, rng *rand.Rand) (SeedResult, error) {
+	result := SeedResult{UserID: userID}
+	err := ensureUser(ctx, trackerDb.db, userID)
+	if err != nil {
+		return result, err
+	}
+	ids, created, err := ensureDemoCategories(ctx, trackerDb.db)
+	if err != nil {
+		return result, err
+	}
+	result.Categories = created
+
+	span := now.Sub(now.AddDate(0, -demoMonths, 0))
+	for result.Items < count {
+		items := make([]Item, min(bulkBatchSize, count-result.Items))
+		for i := range items {
+			k := rng.Intn(len(demoCategories))
+			dc := demoCategories[k]
+			items[i] = Item{
+				Name:       dc.Merchants[rng.Intn(len(dc.Merchants))],
+				Cost:       roundMoney(dc.Min + rng.Float64()*(dc.Max-dc.Min)),
+				Type:       dc.Type,
+				CategoryID: ids[k],
+				UserID:     userID,
+				CreatedAt:  now.Add(-time.Duration(rng.Int63n(int64(span)))),
+			}
+		}
+		_, err = trackerDb.db.NewInsert().Model(&items).Exec(ctx)
+		if err != nil {
+			return result, err
+		}
+		result.Items += len(items)
+	}
+	return result, nil
+}
+
+// SeedDemoRequest is the body of POST /admin/seed-demo.
+type SeedDemoRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// seedDemoData generates demo data for an unused user. Only admins may
+// call it under the default policy.
+func (trackerDb *trackerDb) seedDemoData(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(SeedDemoRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if req.UserID == 0 {
+		return respondError(c, http.StatusBadRequest, "user_id is required")
+	}
+
+	result, err := trackerDb.seedDemo(ctx, req.UserID, time.Now().UTC(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	if errors.Is(err, errDemoUserHasItems) {
+		return respondError(c, http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error while seeding demo data: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, "", result)
+}
+
+// runSeed implements "finance-tracker-server seed --demo [--user N]
+// [--seed N]" and "finance-tracker-server seed --bulk N [--user N]
+// [--seed N]". A fixed --seed gives the same data every time.
+func (trackerDb *trackerDb) runSeed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	demo := fs.Bool("demo", false, "generate a year of demo transactions and budgets")
+	bulk := fs.Int("bulk", 0, "generate this many random items, for load testing")
+	userID := fs.Int("user", 1, "user_id to generate the data for; with --demo it must have no items")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(*seed))
+	var result SeedResult
+	switch {
+	case *demo:
+		result, err = trackerDb.seedDemo(ctx, *userID, time.Now().UTC(), rng)
+	case *bulk > 0:
+		result, err = trackerDb.seedBulk(ctx, *userID, *bulk, time.Now().UTC(), rng)
+	default:
+		fs.Usage()
+		return errors.New("nothing to seed; pass --demo or --bulk")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Seeded user %d with %d items, %d new categories and %d caps\n", result.UserID, result.Items, result.Categories, result.Caps)
+	return nil
+}
@@ -3,9 +3,15 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -17,15 +23,14 @@ import (
 	"github.com/uptrace/bun/extra/bundebug"
 )
 
-func connect() *bun.DB {
-	env := NewEnv()
+func connect(env *Env, opts ...pgdriver.Option) *bun.DB {
 	var dsn string
 	if env.AppEnv == "production" {
 		dsn = fmt.Sprintf("postgres://%s:%s@%s/%s", env.DbUser, env.DbPass, env.DbHost, env.DbName)
 	} else {
 		dsn = fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", env.DbUser, env.DbPass, env.DbHost, env.DbName)
 	}
-	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
+	sqldb := sql.OpenDB(pgdriver.NewConnector(append([]pgdriver.Option{pgdriver.WithDSN(dsn)}, opts...)...))
 
 	db := bun.NewDB(sqldb, pgdialect.New())
 	db.AddQueryHook(bundebug.NewQueryHook(
@@ -37,18 +42,134 @@ func connect() *bun.DB {
 }
 
 type trackerDb struct {
-	db *bun.DB
+	db          *bun.DB
+	env         *Env
+	ocr         ocrBackend
+	maintenance *maintenanceMode
+	rateLimit   *rateLimiter
+	policy      policy
+	widgets     *widgetCache
+	exports     *concurrencyLimiter
+	imports     *concurrencyLimiter
+
+	// reports is a second pool for analytics and reports, whose
+	// connections cancel any statement running past AnalyticsTimeout.
+	reports *bun.DB
 }
 
 type Item struct {
 	bun.BaseModel `bun:"table:item,alias:i"`
 
-	ID         uuid.UUID `bun:"default:gen_random_uuid()" json:"id"`
-	Name       string    `json:"name"`
-	Cost       float64   `json:"cost"`
-	Type       string    `json:"type"`
-	CategoryID uuid.UUID `bun:"type:uuid" json:"category_id"`
-	UserID     int       `bun:"user_id" json:"user_id"`
+	ID   uuid.UUID `bun:"default:gen_random_uuid()" json:"id"`
+	Name string    `json:"name"`
+	// DisplayName is the cleaned-up merchant name for raw imported names.
+	DisplayName string    `bun:",nullzero" json:"display_name"`
+	Cost        float64   `json:"cost"`
+	Type        string    `json:"type"`
+	CategoryID  uuid.UUID `bun:"type:uuid,nullzero" json:"category_id"`
+	UserID      int       `bun:"user_id" json:"user_id"`
+	CreatedAt   time.Time `bun:"created_at,nullzero" json:"createdAt"`
+	Status      string    `bun:",nullzero" json:"status"`
+	Adjustment  bool      `json:"adjustment"`
+	// Reimbursable items can be grouped into a claim; once the claim is
+	// paid they and the offsetting credit are marked reimbursed.
+	Reimbursable bool      `json:"reimbursable"`
+	ClaimID      uuid.UUID `bun:"type:uuid,nullzero" json:"claim_id"`
+	Reimbursed   bool      `json:"reimbursed"`
+	// Business expense fields, all optional. TaxAmount is derived from a
+	// tax-inclusive Cost and TaxRate when not given.
+	TaxRate       float64 `bun:",nullzero" json:"tax_rate"`
+	TaxAmount     float64 `bun:",nullzero" json:"tax_amount"`
+	VendorTaxID   string  `bun:",nullzero" json:"vendor_tax_id"`
+	InvoiceNumber string  `bun:",nullzero" json:"invoice_number"`
+	// LoanID marks the item as a repayment of money lent or borrowed.
+	LoanID uuid.UUID `bun:"type:uuid,nullzero" json:"loan_id"`
+	// ProfileID is the ledger the item belongs to; empty for the default one.
+	ProfileID uuid.UUID `bun:"type:uuid,nullzero" json:"profile_id"`
+	// Pinned items are ones the user wants at hand, e.g. deposits or
+	// purchases still under warranty.
+	Pinned bool `json:"pinned"`
+	// Where the item was entered, if the client sent it.
+	Latitude  float64 `bun:",nullzero" json:"latitude"`
+	Longitude float64 `bun:",nullzero" json:"longitude"`
+	Place     string  `bun:",nullzero" json:"place"`
+	// Foreign-currency items keep what was actually paid and the rate used
+	// to convert it into Cost, so later rate changes can't alter past
+	// reports.
+	OriginalAmount   float64 `bun:",nullzero" json:"original_amount"`
+	OriginalCurrency string  `bun:",nullzero" json:"original_currency"`
+	ExchangeRate     float64 `bun:",nullzero" json:"exchange_rate"`
+	RateDate         Date    `bun:"type:date,nullzero" json:"rate_date"`
+	// Scheduled items are dated in the future. They are left out of
+	// balances until their date arrives and they become normal items.
+	Scheduled bool `json:"scheduled"`
+	// Excluded items, like unmodelled transfers or test entries, stay in
+	// the ledger but are left out of analytics and spending caps.
+	Excluded bool `json:"excluded"`
+	// ImportBatchID is the statement import the item came from, so a wrong
+	// import can be undone as a whole.
+	ImportBatchID uuid.UUID `bun:"type:uuid,nullzero" json:"import_batch_id"`
+	// CardID is the credit card the item was charged to, or, for credits,
+	// the card it paid off or refunded to.
+	CardID uuid.UUID `bun:"type:uuid,nullzero" json:"card_id"`
+	// Category and User are only loaded by queries that ask for them with
+	// Relation("Category") or Relation("User").
+	Category *Category `bun:"rel:belongs-to,join:category_id=id" json:"category,omitempty"`
+	User     *User     `bun:"rel:belongs-to,join:user_id=legacy_id" json:"user,omitempty"`
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// applyExchangeRate checks the original amount fields of a foreign-currency
+// item and, when no cost was given, converts the original amount into it.
+// It returns a message for the client if the fields don't add up.
+func (i *Item) applyExchangeRate() string {
+	if i.OriginalCurrency == "" && i.OriginalAmount == 0 && i.ExchangeRate == 0 {
+		return ""
+	}
+	if !currencyCode.MatchString(i.OriginalCurrency) {
+		return "original_currency must be a three-letter currency code"
+	}
+	if i.OriginalAmount <= 0 || i.ExchangeRate <= 0 {
+		return "original_amount and exchange_rate must be positive"
+	}
+	if i.Cost == 0 {
+		i.Cost = roundMoney(i.OriginalAmount * i.ExchangeRate)
+	}
+	if i.RateDate.IsZero() {
+		i.RateDate = Date{today()}
+	}
+	return ""
+}
+
+// invalidStatusMsg rejects a status the item table's check doesn't allow.
+const invalidStatusMsg = "status must be pending, cleared or reconciled"
+
+func validItemStatus(status string) bool {
+	return status == "pending" || status == "cleared" || status == "reconciled"
+}
+
+// validate returns a message for the client if the item isn't one v2 will
+// save: it needs a name, a positive cost, a type of debit or credit, a
+// status of pending, cleared or reconciled if it has one and, if it has a
+// location, a valid latitude and longitude.
+func (i *Item) validate() string {
+	if i.Name == "" {
+		return "name is required"
+	}
+	if i.Cost <= 0 {
+		return "cost must be positive"
+	}
+	if i.Type != "debit" && i.Type != "credit" {
+		return "type must be debit or credit"
+	}
+	if i.Status != "" && !validItemStatus(i.Status) {
+		return invalidStatusMsg
+	}
+	if i.Latitude < -90 || i.Latitude > 90 || i.Longitude < -180 || i.Longitude > 180 {
+		return "location is not a valid latitude and longitude"
+	}
+	return ""
 }
 
 func (trackerDb *trackerDb) addItem(c echo.Context) error {
@@ -59,92 +180,220 @@ func (trackerDb *trackerDb) addItem(c echo.Context) error {
 	err := c.Bind(item)
 	if err != nil {
 		log.Printf("Error while binding: %+v", err)
-		return c.JSON(http.StatusInternalServerError, "Internal server error")
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
 	}
 
-	_, err = trackerDb.db.NewInsert().Model(item).Exec(ctx)
+	if msg := item.applyExchangeRate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	if profile := currentProfile(c); profile != uuid.Nil {
+		item.ProfileID = profile
+	}
+	err = trackerDb.createItem(ctx, item, c.QueryParam("override_cap") == "true")
 	if err != nil {
-		log.Printf("Error executing insert: %v", err)
-		return c.JSON(http.StatusInternalServerError, "Internal server error")
+		return respondItemError(c, err, "creating item")
 	}
 
-	return c.JSON(http.StatusOK, "Done")
+	return respondCreated(c, apiPath(c, "/items/"+item.ID.String()), item)
+}
+
+// NewItemFromRequest optionally changes the date and cost of an item
+// created from another item or a template.
+type NewItemFromRequest struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Cost      float64   `json:"cost"`
+}
+
+func (trackerDb *trackerDb) duplicateItem(c echo.Context) error {
+	return trackerDb.addItemFrom(c, trackerDb.copyItem, "Item not found")
+}
+
+func (trackerDb *trackerDb) addItemFromTemplate(c echo.Context) error {
+	return trackerDb.addItemFrom(c, trackerDb.itemFromTemplate, "Item template not found")
+}
+
+// addItemFrom creates an item from the source with the id in the path.
+func (trackerDb *trackerDb) addItemFrom(c echo.Context, source itemSource, notFound string) error {
+	ctx := context.Background()
+
+	req := new(NewItemFromRequest)
+	if c.Request().ContentLength != 0 {
+		err := c.Bind(req)
+		if err != nil {
+			log.Printf("Error while binding: %+v", err)
+			return respondError(c, http.StatusBadRequest, err.Error())
+		}
+	}
+	if req.Cost < 0 {
+		return respondError(c, http.StatusBadRequest, "cost must be positive")
+	}
+
+	item, err := source(ctx, c.Param("id"), req.CreatedAt, req.Cost, c.QueryParam("override_cap") == "true")
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, notFound)
+	}
+	if err != nil {
+		return respondItemError(c, err, "creating item")
+	}
+
+	return respondCreated(c, apiPath(c, "/items/"+item.ID.String()), item)
 }
 
 type GetAllItemsRow struct {
-	ID         uuid.UUID        `bun:"id" json:"id"`
-	Name       string           `json:"name"`
-	Cost       float64          `json:"cost"`
-	Type       string           `json:"type"`
-	CategoryID uuid.UUID        `bun:"type:uuid" json:"category_id"`
-	UserID     int              `bun:"user_id" json:"user_id"`
-	CreatedAt  pgtype.Timestamp `json:"createdAt" bun:"createdAt"`
+	ID               uuid.UUID        `bun:"id" json:"id"`
+	Name             string           `json:"name"`
+	DisplayName      string           `bun:"display_name" json:"display_name"`
+	Cost             float64          `json:"cost"`
+	Type             string           `json:"type"`
+	CategoryID       uuid.UUID        `bun:"type:uuid" json:"category_id"`
+	UserID           int              `bun:"user_id" json:"user_id"`
+	CreatedAt        pgtype.Timestamp `json:"createdAt" bun:"created_at"`
+	Status           string           `bun:"status" json:"status"`
+	Adjustment       bool             `bun:"adjustment" json:"adjustment"`
+	Reimbursable     bool             `bun:"reimbursable" json:"reimbursable"`
+	ClaimID          uuid.NullUUID    `bun:"claim_id" json:"claim_id"`
+	Reimbursed       bool             `bun:"reimbursed" json:"reimbursed"`
+	TaxRate          float64          `bun:"tax_rate" json:"tax_rate"`
+	TaxAmount        float64          `bun:"tax_amount" json:"tax_amount"`
+	VendorTaxID      string           `bun:"vendor_tax_id" json:"vendor_tax_id"`
+	InvoiceNumber    string           `bun:"invoice_number" json:"invoice_number"`
+	LoanID           uuid.NullUUID    `bun:"loan_id" json:"loan_id"`
+	ProfileID        uuid.NullUUID    `bun:"profile_id" json:"profile_id"`
+	Pinned           bool             `bun:"pinned" json:"pinned"`
+	Latitude         float64          `bun:"latitude" json:"latitude"`
+	Longitude        float64          `bun:"longitude" json:"longitude"`
+	Place            string           `bun:"place" json:"place"`
+	OriginalAmount   float64          `bun:"original_amount" json:"original_amount"`
+	OriginalCurrency string           `bun:"original_currency" json:"original_currency"`
+	ExchangeRate     float64          `bun:"exchange_rate" json:"exchange_rate"`
+	RateDate         Date             `bun:"rate_date" json:"rate_date"`
+	Scheduled        bool             `bun:"scheduled" json:"scheduled"`
+	Excluded         bool             `bun:"excluded" json:"excluded"`
+	ImportBatchID    uuid.NullUUID    `bun:"import_batch_id" json:"import_batch_id"`
+	CardID           uuid.NullUUID    `bun:"card_id" json:"card_id"`
+	CategoryName     string           `bun:"category_name" json:"category_name"`
+	// RunningBalance is the user's net balance (credits minus debits) after
+	// this item, in statement order.
+	RunningBalance float64 `bun:"running_balance" json:"running_balance"`
 }
 
 func (trackerDb *trackerDb) getAllItems(c echo.Context) error {
 	ctx := context.Background()
 	userID := c.QueryParam("user_id")
 
-	items := []GetAllItemsRow{}
-	err := trackerDb.db.NewSelect().TableExpr("item").Where("user_id = ?", userID).Scan(ctx, &items)
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "limit must be between 1 and 1000 and offset not negative")
+	}
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	excluded, ok := boolParam(c, "excluded")
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "excluded must be true or false")
+	}
+
+	items, summary, err := trackerDb.listItems(ctx, itemFilter{UserID: userID, Profile: currentProfile(c), Period: p, Excluded: excluded}, limit, offset)
 	if err != nil {
 		log.Printf("Error while getting items: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	setSummaryHeaders(c, summary)
+	if limit == 0 {
+		return respondOK(c, items)
 	}
 
-	successData := map[string]interface{}{
-		"message": "ok",
-		"data":    items,
+	return respondPage(c, items, PageMeta{Total: summary.Count, Limit: limit, Offset: offset, Summary: &summary})
+}
+
+func (trackerDb *trackerDb) getPinnedItems(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	items, _, err := trackerDb.listItems(ctx, itemFilter{UserID: userID, Profile: currentProfile(c), Pinned: true}, 0, 0)
+	if err != nil {
+		log.Printf("Error while getting pinned items: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
 	}
 
-	return c.JSON(http.StatusOK, successData)
+	return respondOK(c, items)
+}
+
+// setSummaryHeaders lets clients show totals for a filtered list without
+// reading the body or fetching every page.
+func setSummaryHeaders(c echo.Context, s ItemsSummary) {
+	h := c.Response().Header()
+	h.Set("X-Total-Count", strconv.Itoa(s.Count))
+	h.Set("X-Total-Debits", strconv.FormatFloat(s.Debits, 'f', 2, 64))
+	h.Set("X-Total-Credits", strconv.FormatFloat(s.Credits, 'f', 2, 64))
 }
 
 type GetItem struct {
-	ID         uuid.UUID        `json:"id" bun:"id"`
-	Name       string           `json:"name" bun:"name"`
-	Cost       float64          `json:"cost" bun:"cost"`
-	Type       string           `json:"type" bun:"type"`
-	CategoryID uuid.UUID        `json:"category_id" bun:"category_id"`
-	CreatedAt  pgtype.Timestamp `json:"createdAt" bun:"createdAt"`
-	UserID     int              `bun:"user_id" json:"user_id"`
+	ID               uuid.UUID        `json:"id" bun:"id"`
+	Name             string           `json:"name" bun:"name"`
+	DisplayName      string           `json:"display_name" bun:"display_name"`
+	Cost             float64          `json:"cost" bun:"cost"`
+	Type             string           `json:"type" bun:"type"`
+	CategoryID       uuid.UUID        `json:"category_id" bun:"category_id"`
+	CreatedAt        pgtype.Timestamp `json:"createdAt" bun:"created_at"`
+	UserID           int              `bun:"user_id" json:"user_id"`
+	Status           string           `json:"status" bun:"status"`
+	Adjustment       bool             `json:"adjustment" bun:"adjustment"`
+	Reimbursable     bool             `json:"reimbursable" bun:"reimbursable"`
+	ClaimID          uuid.NullUUID    `json:"claim_id" bun:"claim_id"`
+	Reimbursed       bool             `json:"reimbursed" bun:"reimbursed"`
+	TaxRate          float64          `json:"tax_rate" bun:"tax_rate"`
+	TaxAmount        float64          `json:"tax_amount" bun:"tax_amount"`
+	VendorTaxID      string           `json:"vendor_tax_id" bun:"vendor_tax_id"`
+	InvoiceNumber    string           `json:"invoice_number" bun:"invoice_number"`
+	LoanID           uuid.NullUUID    `json:"loan_id" bun:"loan_id"`
+	ProfileID        uuid.NullUUID    `json:"profile_id" bun:"profile_id"`
+	Pinned           bool             `json:"pinned" bun:"pinned"`
+	Latitude         float64          `json:"latitude" bun:"latitude"`
+	Longitude        float64          `json:"longitude" bun:"longitude"`
+	Place            string           `json:"place" bun:"place"`
+	OriginalAmount   float64          `json:"original_amount" bun:"original_amount"`
+	OriginalCurrency string           `json:"original_currency" bun:"original_currency"`
+	ExchangeRate     float64          `json:"exchange_rate" bun:"exchange_rate"`
+	RateDate         Date             `json:"rate_date" bun:"rate_date"`
+	Scheduled        bool             `json:"scheduled" bun:"scheduled"`
+	Excluded         bool             `json:"excluded" bun:"excluded"`
+	ImportBatchID    uuid.NullUUID    `json:"import_batch_id" bun:"import_batch_id"`
+	CardID           uuid.NullUUID    `json:"card_id" bun:"card_id"`
 }
 
 func (trackerDb *trackerDb) getItemFromId(c echo.Context) error {
 	ctx := context.Background()
 	id := c.Param("id")
 
-	var item GetItem
-	err := trackerDb.db.NewSelect().TableExpr("item").Where("id = ?", id).Scan(ctx, &item)
+	item, err := trackerDb.findItem(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Item not found")
+	}
 	if err != nil {
 		log.Printf("Could not fetch item: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
-	}
-
-	successData := map[string]interface{}{
-		"message": "ok",
-		"data":    item,
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
 	}
 
-	return c.JSON(http.StatusOK, successData)
+	return respondOK(c, item)
 }
 
 func (trackerDb *trackerDb) deleteItem(c echo.Context) error {
 	ctx := context.Background()
 	id := c.Param("id")
 
-	res, err := trackerDb.db.NewDelete().TableExpr("item").Where("id = ?", id).Exec(ctx)
+	deleted, err := trackerDb.removeItem(ctx, id)
 	if err != nil {
 		log.Printf("Error while deleting: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
 	}
-
-	successData := map[string]interface{}{
-		"message": "ok",
-		"data":    res,
+	if !deleted {
+		return respondError(c, http.StatusNotFound, "Item not found")
 	}
 
-	return c.JSON(http.StatusOK, successData)
+	return c.NoContent(http.StatusNoContent)
 }
 
 func (trackerDb *trackerDb) updateItem(c echo.Context) error {
@@ -154,21 +403,24 @@ func (trackerDb *trackerDb) updateItem(c echo.Context) error {
 	err := c.Bind(&value)
 	if err != nil {
 		log.Printf("Error while binding: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	// v1 clients still send the column's old name.
+	if at, ok := value["createdAt"]; ok {
+		delete(value, "createdAt")
+		value["created_at"] = at
 	}
 
-	res, err := trackerDb.db.NewUpdate().Model(&value).Where("id = ?", value["id"]).TableExpr("item").Exec(ctx)
+	item, err := trackerDb.updateItemFields(ctx, value["id"], value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Item not found")
+	}
 	if err != nil {
 		log.Printf("Error while updating: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
 	}
 
-	successData := map[string]interface{}{
-		"message": "ok",
-		"data":    res,
-	}
-
-	return c.JSON(http.StatusOK, successData)
+	return respondOK(c, item)
 }
 
 type CategoriesVsExpensesRow struct {
@@ -177,105 +429,258 @@ type CategoriesVsExpensesRow struct {
 	Income   float64 `json:"income"`
 }
 
+// IncomeSourceRow is how much income came in under one category, e.g.
+// salary, freelance or interest.
+type IncomeSourceRow struct {
+	Category string  `json:"category"`
+	Income   float64 `json:"income"`
+	Count    int     `json:"count"`
+}
+
 type IncomeVsExpenses struct {
 	Expenses float64 `json:"expenses"`
 	Income   float64 `json:"income"`
 }
 
+// MonthlyExpensesRow is one bucket of the dashboard's time series. Period
+// is the day the bucket starts, and Month and Year are its month and year.
+// Label names the bucket as 2026-10 for months, 2026-W42 (ISO week) for
+// weeks and 2026-10-15 for days.
 type MonthlyExpensesRow struct {
-	Month    string  `json:"month"`
-	Year     string  `json:"year"`
+	Period   Date    `json:"period"`
+	Label    string  `json:"label"`
+	Month    int     `json:"month"`
+	Year     int     `json:"year"`
 	Expenses float64 `json:"expenses"`
 	Income   float64 `json:"income"`
 }
 
+// seriesLabels are the TO_CHAR formats for each granularity the dashboard
+// series can be bucketed by.
+var seriesLabels = map[string]string{
+	"day":   "YYYY-MM-DD",
+	"week":  `IYYY-"W"IW`,
+	"month": "YYYY-MM",
+}
+
+// dashboardSections can be downloaded one at a time as CSV with
+// ?format=csv&section=.
+var dashboardSections = []string{"categories", "incomeSources", "incomeVsExpenses", "monthly"}
+
 func (trackerDb *trackerDb) getDashboardData(c echo.Context) error {
 	ctx := context.Background()
 	userID := c.QueryParam("user_id")
 
+	granularity := c.QueryParam("granularity")
+	if granularity == "" {
+		granularity = "month"
+	}
+	label, ok := seriesLabels[granularity]
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "granularity must be day, week or month")
+	}
+
+	csvSection := ""
+	if wantsCSV(c) {
+		csvSection = c.QueryParam("section")
+		if !slices.Contains(dashboardSections, csvSection) {
+			return respondError(c, http.StatusBadRequest, fmt.Sprintf("section must be one of %v for CSV", dashboardSections))
+		}
+	}
+
 	categories := []CategoriesVsExpensesRow{}
-	err := trackerDb.db.NewSelect().
+	err := trackerDb.reports.NewSelect().
 		With("expense_data",
-			trackerDb.db.NewSelect().
+			trackerDb.reports.NewSelect().
 				ColumnExpr("c.name as category").
 				ColumnExpr("SUM(CASE WHEN i.type = 'debit' THEN i.cost ELSE 0 END) AS expenses").
 				ColumnExpr("SUM(CASE WHEN i.type = 'credit' THEN i.cost ELSE 0 END) AS income").
 				TableExpr("item i").
 				Join("JOIN category c ON i.category_id = c.id").
 				Where("user_id = ?", userID).
+				Apply(analyticsScope(c)).
 				Group("c.name"),
 		).
 		TableExpr("expense_data").
 		Scan(ctx, &categories)
 	if err != nil {
 		log.Printf("Error while getting categories data: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondQueryError(c, err)
+	}
+
+	incomeSources := []IncomeSourceRow{}
+	err = trackerDb.reports.NewSelect().
+		ColumnExpr("COALESCE(c.name, 'Uncategorized') AS category").
+		ColumnExpr("SUM(i.cost) AS income").
+		ColumnExpr("COUNT(*) AS count").
+		TableExpr("item i").
+		Join("LEFT JOIN category c ON i.category_id = c.id").
+		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
+		Where("i.type = 'credit'").
+		GroupExpr("c.name").
+		OrderExpr("income DESC").
+		Scan(ctx, &incomeSources)
+	if err != nil {
+		log.Printf("Error while getting income sources data: %+v", err)
+		return respondQueryError(c, err)
 	}
 
 	incomeVsExpenses := IncomeVsExpenses{}
-	err = trackerDb.db.NewSelect().
+	err = trackerDb.reports.NewSelect().
 		ColumnExpr("SUM(CASE WHEN type = 'debit' THEN cost ELSE 0 END) AS expenses").
 		ColumnExpr("SUM(CASE WHEN type = 'credit' THEN cost ELSE 0 END) AS income").
 		TableExpr("item AS i").
 		Where("user_id = ?", userID).
+		Apply(analyticsScope(c)).
 		Scan(ctx, &incomeVsExpenses)
 	if err != nil {
 		log.Printf("Error while getting income v/s expenses data: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondQueryError(c, err)
 	}
 
 	monthly := []MonthlyExpensesRow{}
-	err = trackerDb.db.NewSelect().
-		ColumnExpr("TO_CHAR(\"createdAt\", 'MM') AS month").
-		ColumnExpr("TO_CHAR(\"createdAt\", 'YYYY') AS year").
-		ColumnExpr("sum(case when i.\"type\" = 'debit' then i.\"cost\" else 0 end) as expenses").
-		ColumnExpr("sum(case when i.\"type\" = 'credit' then i.\"cost\" else 0 end) as income").
-		TableExpr("item AS i").
-		Where("user_id = ?", userID).
-		Group("month").
-		Group("year").
-		Order("month").
+	err = trackerDb.reports.NewSelect().
+		ColumnExpr("bucket::date AS period").
+		ColumnExpr("TO_CHAR(bucket, ?) AS label", label).
+		ColumnExpr("EXTRACT(MONTH FROM bucket)::int AS month").
+		ColumnExpr("EXTRACT(YEAR FROM bucket)::int AS year").
+		ColumnExpr("expenses, income").
+		TableExpr("(?) AS series", trackerDb.reports.NewSelect().
+			ColumnExpr("date_trunc(?, created_at) AS bucket", granularity).
+			ColumnExpr("sum(case when i.\"type\" = 'debit' then i.\"cost\" else 0 end) as expenses").
+			ColumnExpr("sum(case when i.\"type\" = 'credit' then i.\"cost\" else 0 end) as income").
+			TableExpr("item AS i").
+			Where("user_id = ?", userID).
+			Apply(analyticsScope(c)).
+			GroupExpr("bucket")).
+		OrderExpr("bucket").
 		Scan(ctx, &monthly)
 	if err != nil {
 		log.Printf("Error while getting monthly data: %+v", err)
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondQueryError(c, err)
 	}
 
-	successData := map[string]interface{}{
-		"message": "ok",
-		"data": map[string]interface{}{
-			"categories":       categories,
-			"incomeVsExpenses": incomeVsExpenses,
-			"monthly":          monthly,
-		},
+	// Item costs are saved rounded, so rounding the sums only drops the
+	// float noise of adding them up.
+	for i := range categories {
+		categories[i].Expenses = roundMoney(categories[i].Expenses)
+		categories[i].Income = roundMoney(categories[i].Income)
+	}
+	for i := range incomeSources {
+		incomeSources[i].Income = roundMoney(incomeSources[i].Income)
+	}
+	incomeVsExpenses.Expenses = roundMoney(incomeVsExpenses.Expenses)
+	incomeVsExpenses.Income = roundMoney(incomeVsExpenses.Income)
+	for i := range monthly {
+		monthly[i].Expenses = roundMoney(monthly[i].Expenses)
+		monthly[i].Income = roundMoney(monthly[i].Income)
 	}
 
-	return c.JSON(http.StatusOK, successData)
+	sections := map[string]interface{}{
+		"categories":       categories,
+		"incomeSources":    incomeSources,
+		"incomeVsExpenses": incomeVsExpenses,
+		"monthly":          monthly,
+	}
+	if csvSection != "" {
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dashboard-%s.csv"`, csvSection))
+		return writeCSV(c, http.StatusOK, sections[csvSection])
+	}
+
+	return c.JSON(http.StatusOK, Envelope{Message: "ok", Data: sections})
 }
 
-func main() {
-	db := connect()
+// newTrackerDb sets up the server's state around a connected and migrated
+// database.
+func newTrackerDb(env *Env, db *bun.DB) (*trackerDb, error) {
+	var err error
+	moneyRounding, err = newRounding(env.RoundingMode, env.CashRounding, env.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("rounding can't be configured: %w", err)
+	}
+
+	rules, err := loadPolicy(env.PolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("authorization policy can't be loaded: %w", err)
+	}
+
+	trackerDb := &trackerDb{
+		db:          db,
+		env:         env,
+		ocr:         newOCRBackend(env),
+		maintenance: &maintenanceMode{},
+		rateLimit:   newRateLimiter(env.RateLimit),
+		policy:      rules,
+		widgets:     newWidgetCache(),
+		exports:     newConcurrencyLimiter(env.ExportConcurrency, 2),
+		imports:     newConcurrencyLimiter(env.ImportConcurrency, 1),
+		reports:     connectReports(env),
+	}
+	trackerDb.maintenance.set(MaintenanceStatus{Enabled: env.MaintenanceMode})
+	return trackerDb, nil
+}
+
+// newServer builds the HTTP server with its middleware and routes.
+func (trackerDb *trackerDb) newServer() *echo.Echo {
 	e := echo.New()
 	e.Use(middleware.CORS())
+	e.Use(trackerDb.rateLimit.middleware)
+	if trackerDb.env.LogBodies {
+		e.Use(bodyLogger())
+	}
+	e.Use(trackerDb.maintenance.middleware)
 
 	e.GET("/hello", func(c echo.Context) error {
 		return c.String(http.StatusOK, "Welcome")
 	})
 
-	trackerDb := &trackerDb{
-		db: db,
+	trackerDb.routes(e)
+	return e
+}
+
+// startJobs schedules the periodic jobs.
+func (trackerDb *trackerDb) startJobs() {
+	trackerDb.runDaily("balance snapshot", trackerDb.snapshotBalances)
+	trackerDb.runDaily("sheets sync", trackerDb.syncSheets)
+	trackerDb.runDaily("hook delivery cleanup", trackerDb.pruneHookDeliveries)
+	trackerDb.runDaily("item history cleanup", trackerDb.pruneItemHistory)
+	trackerDb.runDaily("job run cleanup", trackerDb.pruneJobRuns)
+	trackerDb.runDaily("backups", trackerDb.runBackups)
+	trackerDb.runDaily("card statement reminders", trackerDb.remindCardStatements)
+	trackerDb.runDaily("bill reminders", trackerDb.remindBills)
+	trackerDb.runDaily("loan reminders", trackerDb.remindLoans)
+	trackerDb.runHourly("scheduled items", trackerDb.promoteScheduledItems)
+	trackerDb.runHourly("import sources", trackerDb.pollImportSources)
+	trackerDb.runHourly("stalled imports", trackerDb.failStalledImports)
+	trackerDb.runHourly("weekly summary", trackerDb.sendWeeklySummaries)
+	trackerDb.runHourly("wallet passes", trackerDb.refreshWalletPasses)
+	trackerDb.runHourly("card spending limits", trackerDb.alertCardLimits)
+}
+
+func main() {
+	env := NewEnv()
+	db := connect(env)
+	migrateDb(db)
+	err := checkSchema(db)
+	if err != nil {
+		log.Fatal("Schema check failed: ", err)
 	}
 
-	apiv1 := e.Group("/api/v1")
-	apiv1.GET("/hello", func(c echo.Context) error {
-		return c.String(http.StatusOK, "Welcome")
-	})
-	apiv1.POST("/item", trackerDb.addItem)
-	apiv1.GET("/items", trackerDb.getAllItems)
-	apiv1.GET("/items/:id", trackerDb.getItemFromId)
-	apiv1.GET("/dashboard-data", trackerDb.getDashboardData)
-	apiv1.DELETE("/items/:id", trackerDb.deleteItem)
-	apiv1.PATCH("/update/item", trackerDb.updateItem)
+	trackerDb, err := newTrackerDb(env, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		err = trackerDb.runSeed(os.Args[2:])
+		if err != nil {
+			log.Fatal("Seeding failed: ", err)
+		}
+		return
+	}
 
+	trackerDb.startJobs()
+	e := trackerDb.newServer()
 	e.Logger.Fatal(e.Start(":1323"))
 }
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// SheetLink pushes a user's items to a Google Sheet. New items are appended
+// once a day, or on demand, as rows with the configured columns.
+type SheetLink struct {
+	bun.BaseModel `bun:"table:sheet_link,alias:sl"`
+
+	ID            uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID        int       `bun:"user_id" json:"user_id"`
+	SpreadsheetID string    `json:"spreadsheet_id"`
+	SheetName     string    `bun:",nullzero" json:"sheet_name"`
+	Columns       []string  `bun:",array" json:"columns"`
+	LastSyncedAt  time.Time `bun:",nullzero" json:"last_synced_at"`
+	CreatedAt     time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// sheetColumns are the columns a sheet can be mapped to, as SQL over item i
+// and category c. Everything is sent as text and typed by Sheets.
+var sheetColumns = map[string]string{
+	"date":         "to_char(i.created_at, 'YYYY-MM-DD')",
+	"name":         "i.name",
+	"display_name": "COALESCE(i.display_name, i.name)",
+	"cost":         "i.cost::text",
+	"type":         "i.type",
+	"category":     "c.name",
+	"status":       "i.status",
+	"id":           "i.id::text",
+}
+
+var defaultSheetColumns = []string{"date", "name", "cost", "type", "category"}
+
+var errSheetsDisabled = errors.New("google sheets sync is not configured")
+
+var sheetsClient = newOutboundClient(30 * time.Second)
+
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// sheetsToken exchanges a signed service account JWT for an access token.
+func (trackerDb *trackerDb) sheetsToken(ctx context.Context) (string, error) {
+	if trackerDb.env.GoogleCredentialsFile == "" {
+		return "", errSheetsDisabled
+	}
+	return trackerDb.googleToken(ctx, "https://www.googleapis.com/auth/spreadsheets")
+}
+
+// serviceAccount reads the key in GoogleCredentialsFile.
+func (trackerDb *trackerDb) serviceAccount() (*serviceAccount, *rsa.PrivateKey, error) {
+	b, err := os.ReadFile(trackerDb.env.GoogleCredentialsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sa serviceAccount
+	err = json.Unmarshal(b, &sa)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, nil, errors.New("service account private key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("service account private key is not RSA")
+	}
+	return &sa, key, nil
+}
+
+// signJWT signs claims with RS256.
+func signJWT(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// googleToken exchanges a signed service account JWT for an access token
+// to the Google API scope.
+func (trackerDb *trackerDb) googleToken(ctx context.Context, scope string) (string, error) {
+	sa, key, err := trackerDb.serviceAccount()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	assertion, err := signJWT(key, map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": scope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sa.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+
+	res, err := sheetsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return "", fmt.Errorf("google token: %s: %s", res.Status, msg)
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	return out.AccessToken, err
+}
+
+func appendSheetRows(ctx context.Context, token string, link *SheetLink, rows [][]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"values": rows})
+	if err != nil {
+		return err
+	}
+
+	rng := "'" + strings.ReplaceAll(link.SheetName, "'", "''") + "'!A1"
+	endpoint := "https://sheets.googleapis.com/v4/spreadsheets/" + url.PathEscape(link.SpreadsheetID) +
+		"/values/" + url.PathEscape(rng) + ":append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+
+	res, err := sheetsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("sheets api: %s: %s", res.Status, msg)
+	}
+	return nil
+}
+
+// syncSheet appends the items added since the link was last synced. The
+// first sync also writes a header row.
+func (trackerDb *trackerDb) syncSheet(ctx context.Context, token string, link *SheetLink) (int, error) {
+	var watermark sql.NullTime
+	err := trackerDb.db.NewSelect().
+		ColumnExpr("MAX(created_at)").
+		TableExpr("item").
+		Where("user_id = ?", link.UserID).
+		Scan(ctx, &watermark)
+	if err != nil {
+		return 0, err
+	}
+	if !watermark.Valid || !watermark.Time.After(link.LastSyncedAt) {
+		return 0, nil
+	}
+
+	q := trackerDb.db.NewSelect().
+		TableExpr("item AS i").
+		Join("LEFT JOIN category c ON c.id = i.category_id").
+		Where("i.user_id = ?", link.UserID).
+		Where("i.created_at <= ?", watermark.Time).
+		OrderExpr("i.created_at, i.id")
+	for _, col := range link.Columns {
+		q = q.ColumnExpr(sheetColumns[col]+" AS ?", bun.Ident(col))
+	}
+	if !link.LastSyncedAt.IsZero() {
+		q = q.Where("i.created_at > ?", link.LastSyncedAt)
+	}
+
+	var items []map[string]interface{}
+	err = q.Scan(ctx, &items)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := make([][]interface{}, 0, len(items)+1)
+	if link.LastSyncedAt.IsZero() {
+		header := make([]interface{}, len(link.Columns))
+		for i, col := range link.Columns {
+			header[i] = col
+		}
+		rows = append(rows, header)
+	}
+	for _, item := range items {
+		row := make([]interface{}, len(link.Columns))
+		for i, col := range link.Columns {
+			row[i] = item[col]
+			if row[i] == nil {
+				row[i] = ""
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	err = appendSheetRows(ctx, token, link, rows)
+	if err != nil {
+		return 0, err
+	}
+
+	link.LastSyncedAt = watermark.Time
+	_, err = trackerDb.db.NewUpdate().Model(link).Column("last_synced_at").WherePK().Exec(ctx)
+	return len(items), err
+}
+
+// syncSheets is the daily job that syncs every linked sheet.
+func (trackerDb *trackerDb) syncSheets(ctx context.Context, day time.Time) error {
+	links := []SheetLink{}
+	err := trackerDb.db.NewSelect().Model(&links).Scan(ctx)
+	if err != nil || len(links) == 0 {
+		return err
+	}
+
+	token, err := trackerDb.sheetsToken(ctx)
+	if errors.Is(err, errSheetsDisabled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range links {
+		_, err = trackerDb.syncSheet(ctx, token, &links[i])
+		if err != nil {
+			log.Printf("Error while syncing sheet %s: %v", links[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// linkSheet links the user's Google Sheet, replacing any existing link.
+// Changing the link starts the sheet over from the first item.
+func (trackerDb *trackerDb) linkSheet(c echo.Context) error {
+	ctx := context.Background()
+
+	link := new(SheetLink)
+	err := c.Bind(link)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if link.SpreadsheetID == "" {
+		return respondError(c, http.StatusBadRequest, "spreadsheet_id is required")
+	}
+	if len(link.Columns) == 0 {
+		link.Columns = defaultSheetColumns
+	}
+	for _, col := range link.Columns {
+		if _, ok := sheetColumns[col]; !ok {
+			return respondError(c, http.StatusBadRequest, "unknown column "+col)
+		}
+	}
+	link.LastSyncedAt = time.Time{}
+
+	_, err = trackerDb.db.NewInsert().
+		Model(link).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("spreadsheet_id = EXCLUDED.spreadsheet_id").
+		Set("sheet_name = EXCLUDED.sheet_name").
+		Set("columns = EXCLUDED.columns").
+		Set("last_synced_at = NULL").
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, link)
+}
+
+func (trackerDb *trackerDb) getSheetLink(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	var link SheetLink
+	err := trackerDb.db.NewSelect().Model(&link).Where("user_id = ?", userID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "No sheet linked")
+	}
+	if err != nil {
+		log.Printf("Could not fetch sheet link: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, link)
+}
+
+func (trackerDb *trackerDb) unlinkSheet(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("sheet_link").Where("user_id = ?", userID).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "No sheet linked")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// syncSheetNow runs the sync for one user without waiting for the job.
+func (trackerDb *trackerDb) syncSheetNow(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	var link SheetLink
+	err := trackerDb.db.NewSelect().Model(&link).Where("user_id = ?", userID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "No sheet linked")
+	}
+	if err != nil {
+		log.Printf("Could not fetch sheet link: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	token, err := trackerDb.sheetsToken(ctx)
+	if errors.Is(err, errSheetsDisabled) {
+		return respondError(c, http.StatusServiceUnavailable, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error while getting Google token: %v", err)
+		return respondError(c, http.StatusBadGateway, err.Error())
+	}
+
+	n, err := trackerDb.syncSheet(ctx, token, &link)
+	if err != nil {
+		log.Printf("Error while syncing sheet: %v", err)
+		return respondError(c, http.StatusBadGateway, err.Error())
+	}
+
+	return respondOK(c, map[string]interface{}{"appended": n, "last_synced_at": link.LastSyncedAt})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// smsPattern recognizes one bank's transaction SMS. The regexp uses the
+// named groups amount (required), and optionally type (debited/credited and
+// friends), account (card or account tail digits) and merchant.
+type smsPattern struct {
+	Bank string
+	Re   *regexp.Regexp
+}
+
+var errMissingAmountGroup = errors.New("pattern needs an (?P<amount>...) group")
+
+const smsAmount = `(?:rs\.?|inr)\s*(?P<amount>[\d,]+(?:\.\d+)?)`
+
+var smsPatterns = []smsPattern{
+	{"HDFC", regexp.MustCompile(`(?i)` + smsAmount + `\s+(?P<type>debited|credited)\s+(?:from|to)\s+(?:hdfc bank\s+)?a/c\s+[x*]*(?P<account>\d{3,6}).*?\b(?:to|by|from)\s+(?:vpa\s+)?(?P<merchant>[^\s(]+)`)},
+	{"HDFC", regexp.MustCompile(`(?i)sent\s+` + smsAmount + `\s+from\s+hdfc bank\s+a/c\s+[x*]*(?P<account>\d{3,6})\s+to\s+(?P<merchant>.+?)\s+on\b`)},
+	{"ICICI", regexp.MustCompile(`(?i)icici bank acc?t\s+[x*]*(?P<account>\d{3,6})\s+(?P<type>debited|credited)\s+(?:for|with)\s+` + smsAmount + `.*?;\s*(?P<merchant>.+?)\s+(?:credited|debited)`)},
+	{"SBI", regexp.MustCompile(`(?i)a/c\s+[x*]*(?P<account>\d{3,6})\s+(?P<type>debited|credited)\s+(?:by\s+)?` + smsAmount + `.*?(?:transferred to|trf to|to)\s+(?P<merchant>[^.]+)`)},
+	{"Axis", regexp.MustCompile(`(?i)` + smsAmount + `\s+(?P<type>debited|credited|spent)\s+(?:from|to|on)\s+(?:axis bank\s+)?(?:a/c|card)\s+(?:no\.?\s+)?[x*]*(?P<account>\d{3,6}).*?\bat\s+(?P<merchant>[^.]+)`)},
+	{"Generic", regexp.MustCompile(`(?i)` + smsAmount + `.*?\b(?P<type>debited|credited|spent|received|sent)\b`)},
+}
+
+type SMSTemplate struct {
+	bun.BaseModel `bun:"table:sms_template,alias:st"`
+
+	ID        uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID    int       `bun:"user_id" json:"user_id"`
+	Bank      string    `json:"bank"`
+	Pattern   string    `json:"pattern"`
+	CreatedAt time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+type SMSTransaction struct {
+	Bank     string  `json:"bank"`
+	Amount   float64 `json:"amount"`
+	Type     string  `json:"type"`
+	Account  string  `json:"account"`
+	Merchant string  `json:"merchant"`
+}
+
+// parseSMS tries each pattern in order and returns the first match.
+func parseSMS(patterns []smsPattern, message string) (SMSTransaction, bool) {
+	for _, p := range patterns {
+		m := p.Re.FindStringSubmatch(message)
+		if m == nil {
+			continue
+		}
+
+		tx := SMSTransaction{Bank: p.Bank, Type: "debit"}
+		for i, name := range p.Re.SubexpNames() {
+			v := strings.TrimSpace(m[i])
+			switch name {
+			case "amount":
+				tx.Amount, _ = strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64)
+			case "type":
+				switch strings.ToLower(v) {
+				case "credited", "received":
+					tx.Type = "credit"
+				}
+			case "account":
+				tx.Account = v
+			case "merchant":
+				tx.Merchant = v
+			}
+		}
+		if tx.Amount > 0 {
+			return tx, true
+		}
+	}
+	return SMSTransaction{}, false
+}
+
+func compileSMSTemplate(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.SubexpIndex("amount") < 0 {
+		return nil, errMissingAmountGroup
+	}
+	return re, nil
+}
+
+type IngestSMSRequest struct {
+	UserID  int    `json:"user_id"`
+	Message string `json:"message"`
+}
+
+// ingestSMS parses a bank transaction SMS with the user's own templates
+// first and then the built-in library, and stages the result.
+func (trackerDb *trackerDb) ingestSMS(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(IngestSMSRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	templates := []SMSTemplate{}
+	err = trackerDb.db.NewSelect().Model(&templates).Where("user_id = ?", req.UserID).Order("created_at").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting sms templates: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	patterns := make([]smsPattern, 0, len(templates)+len(smsPatterns))
+	for _, t := range templates {
+		re, err := compileSMSTemplate(t.Pattern)
+		if err != nil {
+			log.Printf("Skipping invalid sms template %s: %v", t.ID, err)
+			continue
+		}
+		patterns = append(patterns, smsPattern{Bank: t.Bank, Re: re})
+	}
+	patterns = append(patterns, smsPatterns...)
+
+	tx, ok := parseSMS(patterns, req.Message)
+	if !ok {
+		return respondError(c, http.StatusUnprocessableEntity, "Message did not match any bank format")
+	}
+
+	staged := &StagedItem{
+		UserID:     req.UserID,
+		Source:     "sms",
+		Name:       tx.Merchant,
+		Cost:       tx.Amount,
+		Type:       tx.Type,
+		OccurredOn: Date{time.Now().UTC()},
+		Details: map[string]interface{}{
+			"bank":    tx.Bank,
+			"account": tx.Account,
+			"message": req.Message,
+		},
+	}
+	err = trackerDb.stage(ctx, staged)
+	if err != nil {
+		log.Printf("Error while staging item: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, staged)
+}
+
+func (trackerDb *trackerDb) addSMSTemplate(c echo.Context) error {
+	ctx := context.Background()
+
+	template := new(SMSTemplate)
+	err := c.Bind(template)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	_, err = compileSMSTemplate(template.Pattern)
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	template.ID = uuid.Nil
+
+	_, err = trackerDb.db.NewInsert().Model(template).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, "", template)
+}
+
+func (trackerDb *trackerDb) getAllSMSTemplates(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	templates := []SMSTemplate{}
+	err := trackerDb.db.NewSelect().Model(&templates).Where("user_id = ?", userID).Order("created_at").Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting sms templates: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, templates)
+}
+
+func (trackerDb *trackerDb) deleteSMSTemplate(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("sms_template").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "SMS template not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// snapshotBalances records the closing balance of every user's ledgers for
+// day. Running it again for the same day overwrites the earlier snapshots.
+func (trackerDb *trackerDb) snapshotBalances(ctx context.Context, day time.Time) error {
+	_, err := trackerDb.db.NewRaw(`
+		INSERT INTO balance_snapshot (user_id, profile_id, taken_on, balance)
+		SELECT user_id, profile_id, ?, SUM(CASE WHEN type = 'credit' THEN cost ELSE -cost END)
+		FROM item
+		WHERE created_at < ? AND NOT scheduled
+		GROUP BY user_id, profile_id
+		ON CONFLICT (user_id, (COALESCE(profile_id, '00000000-0000-0000-0000-000000000000'::uuid)), taken_on)
+		DO UPDATE SET balance = EXCLUDED.balance`,
+		day.Format(time.DateOnly), day.AddDate(0, 0, 1),
+	).Exec(ctx)
+	return err
+}
+
+type BalanceSnapshotRow struct {
+	TakenOn time.Time `bun:"taken_on" json:"date"`
+	Balance float64   `bun:"balance" json:"balance"`
+}
+
+func (trackerDb *trackerDb) getBalanceHistory(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	history := []BalanceSnapshotRow{}
+	q := trackerDb.db.NewSelect().
+		Column("taken_on", "balance").
+		TableExpr("balance_snapshot").
+		Where("user_id = ?", userID).
+		Apply(inProfile(currentProfile(c))).
+		Order("taken_on")
+	err = p.where(q, "taken_on").Scan(ctx, &history)
+	if err != nil {
+		log.Printf("Error while getting balance history: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, history)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// StagedItem is a transaction picked up by an ingestion source such as
+// receipt OCR. It waits in staging until the user confirms it, which turns
+// it into an item, or discards it.
+type StagedItem struct {
+	bun.BaseModel `bun:"table:staged_item,alias:si"`
+
+	ID          uuid.UUID              `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID      int                    `bun:"user_id" json:"user_id"`
+	Source      string                 `json:"source"`
+	Name        string                 `json:"name"`
+	DisplayName string                 `bun:",nullzero" json:"display_name"`
+	Cost        float64                `json:"cost"`
+	Type        string                 `bun:",nullzero" json:"type"`
+	CategoryID  uuid.UUID              `bun:"type:uuid,nullzero" json:"category_id"`
+	OccurredOn  Date                   `bun:"type:date,nullzero" json:"occurred_on"`
+	Details     map[string]interface{} `bun:"type:jsonb" json:"details"`
+	// ImportBatchID is the statement import that staged the item, if any;
+	// confirming the item carries it over.
+	ImportBatchID uuid.UUID `bun:"type:uuid,nullzero" json:"import_batch_id"`
+	CreatedAt     time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// stage enriches an ingested item's merchant name and category and saves
+// it for confirmation. Items still without a category get one from the
+// user's history if the classifier is confident.
+func (trackerDb *trackerDb) stage(ctx context.Context, staged *StagedItem) error {
+	m, err := trackerDb.enrichMerchant(ctx, staged.UserID, staged.Name)
+	if err != nil {
+		return err
+	}
+	staged.DisplayName = m.DisplayName
+	if staged.CategoryID == uuid.Nil {
+		staged.CategoryID = m.CategoryID
+	}
+	if staged.CategoryID == uuid.Nil {
+		staged.CategoryID, err = trackerDb.suggestCategory(ctx, staged.UserID, staged.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = trackerDb.db.NewInsert().Model(staged).Returning("*").Exec(ctx)
+	return err
+}
+
+func (trackerDb *trackerDb) getAllStagedItems(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	q := trackerDb.db.NewSelect().
+		Model((*StagedItem)(nil)).
+		Where("user_id = ?", userID).
+		Order("created_at")
+	if source := c.QueryParam("source"); source != "" {
+		q = q.Where("source = ?", source)
+	}
+
+	staged := []StagedItem{}
+	err := q.Scan(ctx, &staged)
+	if err != nil {
+		log.Printf("Error while getting staged items: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, staged)
+}
+
+// StagedCurrency is the part of a confirm body that says the staged amount
+// was in a foreign currency. Unless original_amount is given, the staged
+// cost is taken to be in original_currency and converted at exchange_rate.
+type StagedCurrency struct {
+	OriginalAmount   float64 `json:"original_amount"`
+	OriginalCurrency string  `json:"original_currency"`
+	ExchangeRate     float64 `json:"exchange_rate"`
+	RateDate         Date    `json:"rate_date"`
+}
+
+// confirmStagedItem turns a staged item into a real one. Fields in the
+// request body override what the ingestion source extracted. The item is
+// saved like any other new item: it goes into the request's profile, is
+// scheduled if dated in the future and is held to its category's hard cap
+// unless override_cap=true.
+func (trackerDb *trackerDb) confirmStagedItem(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	// The transaction may be retried, so read the overrides up front.
+	overrides, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Printf("Error while reading body: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	overrideCap := c.QueryParam("override_cap") == "true"
+
+	var item *Item
+	err = trackerDb.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		staged := new(StagedItem)
+		err := tx.NewSelect().Model(staged).Where("id = ?", id).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		var currency StagedCurrency
+		if len(overrides) != 0 {
+			id, userID := staged.ID, staged.UserID
+			err = json.Unmarshal(overrides, staged)
+			if err == nil {
+				err = json.Unmarshal(overrides, &currency)
+			}
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			staged.ID, staged.UserID = id, userID
+		}
+
+		item = &Item{
+			Name:          staged.Name,
+			DisplayName:   staged.DisplayName,
+			Cost:          staged.Cost,
+			Type:          staged.Type,
+			CategoryID:    staged.CategoryID,
+			UserID:        staged.UserID,
+			CreatedAt:     staged.OccurredOn.Time,
+			ImportBatchID: staged.ImportBatchID,
+			ProfileID:     currentProfile(c),
+		}
+		if currency.OriginalCurrency != "" {
+			item.OriginalAmount = currency.OriginalAmount
+			if item.OriginalAmount == 0 {
+				item.OriginalAmount, item.Cost = staged.Cost, 0
+			}
+			item.OriginalCurrency = currency.OriginalCurrency
+			item.ExchangeRate = currency.ExchangeRate
+			item.RateDate = currency.RateDate
+		}
+		if msg := item.applyExchangeRate(); msg != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, msg)
+		}
+
+		err = trackerDb.insertItem(ctx, tx, item, overrideCap)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().Model(staged).WherePK().Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Staged item not found")
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return respondError(c, httpErr.Code, fmt.Sprint(httpErr.Message))
+	}
+	if err != nil {
+		return respondItemError(c, err, "confirming staged item")
+	}
+	trackerDb.fireHooks(item.UserID, eventItemCreated, item)
+
+	return respondCreated(c, apiPath(c, "/items/"+item.ID.String()), item)
+}
+
+func (trackerDb *trackerDb) deleteStagedItem(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("staged_item").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Staged item not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestStagedItem stages a debit for the user as an ingestion source
+// would.
+func createTestStagedItem(t *testing.T, userID int) *StagedItem {
+	t.Helper()
+
+	staged := &StagedItem{UserID: userID, Source: "sms", Name: "Cafe", Cost: 80, Type: "debit", OccurredOn: Date{today()}}
+	_, err := testTracker.db.NewInsert().Model(staged).Returning("*").Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return staged
+}
+
+func TestConfirmStagedItem(t *testing.T) {
+	userID := newTestUser(t)
+	staged := createTestStagedItem(t, userID)
+
+	rec := request(t, http.MethodGet, fmt.Sprintf("/api/v2/staged-items?user_id=%d&source=sms", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var list []StagedItem
+	decodeData(t, rec, &list)
+	if len(list) != 1 || list[0].ID != staged.ID {
+		t.Fatalf("staged items are %+v, want just %s", list, staged.ID)
+	}
+
+	rec = request(t, http.MethodPost, "/api/v2/staged-items/"+staged.ID.String()+"/confirm", map[string]interface{}{"cost": 90.0})
+	expectStatus(t, rec, http.StatusCreated)
+	var item Item
+	decodeData(t, rec, &item)
+	if item.Name != "Cafe" || item.Cost != 90 || item.UserID != userID {
+		t.Errorf("confirmed %+v, want Cafe for 90", item)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/staged-items?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	decodeData(t, rec, &list)
+	if len(list) != 0 {
+		t.Errorf("confirming left %+v staged", list)
+	}
+}
+
+func TestStagedItemErrors(t *testing.T) {
+	userID := newTestUser(t)
+	staged := createTestStagedItem(t, userID)
+
+	rec := request(t, http.MethodPost, "/api/v2/staged-items/"+staged.ID.String()+"/confirm", map[string]interface{}{"cost": "lots"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = request(t, http.MethodPost, "/api/v2/staged-items/"+uuid.NewString()+"/confirm", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = request(t, http.MethodDelete, "/api/v2/staged-items/"+uuid.NewString(), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = request(t, http.MethodDelete, "/api/v2/staged-items/"+staged.ID.String(), nil)
+	expectStatus(t, rec, http.StatusNoContent)
+}
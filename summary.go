@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// SummarySetting is when a user's weekly summary is sent: on Weekday
+// (0 is Sunday) at Hour, UTC. Users without a row get Monday at midnight.
+type SummarySetting struct {
+	bun.BaseModel `bun:"table:summary_setting,alias:ss"`
+
+	UserID  int  `bun:"user_id,pk" json:"user_id"`
+	Enabled bool `json:"enabled"`
+	Weekday int  `json:"weekday"`
+	Hour    int  `json:"hour"`
+}
+
+var defaultSummarySetting = SummarySetting{Enabled: true, Weekday: int(time.Monday), Hour: 0}
+
+type categorySpend struct {
+	Category string
+	Week     float64
+	Average  float64
+}
+
+// weeklySummary compares the user's spending per category over the week
+// before end with their average week over the eight weeks before that.
+// Amounts are written for the user's locale.
+func (trackerDb *trackerDb) weeklySummary(ctx context.Context, userID int, end time.Time) (string, error) {
+	weekStart := end.AddDate(0, 0, -7)
+	histStart := weekStart.AddDate(0, 0, -8*7)
+
+	var rows []categorySpend
+	err := trackerDb.db.NewSelect().
+		ColumnExpr("COALESCE(c.name, 'Uncategorized') AS category").
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE i.created_at >= ?), 0) AS week", weekStart).
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE i.created_at < ?), 0) / 8 AS average", weekStart).
+		TableExpr("item AS i").
+		Join("LEFT JOIN category c ON c.id = i.category_id").
+		Where("i.user_id = ?", userID).
+		Where("i.type = 'debit'").
+		Where("NOT i.reimbursed").
+		Where("NOT i.adjustment").
+		Where("NOT i.excluded").
+		Where("i.created_at >= ?", histStart).
+		Where("i.created_at < ?", end).
+		Group("c.name").
+		OrderExpr("week DESC, average DESC").
+		Scan(ctx, &rows)
+	if err != nil {
+		return "", err
+	}
+	money, err := trackerDb.moneyFormat(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var week, average float64
+	var b strings.Builder
+	for _, r := range rows {
+		week += r.Week
+		average += r.Average
+		fmt.Fprintf(&b, "\n%s: %s%s", r.Category, money.format(r.Week), versus(money, r.Week, r.Average))
+	}
+
+	return fmt.Sprintf("Week of %s: spent %s%s", weekStart.Format("2 Jan"), money.format(week), versus(money, week, average)) + b.String(), nil
+}
+
+// versus describes how amount compares to average, e.g. " (avg ₹950.00, +26%)".
+func versus(money moneyFormat, amount, average float64) string {
+	if average == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (avg %s, %+.0f%%)", money.format(average), (amount-average)/average*100)
+}
+
+// sendWeeklySummaries runs every hour and sends the weekly summary to the
+// users with a notification channel whose schedule falls on this hour.
+func (trackerDb *trackerDb) sendWeeklySummaries(ctx context.Context, hour time.Time) error {
+	var userIDs []int
+	err := trackerDb.db.NewSelect().
+		ColumnExpr("DISTINCT nc.user_id").
+		TableExpr("notification_channel AS nc").
+		Join("LEFT JOIN summary_setting ss ON ss.user_id = nc.user_id").
+		Where("COALESCE(ss.enabled, ?)", defaultSummarySetting.Enabled).
+		Where("COALESCE(ss.weekday, ?) = ?", defaultSummarySetting.Weekday, int(hour.Weekday())).
+		Where("COALESCE(ss.hour, ?) = ?", defaultSummarySetting.Hour, hour.Hour()).
+		Scan(ctx, &userIDs)
+	if err != nil {
+		return err
+	}
+
+	end := hour.Truncate(24 * time.Hour)
+	for _, userID := range userIDs {
+		text, err := trackerDb.weeklySummary(ctx, userID, end)
+		if err == nil {
+			err = trackerDb.notify(ctx, userID, text)
+		}
+		if err != nil {
+			log.Printf("Error while sending weekly summary to user %d: %+v", userID, err)
+		}
+	}
+	return nil
+}
+
+func (trackerDb *trackerDb) putSummarySetting(c echo.Context) error {
+	ctx := context.Background()
+
+	setting := new(SummarySetting)
+	*setting = defaultSummarySetting
+	err := c.Bind(setting)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if setting.Weekday < 0 || setting.Weekday > 6 {
+		return respondError(c, http.StatusBadRequest, "weekday must be between 0 (Sunday) and 6")
+	}
+	if setting.Hour < 0 || setting.Hour > 23 {
+		return respondError(c, http.StatusBadRequest, "hour must be between 0 and 23")
+	}
+
+	_, err = trackerDb.db.NewInsert().
+		Model(setting).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("enabled = EXCLUDED.enabled").
+		Set("weekday = EXCLUDED.weekday").
+		Set("hour = EXCLUDED.hour").
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, setting)
+}
+
+func (trackerDb *trackerDb) getSummarySetting(c echo.Context) error {
+	ctx := context.Background()
+	userID, err := strconv.Atoi(c.QueryParam("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+
+	setting := defaultSummarySetting
+	setting.UserID = userID
+	err = trackerDb.db.NewSelect().Model(&setting).WherePK().Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Could not fetch summary setting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, setting)
+}
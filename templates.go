@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// ItemTemplate holds the fields of an item the user enters often, such as
+// a daily coffee, so it can be added in one call.
+type ItemTemplate struct {
+	bun.BaseModel `bun:"table:item_template,alias:it"`
+
+	ID         uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	UserID     int       `bun:"user_id" json:"user_id"`
+	Name       string    `json:"name"`
+	Cost       float64   `json:"cost"`
+	Type       string    `json:"type"`
+	CategoryID uuid.UUID `bun:"type:uuid,nullzero" json:"category_id"`
+	ProfileID  uuid.UUID `bun:"type:uuid,nullzero" json:"profile_id"`
+	CreatedAt  time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+func (t *ItemTemplate) validate() string {
+	if t.Name == "" {
+		return "name is required"
+	}
+	if t.Cost <= 0 {
+		return "cost must be positive"
+	}
+	if t.Type == "" {
+		t.Type = "debit"
+	}
+	if t.Type != "debit" && t.Type != "credit" {
+		return "type must be debit or credit"
+	}
+	return ""
+}
+
+// itemFromTemplate creates an item from a template, dated at and costing
+// cost when those are not zero. It returns sql.ErrNoRows when there is no
+// template with that id, and otherwise fails like createItem.
+func (trackerDb *trackerDb) itemFromTemplate(ctx context.Context, id string, at time.Time, cost float64, overrideCap bool) (*Item, error) {
+	t := new(ItemTemplate)
+	err := trackerDb.db.NewSelect().Model(t).Where("id = ?", id).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &Item{
+		Name:       t.Name,
+		Cost:       t.Cost,
+		Type:       t.Type,
+		CategoryID: t.CategoryID,
+		UserID:     t.UserID,
+		CreatedAt:  at,
+		ProfileID:  t.ProfileID,
+	}
+	if cost != 0 {
+		item.Cost = cost
+	}
+
+	err = trackerDb.createItem(ctx, item, overrideCap)
+	return item, err
+}
+
+func (trackerDb *trackerDb) addItemTemplate(c echo.Context) error {
+	ctx := context.Background()
+
+	t := new(ItemTemplate)
+	err := c.Bind(t)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if msg := t.validate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	t.ID = uuid.Nil
+	if profile := currentProfile(c); profile != uuid.Nil {
+		t.ProfileID = profile
+	}
+
+	_, err = trackerDb.db.NewInsert().Model(t).Returning("*").Exec(ctx)
+	if err != nil {
+		log.Printf("Error executing insert: %v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, "", t)
+}
+
+func (trackerDb *trackerDb) getAllItemTemplates(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	templates := []ItemTemplate{}
+	err := trackerDb.db.NewSelect().
+		Model(&templates).
+		Where("user_id = ?", userID).
+		Apply(inProfile(currentProfile(c))).
+		Order("name").
+		Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting item templates: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, templates)
+}
+
+// updateItemTemplate replaces a template's name, cost, type and category.
+func (trackerDb *trackerDb) updateItemTemplate(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	t := new(ItemTemplate)
+	err := c.Bind(t)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if msg := t.validate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+
+	err = trackerDb.db.NewUpdate().
+		Model(t).
+		Column("name", "cost", "type", "category_id").
+		Where("id = ?", id).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Item template not found")
+	}
+	if err != nil {
+		log.Printf("Error while updating: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, t)
+}
+
+func (trackerDb *trackerDb) deleteItemTemplate(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	res, err := trackerDb.db.NewDelete().TableExpr("item_template").Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		log.Printf("Error while deleting: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return respondError(c, http.StatusNotFound, "Item template not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+//go:build integration
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+)
+
+// TestTotalsMatchItems checks that the list summary and the dashboard add
+// up to the sum of the items as they are shown, each rounded to cents,
+// even when the costs sent had fractions of a cent.
+func TestTotalsMatchItems(t *testing.T) {
+	userID := newTestUser(t)
+
+	category := createTestCategory(t)
+
+	sent := []struct {
+		cost float64
+		typ  string
+	}{
+		{0.125, "debit"},
+		{0.125, "debit"},
+		{10.005, "debit"},
+		{0.1, "debit"},
+		{0.2, "debit"},
+		{19.994, "debit"},
+		{2.675, "credit"},
+		{1000.0049, "credit"},
+		{0.335, "credit"},
+	}
+	for _, s := range sent {
+		item := createTestItem(t, userID, map[string]interface{}{
+			"cost":        s.cost,
+			"type":        s.typ,
+			"category_id": category.ID,
+		})
+		if want := roundMoney(s.cost); item.Cost != want {
+			t.Errorf("cost %v was saved as %v, want %v", s.cost, item.Cost, want)
+		}
+	}
+
+	rec := request(t, http.MethodGet, fmt.Sprintf("/api/v2/items?user_id=%d&limit=100", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var items []ItemV2
+	env := Envelope{Data: &items}
+	err := json.Unmarshal(rec.Body.Bytes(), &env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != len(sent) {
+		t.Fatalf("listed %d items, want %d", len(items), len(sent))
+	}
+
+	// The expected totals are added up in whole cents, so they are exact.
+	var debitCents, creditCents int64
+	for _, item := range items {
+		cents := int64(math.Round(item.Cost * 100))
+		if float64(cents)/100 != item.Cost {
+			t.Errorf("item %s costs %v, which isn't whole cents", item.ID, item.Cost)
+		}
+		if item.Type == "debit" {
+			debitCents += cents
+		} else {
+			creditCents += cents
+		}
+	}
+	debits := float64(debitCents) / 100
+	credits := float64(creditCents) / 100
+	net := float64(creditCents-debitCents) / 100
+
+	summary := env.Meta.Summary
+	if summary.Debits != debits || summary.Credits != credits || summary.Net != net {
+		t.Errorf("list summary is %+v, want debits %v, credits %v and net %v", *summary, debits, credits, net)
+	}
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/dashboard-data?user_id=%d", userID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var dashboard struct {
+		Categories       []CategoriesVsExpensesRow `json:"categories"`
+		IncomeSources    []IncomeSourceRow         `json:"incomeSources"`
+		IncomeVsExpenses IncomeVsExpenses          `json:"incomeVsExpenses"`
+		Monthly          []MonthlyExpensesRow      `json:"monthly"`
+	}
+	decodeData(t, rec, &dashboard)
+
+	if got := dashboard.IncomeVsExpenses; got.Expenses != debits || got.Income != credits {
+		t.Errorf("income vs expenses is %+v, want expenses %v and income %v", got, debits, credits)
+	}
+	if len(dashboard.Categories) != 1 {
+		t.Fatalf("categories are %+v, want just %s", dashboard.Categories, category.Name)
+	}
+	if got := dashboard.Categories[0]; got.Expenses != debits || got.Income != credits {
+		t.Errorf("category totals are %+v, want expenses %v and income %v", got, debits, credits)
+	}
+	if len(dashboard.IncomeSources) != 1 || dashboard.IncomeSources[0].Income != credits {
+		t.Errorf("income sources are %+v, want %v", dashboard.IncomeSources, credits)
+	}
+	var monthlyExpenses, monthlyIncome int64
+	for _, m := range dashboard.Monthly {
+		monthlyExpenses += int64(math.Round(m.Expenses * 100))
+		monthlyIncome += int64(math.Round(m.Income * 100))
+	}
+	if monthlyExpenses != debitCents || monthlyIncome != creditCents {
+		t.Errorf("monthly totals add up to %d and %d cents, want %d and %d", monthlyExpenses, monthlyIncome, debitCents, creditCents)
+	}
+}
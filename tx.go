@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/uptrace/bun"
+)
+
+// errCommitUnknown wraps a failed commit that may still have gone through,
+// which retry must not repeat.
+type errCommitUnknown struct{ err error }
+
+func (e errCommitUnknown) Error() string { return e.err.Error() }
+func (e errCommitUnknown) Unwrap() error { return e.err }
+
+// RunInTx runs fn in a serializable transaction, rolling back if fn returns
+// an error and committing otherwise. Transactions that lose a race with
+// another or hit a transient failure before committing are retried, so fn
+// must not have side effects outside tx.
+func (trackerDb *trackerDb) RunInTx(ctx context.Context, fn func(ctx context.Context, tx bun.Tx) error) error {
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	err := retry(ctx, func() error {
+		tx, err := trackerDb.db.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		err = fn(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil && !serializationFailure(err) {
+			return errCommitUnknown{err}
+		}
+		return err
+	})
+
+	var unknown errCommitUnknown
+	if errors.As(err, &unknown) {
+		return unknown.err
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// uploadRule says what a kind of upload may be. Types are media types as
+// sniffed from the content, so a renamed file doesn't get through.
+type uploadRule struct {
+	Name    string
+	MaxSize int64
+	Types   []string
+}
+
+func (trackerDb *trackerDb) receiptUploads() uploadRule {
+	return uploadRule{
+		Name:    "receipt",
+		MaxSize: megabytes(trackerDb.env.ReceiptMaxMB, 10),
+		Types:   []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp"},
+	}
+}
+
+// statementUploads accepts the text formats statements come in: CSV, QIF
+// and OFX sniff as text/plain, OFX 2 as text/xml.
+func (trackerDb *trackerDb) statementUploads() uploadRule {
+	return uploadRule{
+		Name:    "statement",
+		MaxSize: megabytes(trackerDb.env.StatementMaxMB, 5),
+		Types:   []string{"text/plain", "text/xml"},
+	}
+}
+
+func megabytes(configured, fallback int) int64 {
+	if configured <= 0 {
+		configured = fallback
+	}
+	return int64(configured) << 20
+}
+
+// UploadRejected is returned when an uploaded file fails validation. Code
+// is one of missing, too_large, unsupported_type, infected or
+// scan_failed.
+type UploadRejected struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+func (e *UploadRejected) Error() string {
+	return e.Reason
+}
+
+func (e *UploadRejected) status() int {
+	switch e.Code {
+	case "missing":
+		return http.StatusBadRequest
+	case "too_large":
+		return http.StatusRequestEntityTooLarge
+	case "unsupported_type":
+		return http.StatusUnsupportedMediaType
+	case "scan_failed":
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// respondRejected answers a request whose upload failed validation.
+func respondRejected(c echo.Context, e *UploadRejected) error {
+	return c.JSON(e.status(), Envelope{Message: localize(c, e.Error()), Data: e})
+}
+
+// multipartOverhead is how much of a request body may go to the form's
+// other fields and boundaries on top of the file itself.
+const multipartOverhead = 1 << 20
+
+// readUpload reads the multipart file in field and checks it against rule.
+// It fails with an *UploadRejected if the file is missing or not
+// acceptable. It must come before anything else reads the form, so that
+// an oversized body is cut off rather than parsed in full.
+func (trackerDb *trackerDb) readUpload(c echo.Context, field string, rule uploadRule) ([]byte, error) {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, rule.MaxSize+multipartOverhead)
+
+	file, err := c.FormFile(field)
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		return nil, rule.tooLarge()
+	}
+	if err != nil {
+		return nil, &UploadRejected{Code: "missing", Reason: field + " file is required"}
+	}
+	if file.Size > rule.MaxSize {
+		return nil, rule.tooLarge()
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, rule.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	return data, trackerDb.checkUpload(context.Background(), rule, data)
+}
+
+func (rule uploadRule) tooLarge() *UploadRejected {
+	return &UploadRejected{Code: "too_large", Reason: fmt.Sprintf("%s is larger than %dMB", rule.Name, rule.MaxSize>>20)}
+}
+
+// checkUpload validates a file's size and sniffed type and, when CLAMD_ADDRESS
+// is set, has ClamAV scan it. It fails with an *UploadRejected if the file
+// is not acceptable.
+func (trackerDb *trackerDb) checkUpload(ctx context.Context, rule uploadRule, data []byte) error {
+	if int64(len(data)) > rule.MaxSize {
+		return rule.tooLarge()
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	accepted := false
+	for _, t := range rule.Types {
+		accepted = accepted || sniffed == t
+	}
+	if !accepted {
+		return &UploadRejected{
+			Code:   "unsupported_type",
+			Reason: fmt.Sprintf("%s looks like %s; expected one of %s", rule.Name, sniffed, strings.Join(rule.Types, ", ")),
+		}
+	}
+
+	if trackerDb.env.ClamdAddress == "" {
+		return nil
+	}
+	signature, err := clamScan(ctx, trackerDb.env.ClamdAddress, data)
+	if err != nil {
+		return &UploadRejected{Code: "scan_failed", Reason: "The virus scanner is unavailable; try again later"}
+	}
+	if signature != "" {
+		return &UploadRejected{Code: "infected", Reason: fmt.Sprintf("%s was flagged by the virus scanner (%s)", rule.Name, signature)}
+	}
+	return nil
+}
+
+// clamChunk is how much is sent to clamd at a time.
+const clamChunk = 64 << 10
+
+// clamScan streams data to clamd with the INSTREAM command and returns the
+// name of the signature it matched, or "" if the data is clean. address is
+// host:port or unix:/path/to/clamd.sock.
+func clamScan(ctx context.Context, address string, data []byte) (string, error) {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return "", err
+	}
+	for len(data) > 0 {
+		n := min(len(data), clamChunk)
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(n))
+		_, err = conn.Write(append(size[:], data[:n]...))
+		if err != nil {
+			return "", err
+		}
+		data = data[n:]
+	}
+	_, err = conn.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		return "", err
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	// Replies look like "stream: OK", "stream: Eicar-Signature FOUND" or
+	// "INSTREAM size limit exceeded. ERROR".
+	result := strings.TrimPrefix(string(bytes.TrimRight(reply, "\x00\n")), "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd: %s", result)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// User is registered with POST /users, or by the seed command, before
+// anything can be saved under its user_id. LegacyID is that integer id,
+// which every table and endpoint still keys on; ID is the UUID auth and
+// sharing will use.
+type User struct {
+	bun.BaseModel `bun:"table:users,alias:u"`
+
+	ID        uuid.UUID `bun:",pk,default:gen_random_uuid()" json:"id"`
+	LegacyID  int       `bun:"legacy_id,nullzero" json:"legacy_id"`
+	CreatedAt time.Time `bun:",nullzero,default:now()" json:"created_at"`
+}
+
+// getMe returns the user behind ?user_id=, so clients can learn their
+// UUID.
+func (trackerDb *trackerDb) getMe(c echo.Context) error {
+	ctx := context.Background()
+
+	user := new(User)
+	err := trackerDb.db.NewSelect().
+		Model(user).
+		Where("legacy_id = ?", c.QueryParam("user_id")).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		log.Printf("Error while getting user: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, user)
+}
+
+// RegisterUserRequest is the body of POST /users. UserID is the id to
+// register, for clients that already use one; a new id is assigned when it
+// is left out.
+type RegisterUserRequest struct {
+	UserID int `json:"user_id"`
+}
+
+var errUserExists = errors.New("User already exists")
+
+// registerUser creates a user with the given id, or the next free one if
+// id is 0, and fails with errUserExists if the id is taken.
+func registerUser(ctx context.Context, db bun.IDB, id int) (*User, error) {
+	user := &User{LegacyID: id}
+	for {
+		res, err := db.NewInsert().
+			Model(user).
+			On("CONFLICT (legacy_id) DO NOTHING").
+			Returning("*").
+			Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n > 0 {
+			return user, err
+		}
+		if id != 0 {
+			return nil, errUserExists
+		}
+		// The sequence handed out an id someone registered explicitly;
+		// the next try gets a later one.
+	}
+}
+
+// ensureUser registers the user with the given id if there isn't one.
+func ensureUser(ctx context.Context, db bun.IDB, id int) error {
+	_, err := registerUser(ctx, db, id)
+	if errors.Is(err, errUserExists) {
+		return nil
+	}
+	return err
+}
+
+// addUser serves POST /users, which registers a user. Nothing can be saved
+// under a user_id until it is registered.
+func (trackerDb *trackerDb) addUser(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(RegisterUserRequest)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if req.UserID < 0 {
+		return respondError(c, http.StatusBadRequest, "user_id must be positive")
+	}
+
+	user, err := registerUser(ctx, trackerDb.db, req.UserID)
+	if errors.Is(err, errUserExists) {
+		return respondError(c, http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error while registering user: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondCreated(c, apiPath(c, fmt.Sprintf("/me?user_id=%d", user.LegacyID)), user)
+}
+
+// registeredUser refuses changes for a user_id that was never registered
+// with a 404, rather than letting the foreign keys fail them with a 500.
+// Reads of an unknown user just find nothing, and admin routes, which
+// name users of their own, and POST /users itself are left alone, as are
+// uploads, whose multipart forms requestUserID doesn't parse.
+func (trackerDb *trackerDb) registeredUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		method := c.Request().Method
+		resource := strings.TrimPrefix(c.Path(), apiPath(c, ""))
+		if method == http.MethodGet || method == http.MethodHead || resource == "/users" || strings.HasPrefix(resource, "/admin/") {
+			return next(c)
+		}
+		userID, err := strconv.Atoi(requestUserID(c))
+		if err != nil {
+			return next(c)
+		}
+
+		exists, err := trackerDb.db.NewSelect().
+			Model((*User)(nil)).
+			Where("legacy_id = ?", userID).
+			Exists(context.Background())
+		if err != nil {
+			log.Printf("Error while getting user: %+v", err)
+			return respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		if !exists {
+			return respondError(c, http.StatusNotFound, "User not found; register it with POST /users first")
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build integration
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRegisterUser(t *testing.T) {
+	id := int(atomic.AddInt64(&lastUserID, 1))
+
+	rec := request(t, http.MethodPost, "/api/v2/users", map[string]interface{}{"user_id": id})
+	expectStatus(t, rec, http.StatusCreated)
+	var user User
+	decodeData(t, rec, &user)
+	if user.LegacyID != id {
+		t.Errorf("registered %+v, want legacy id %d", user, id)
+	}
+	if loc := rec.Header().Get("Location"); loc != fmt.Sprintf("/api/v2/me?user_id=%d", id) {
+		t.Errorf("Location is %q", loc)
+	}
+
+	rec = request(t, http.MethodPost, "/api/v2/users", map[string]interface{}{"user_id": id})
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/me?user_id=%d", id), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var me User
+	decodeData(t, rec, &me)
+	if me.ID != user.ID {
+		t.Errorf("/me is %+v, want %+v", me, user)
+	}
+
+	rec = request(t, http.MethodPost, "/api/v2/users", map[string]interface{}{"user_id": -1})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestRegisterUserAssignsID(t *testing.T) {
+	var first, second User
+	rec := request(t, http.MethodPost, "/api/v2/users", map[string]interface{}{})
+	expectStatus(t, rec, http.StatusCreated)
+	decodeData(t, rec, &first)
+	rec = request(t, http.MethodPost, "/api/v2/users", map[string]interface{}{})
+	expectStatus(t, rec, http.StatusCreated)
+	decodeData(t, rec, &second)
+
+	if first.LegacyID == 0 || second.LegacyID == 0 || first.LegacyID == second.LegacyID {
+		t.Errorf("assigned ids %d and %d", first.LegacyID, second.LegacyID)
+	}
+}
+
+func TestUnregisteredUserCantSave(t *testing.T) {
+	id := int(atomic.AddInt64(&lastUserID, 1))
+
+	rec := request(t, http.MethodPost, "/api/v2/items", map[string]interface{}{
+		"name": "Coffee", "cost": 120, "type": "debit", "user_id": id,
+	})
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = request(t, http.MethodPost, "/api/v1/item", map[string]interface{}{
+		"name": "Coffee", "cost": 120, "type": "debit", "user_id": id,
+	})
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/me?user_id=%d", id), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestSeedRegistersUser(t *testing.T) {
+	id := int(atomic.AddInt64(&lastUserID, 1))
+
+	rec := request(t, http.MethodPost, "/api/v2/admin/seed-demo", map[string]interface{}{"user_id": id},
+		"X-Admin-Token", testTracker.env.AdminToken)
+	expectStatus(t, rec, http.StatusCreated)
+
+	rec = request(t, http.MethodGet, fmt.Sprintf("/api/v2/me?user_id=%d", id), nil)
+	expectStatus(t, rec, http.StatusOK)
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+)
+
+// ItemV2 is how /api/v2 shows an item. Unlike v1 it uses snake_case
+// created_at and null for missing references instead of the zero UUID.
+type ItemV2 struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	DisplayName   string     `json:"display_name"`
+	Cost          float64    `json:"cost"`
+	Type          string     `json:"type"`
+	CategoryID    *uuid.UUID `json:"category_id"`
+	UserID        int        `json:"user_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Status        string     `json:"status"`
+	Adjustment    bool       `json:"adjustment"`
+	Reimbursable  bool       `json:"reimbursable"`
+	ClaimID       *uuid.UUID `json:"claim_id"`
+	Reimbursed    bool       `json:"reimbursed"`
+	TaxRate       float64    `json:"tax_rate"`
+	TaxAmount     float64    `json:"tax_amount"`
+	VendorTaxID   string     `json:"vendor_tax_id"`
+	InvoiceNumber string     `json:"invoice_number"`
+	LoanID        *uuid.UUID `json:"loan_id"`
+	ProfileID     *uuid.UUID `json:"profile_id"`
+	Pinned        bool       `json:"pinned"`
+	Location      *Location  `json:"location"`
+	Original      *Original  `json:"original"`
+	Scheduled     bool       `json:"scheduled"`
+	Excluded      bool       `json:"excluded"`
+	ImportBatchID *uuid.UUID `json:"import_batch_id"`
+	CardID        *uuid.UUID `json:"card_id"`
+	// CategoryName and RunningBalance are only filled in on lists.
+	CategoryName   string   `json:"category_name,omitempty"`
+	RunningBalance *float64 `json:"running_balance,omitempty"`
+}
+
+// CreateItemV2Request is the body of POST /api/v2/items.
+type CreateItemV2Request struct {
+	Name          string    `json:"name"`
+	Cost          float64   `json:"cost"`
+	Type          string    `json:"type"`
+	CategoryID    uuid.UUID `json:"category_id"`
+	UserID        int       `json:"user_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Status        string    `json:"status"`
+	Reimbursable  bool      `json:"reimbursable"`
+	Pinned        bool      `json:"pinned"`
+	Excluded      bool      `json:"excluded"`
+	Location      *Location `json:"location"`
+	Original      *Original `json:"original"`
+	TaxRate       float64   `json:"tax_rate"`
+	TaxAmount     float64   `json:"tax_amount"`
+	VendorTaxID   string    `json:"vendor_tax_id"`
+	InvoiceNumber string    `json:"invoice_number"`
+	LoanID        uuid.UUID `json:"loan_id"`
+	CardID        uuid.UUID `json:"card_id"`
+}
+
+// itemV2Columns maps the fields PATCH /api/v2/items/:id may change to their
+// columns.
+var itemV2Columns = map[string]string{
+	"name":           "name",
+	"display_name":   "display_name",
+	"cost":           "cost",
+	"type":           "type",
+	"category_id":    "category_id",
+	"created_at":     "created_at",
+	"status":         "status",
+	"reimbursable":   "reimbursable",
+	"tax_rate":       "tax_rate",
+	"tax_amount":     "tax_amount",
+	"vendor_tax_id":  "vendor_tax_id",
+	"invoice_number": "invoice_number",
+	"loan_id":        "loan_id",
+	"card_id":        "card_id",
+	"profile_id":     "profile_id",
+	"pinned":         "pinned",
+	"excluded":       "excluded",
+}
+
+// Location is where an item was entered. v2 nests it and leaves it null
+// when the client sent none.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Place     string  `json:"place,omitempty"`
+}
+
+func newLocation(lat, lng float64, place string) *Location {
+	if lat == 0 && lng == 0 && place == "" {
+		return nil
+	}
+	return &Location{Latitude: lat, Longitude: lng, Place: place}
+}
+
+// Original is what a foreign-currency item actually cost and the rate used
+// to convert it. v2 nests it and leaves it null for items in the home
+// currency.
+type Original struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+	RateDate Date    `json:"rate_date"`
+}
+
+func newOriginal(amount float64, currency string, rate float64, rateDate Date) *Original {
+	if currency == "" {
+		return nil
+	}
+	return &Original{Amount: amount, Currency: currency, Rate: rate, RateDate: rateDate}
+}
+
+func uuidPtr(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func itemV2FromItem(i GetItem) ItemV2 {
+	return ItemV2{
+		ID:            i.ID,
+		Name:          i.Name,
+		DisplayName:   i.DisplayName,
+		Cost:          i.Cost,
+		Type:          i.Type,
+		CategoryID:    uuidPtr(i.CategoryID),
+		UserID:        i.UserID,
+		CreatedAt:     i.CreatedAt.Time,
+		Status:        i.Status,
+		Adjustment:    i.Adjustment,
+		Reimbursable:  i.Reimbursable,
+		ClaimID:       nullUUIDPtr(i.ClaimID),
+		Reimbursed:    i.Reimbursed,
+		TaxRate:       i.TaxRate,
+		TaxAmount:     i.TaxAmount,
+		VendorTaxID:   i.VendorTaxID,
+		InvoiceNumber: i.InvoiceNumber,
+		LoanID:        nullUUIDPtr(i.LoanID),
+		ProfileID:     nullUUIDPtr(i.ProfileID),
+		Pinned:        i.Pinned,
+		Location:      newLocation(i.Latitude, i.Longitude, i.Place),
+		Original:      newOriginal(i.OriginalAmount, i.OriginalCurrency, i.ExchangeRate, i.RateDate),
+		Scheduled:     i.Scheduled,
+		Excluded:      i.Excluded,
+		ImportBatchID: nullUUIDPtr(i.ImportBatchID),
+		CardID:        nullUUIDPtr(i.CardID),
+	}
+}
+
+func itemV2FromRow(r GetAllItemsRow) ItemV2 {
+	item := itemV2FromItem(GetItem{
+		ID:               r.ID,
+		Name:             r.Name,
+		DisplayName:      r.DisplayName,
+		Cost:             r.Cost,
+		Type:             r.Type,
+		CategoryID:       r.CategoryID,
+		CreatedAt:        r.CreatedAt,
+		UserID:           r.UserID,
+		Status:           r.Status,
+		Adjustment:       r.Adjustment,
+		Reimbursable:     r.Reimbursable,
+		ClaimID:          r.ClaimID,
+		Reimbursed:       r.Reimbursed,
+		TaxRate:          r.TaxRate,
+		TaxAmount:        r.TaxAmount,
+		VendorTaxID:      r.VendorTaxID,
+		InvoiceNumber:    r.InvoiceNumber,
+		LoanID:           r.LoanID,
+		ProfileID:        r.ProfileID,
+		Pinned:           r.Pinned,
+		Latitude:         r.Latitude,
+		Longitude:        r.Longitude,
+		Place:            r.Place,
+		OriginalAmount:   r.OriginalAmount,
+		OriginalCurrency: r.OriginalCurrency,
+		ExchangeRate:     r.ExchangeRate,
+		RateDate:         r.RateDate,
+		Scheduled:        r.Scheduled,
+		Excluded:         r.Excluded,
+		ImportBatchID:    r.ImportBatchID,
+		CardID:           r.CardID,
+	})
+	item.CategoryName = r.CategoryName
+	item.RunningBalance = &r.RunningBalance
+	return item
+}
+
+func itemV2FromModel(i *Item) ItemV2 {
+	return ItemV2{
+		ID:            i.ID,
+		Name:          i.Name,
+		DisplayName:   i.DisplayName,
+		Cost:          i.Cost,
+		Type:          i.Type,
+		CategoryID:    uuidPtr(i.CategoryID),
+		UserID:        i.UserID,
+		CreatedAt:     i.CreatedAt,
+		Status:        i.Status,
+		Adjustment:    i.Adjustment,
+		Reimbursable:  i.Reimbursable,
+		ClaimID:       uuidPtr(i.ClaimID),
+		Reimbursed:    i.Reimbursed,
+		TaxRate:       i.TaxRate,
+		TaxAmount:     i.TaxAmount,
+		VendorTaxID:   i.VendorTaxID,
+		InvoiceNumber: i.InvoiceNumber,
+		LoanID:        uuidPtr(i.LoanID),
+		ProfileID:     uuidPtr(i.ProfileID),
+		Pinned:        i.Pinned,
+		Location:      newLocation(i.Latitude, i.Longitude, i.Place),
+		Original:      newOriginal(i.OriginalAmount, i.OriginalCurrency, i.ExchangeRate, i.RateDate),
+		Scheduled:     i.Scheduled,
+		Excluded:      i.Excluded,
+		ImportBatchID: uuidPtr(i.ImportBatchID),
+		CardID:        uuidPtr(i.CardID),
+	}
+}
+
+func (trackerDb *trackerDb) getItemsV2(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "limit must be between 1 and 1000 and offset not negative")
+	}
+	p, err := parsePeriod(c.QueryParam("period"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+
+	excluded, ok := boolParam(c, "excluded")
+	if !ok {
+		return respondError(c, http.StatusBadRequest, "excluded must be true or false")
+	}
+
+	rows, summary, err := trackerDb.listItems(ctx, itemFilter{UserID: userID, Profile: currentProfile(c), Period: p, Excluded: excluded}, limit, offset)
+	if err != nil {
+		log.Printf("Error while getting items: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	setSummaryHeaders(c, summary)
+
+	items := make([]ItemV2, len(rows))
+	for i, r := range rows {
+		items[i] = itemV2FromRow(r)
+	}
+	if limit == 0 {
+		return respondOK(c, items)
+	}
+
+	return respondPage(c, items, PageMeta{Total: summary.Count, Limit: limit, Offset: offset, Summary: &summary})
+}
+
+func (trackerDb *trackerDb) getPinnedItemsV2(c echo.Context) error {
+	ctx := context.Background()
+	userID := c.QueryParam("user_id")
+
+	rows, _, err := trackerDb.listItems(ctx, itemFilter{UserID: userID, Profile: currentProfile(c), Pinned: true}, 0, 0)
+	if err != nil {
+		log.Printf("Error while getting pinned items: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	items := make([]ItemV2, len(rows))
+	for i, r := range rows {
+		items[i] = itemV2FromRow(r)
+	}
+	return respondOK(c, items)
+}
+
+func (trackerDb *trackerDb) getItemV2(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	item, err := trackerDb.findItem(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Item not found")
+	}
+	if err != nil {
+		log.Printf("Could not fetch item: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, itemV2FromItem(item))
+}
+
+// createItemV2 validates what v1 accepted blindly; see Item.validate.
+func (trackerDb *trackerDb) createItemV2(c echo.Context) error {
+	ctx := context.Background()
+
+	req := new(CreateItemV2Request)
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if req.Cost < 0 {
+		return respondError(c, http.StatusBadRequest, "cost must be positive")
+	}
+
+	item := &Item{
+		Name:          req.Name,
+		Cost:          req.Cost,
+		Type:          req.Type,
+		CategoryID:    req.CategoryID,
+		UserID:        req.UserID,
+		CreatedAt:     req.CreatedAt,
+		Status:        req.Status,
+		Reimbursable:  req.Reimbursable,
+		Pinned:        req.Pinned,
+		Excluded:      req.Excluded,
+		TaxRate:       req.TaxRate,
+		TaxAmount:     req.TaxAmount,
+		VendorTaxID:   req.VendorTaxID,
+		InvoiceNumber: req.InvoiceNumber,
+		LoanID:        req.LoanID,
+		CardID:        req.CardID,
+	}
+	if req.Original != nil {
+		item.OriginalAmount = req.Original.Amount
+		item.OriginalCurrency = req.Original.Currency
+		item.ExchangeRate = req.Original.Rate
+		item.RateDate = req.Original.RateDate
+	}
+	if msg := item.applyExchangeRate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	if req.Location != nil {
+		item.Latitude = req.Location.Latitude
+		item.Longitude = req.Location.Longitude
+		item.Place = req.Location.Place
+	}
+	if msg := item.validate(); msg != "" {
+		return respondError(c, http.StatusBadRequest, msg)
+	}
+	if profile := currentProfile(c); profile != uuid.Nil {
+		item.ProfileID = profile
+	}
+	err = trackerDb.createItem(ctx, item, c.QueryParam("override_cap") == "true")
+	if err != nil {
+		return respondItemError(c, err, "creating item")
+	}
+
+	return respondCreated(c, apiPath(c, "/items/"+item.ID.String()), itemV2FromModel(item))
+}
+
+// NewItemFromV2Request optionally changes the date and cost of an item
+// created from another item or a template.
+type NewItemFromV2Request struct {
+	CreatedAt time.Time `json:"created_at"`
+	Cost      float64   `json:"cost"`
+}
+
+func (trackerDb *trackerDb) duplicateItemV2(c echo.Context) error {
+	return trackerDb.addItemFromV2(c, trackerDb.copyItem, "Item not found")
+}
+
+func (trackerDb *trackerDb) addItemFromTemplateV2(c echo.Context) error {
+	return trackerDb.addItemFromV2(c, trackerDb.itemFromTemplate, "Item template not found")
+}
+
+// addItemFromV2 creates an item from the source with the id in the path.
+func (trackerDb *trackerDb) addItemFromV2(c echo.Context, source itemSource, notFound string) error {
+	ctx := context.Background()
+
+	req := new(NewItemFromV2Request)
+	if c.Request().ContentLength != 0 {
+		err := c.Bind(req)
+		if err != nil {
+			log.Printf("Error while binding: %+v", err)
+			return respondError(c, http.StatusBadRequest, err.Error())
+		}
+	}
+	if req.Cost < 0 {
+		return respondError(c, http.StatusBadRequest, "cost must be positive")
+	}
+
+	item, err := source(ctx, c.Param("id"), req.CreatedAt, req.Cost, c.QueryParam("override_cap") == "true")
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, notFound)
+	}
+	if err != nil {
+		return respondItemError(c, err, "creating item")
+	}
+
+	return respondCreated(c, apiPath(c, "/items/"+item.ID.String()), itemV2FromModel(item))
+}
+
+// updateItemV2 changes only the fields present in the body. Unknown or
+// read-only fields are rejected rather than written through, and the
+// changed item must pass the same checks as a new one.
+func (trackerDb *trackerDb) updateItemV2(c echo.Context) error {
+	ctx := context.Background()
+	id := c.Param("id")
+
+	body := make(map[string]interface{})
+	err := c.Bind(&body)
+	if err != nil {
+		log.Printf("Error while binding: %+v", err)
+		return respondError(c, http.StatusBadRequest, err.Error())
+	}
+	if len(body) == 0 {
+		return respondError(c, http.StatusBadRequest, "nothing to update")
+	}
+
+	fields := make(map[string]interface{}, len(body))
+	if loc, ok := body["location"]; ok {
+		delete(body, "location")
+		l, ok := loc.(map[string]interface{})
+		if loc != nil && !ok {
+			return respondError(c, http.StatusBadRequest, "location must be an object or null")
+		}
+		if (l["latitude"] == nil) != (l["longitude"] == nil) {
+			return respondError(c, http.StatusBadRequest, "location needs both latitude and longitude")
+		}
+		fields["latitude"], fields["longitude"], fields["place"] = l["latitude"], l["longitude"], l["place"]
+	}
+	for k, v := range body {
+		col, ok := itemV2Columns[k]
+		if !ok {
+			return respondError(c, http.StatusBadRequest, "field "+k+" cannot be updated")
+		}
+		fields[col] = v
+	}
+
+	item, err := trackerDb.editItem(ctx, id, fields, c.QueryParam("override_cap") == "true")
+	if errors.Is(err, sql.ErrNoRows) {
+		return respondError(c, http.StatusNotFound, "Item not found")
+	}
+	if err != nil {
+		return respondItemError(c, err, "updating item")
+	}
+
+	return respondOK(c, itemV2FromModel(item))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// commit and buildTime identify the build. Release builds set them with
+//
+//	go build -ldflags "-X main.commit=$(git rev-parse HEAD) \
+//		-X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them, the VCS details go build records are used, when there are
+// any.
+var (
+	commit    string
+	buildTime string
+)
+
+// VersionInfo is what GET /version reports: enough to tell which build,
+// schema and features a bug report came from, and nothing secret.
+type VersionInfo struct {
+	Commit    string            `json:"commit"`
+	Modified  bool              `json:"modified"`
+	BuildTime string            `json:"build_time"`
+	GoVersion string            `json:"go_version"`
+	Migration MigrationVersion  `json:"migration"`
+	Features  map[string]bool   `json:"features"`
+	Settings  map[string]string `json:"settings"`
+}
+
+// MigrationVersion is the newest migration applied to the database and the
+// newest this build has. They differ while another replica is migrating,
+// or when the database is ahead of an older build.
+type MigrationVersion struct {
+	Applied string `json:"applied"`
+	Latest  string `json:"latest"`
+}
+
+func buildInfo() (rev, at string, modified bool) {
+	rev, at = commit, buildTime
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return rev, at, false
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if rev == "" {
+				rev = s.Value
+			}
+		case "vcs.time":
+			if at == "" {
+				at = s.Value
+			}
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	return rev, at, modified
+}
+
+// latestMigration is the name of the newest embedded migration.
+func latestMigration() string {
+	latest := ""
+	entries, _ := fs.ReadDir(sqlMigrations, "migrations")
+	for _, e := range entries {
+		name, _, _ := strings.Cut(e.Name(), "_")
+		latest = max(latest, name)
+	}
+	return latest
+}
+
+// getVersion serves GET /version. It is public so self-hosters can paste
+// it into bug reports; features say what is switched on, not how.
+func (trackerDb *trackerDb) getVersion(c echo.Context) error {
+	ctx := context.Background()
+	env := trackerDb.env
+
+	info := VersionInfo{
+		GoVersion: runtime.Version(),
+		Migration: MigrationVersion{Latest: latestMigration()},
+		Features: map[string]bool{
+			"maintenance":      trackerDb.maintenance.status().Enabled,
+			"email_ingest":     env.InboundEmailToken != "",
+			"enrichment":       env.EnrichmentURL != "",
+			"sheets_sync":      env.GoogleCredentialsFile != "",
+			"calendar_feed":    env.CalendarSecret != "",
+			"apple_wallet":     env.PassCertFile != "" && env.PublicURL != "",
+			"google_wallet":    env.GoogleWalletIssuerID != "" && env.GoogleCredentialsFile != "",
+			"virus_scan":       env.ClamdAddress != "",
+			"rate_limit":       env.RateLimit > 0,
+			"item_quota":       env.ItemQuota > 0,
+			"custom_policy":    env.PolicyFile != "",
+			"auditor_role":     env.AuditorToken != "",
+			"request_body_log": env.LogBodies,
+		},
+		Settings: map[string]string{
+			"app_env":       env.AppEnv,
+			"currency":      env.Currency,
+			"rounding_mode": env.RoundingMode,
+			"ocr_backend":   env.OcrBackend,
+		},
+	}
+	info.Commit, info.BuildTime, info.Modified = buildInfo()
+
+	var applied []string
+	err := trackerDb.db.NewSelect().
+		Column("name").
+		TableExpr("bun_migrations").
+		OrderExpr("name DESC").
+		Limit(1).
+		Scan(ctx, &applied)
+	if err != nil {
+		log.Printf("Error while getting the migration version: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	if len(applied) > 0 {
+		info.Migration.Applied = applied[0]
+	}
+
+	return respondOK(c, info)
+}
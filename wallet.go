@@ -0,0 +1,820 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// WalletPass is a user's budget pass, shared by Apple and Google Wallet.
+// It shows the default ledger. Budget and Spent are what the pass showed
+// when it was last updated.
+type WalletPass struct {
+	bun.BaseModel `bun:"table:wallet_pass,alias:wp"`
+
+	UserID    int       `bun:"user_id,pk" json:"user_id"`
+	Serial    uuid.UUID `bun:",nullzero,default:gen_random_uuid()" json:"serial"`
+	AuthToken string    `json:"-"`
+	Budget    float64   `json:"budget"`
+	Spent     float64   `json:"spent"`
+	Google    bool      `json:"google"`
+	UpdatedAt time.Time `bun:",nullzero,default:now()" json:"updated_at"`
+}
+
+// WalletPassDevice is an Apple device that asked to be pushed updates to a
+// pass.
+type WalletPassDevice struct {
+	bun.BaseModel `bun:"table:wallet_pass_device,alias:wpd"`
+
+	DeviceID  string    `bun:",pk" json:"device_id"`
+	Serial    uuid.UUID `bun:",pk,type:uuid" json:"serial"`
+	PushToken string    `json:"push_token"`
+}
+
+// BudgetStatus is the month's spending in the categories a user has capped,
+// against the sum of those caps.
+type BudgetStatus struct {
+	Month     time.Time `json:"month"`
+	Budget    float64   `json:"budget"`
+	Spent     float64   `json:"spent"`
+	Remaining float64   `json:"remaining"`
+}
+
+// budgetStatus totals the user's category caps and what they have spent
+// this month in the capped categories of one ledger, counting items the
+// way caps do. Both are in the base currency; caps in other currencies are
+// converted at their rates.
+func (trackerDb *trackerDb) budgetStatus(ctx context.Context, userID int, profile uuid.UUID, now time.Time) (BudgetStatus, error) {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	spending := trackerDb.db.NewSelect().
+		Column("category_id").
+		ColumnExpr("SUM(cost) AS spent").
+		TableExpr("item").
+		Where("user_id = ?", userID).
+		Apply(inProfile(profile)).
+		Where("type = 'debit'").
+		Where("NOT reimbursed").
+		Where("NOT adjustment").
+		Where("NOT excluded").
+		Where("created_at >= ?", month).
+		Where("created_at < ?", month.AddDate(0, 1, 0)).
+		Group("category_id")
+
+	status := BudgetStatus{Month: month}
+	err := trackerDb.db.NewSelect().
+		ColumnExpr("COALESCE(SUM(cc.amount * COALESCE(cc.exchange_rate, 1)), 0) AS budget").
+		ColumnExpr("COALESCE(SUM(s.spent), 0) AS spent").
+		TableExpr("category_cap AS cc").
+		Join("LEFT JOIN (?) AS s ON s.category_id = cc.category_id", spending).
+		Where("cc.user_id = ?", userID).
+		Scan(ctx, &status.Budget, &status.Spent)
+	status.Remaining = roundMoney(status.Budget - status.Spent)
+	return status, err
+}
+
+// walletPass returns the user's pass, creating it the first time.
+func (trackerDb *trackerDb) walletPass(ctx context.Context, userID int) (*WalletPass, error) {
+	token := make([]byte, 24)
+	_, err := rand.Read(token)
+	if err != nil {
+		return nil, err
+	}
+
+	pass := &WalletPass{UserID: userID, AuthToken: hex.EncodeToString(token)}
+	_, err = trackerDb.db.NewInsert().Model(pass).On("CONFLICT (user_id) DO NOTHING").Returning("NULL").Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = trackerDb.db.NewSelect().Model(pass).WherePK().Scan(ctx)
+	return pass, err
+}
+
+// recordWalletPass saves the numbers the pass now shows.
+func (trackerDb *trackerDb) recordWalletPass(ctx context.Context, pass *WalletPass, status BudgetStatus) error {
+	pass.Budget = status.Budget
+	pass.Spent = status.Spent
+	pass.UpdatedAt = time.Now().UTC()
+	_, err := trackerDb.db.NewUpdate().
+		Model(pass).
+		Column("budget", "spent", "google", "updated_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+var errApplePassDisabled = errors.New("apple wallet passes are not configured")
+
+// Apple Wallet
+
+// passSigner is the Pass Type ID certificate and key, and the WWDR
+// certificate that chains it to Apple.
+type passSigner struct {
+	cert *x509.Certificate
+	wwdr *x509.Certificate
+	key  *rsa.PrivateKey
+	tls  tls.Certificate
+}
+
+func (trackerDb *trackerDb) passSigner() (*passSigner, error) {
+	env := trackerDb.env
+	if env.PassCertFile == "" || env.PublicURL == "" {
+		return nil, errApplePassDisabled
+	}
+	pair, err := tls.LoadX509KeyPair(env.PassCertFile, env.PassKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("pass signing key is not RSA")
+	}
+
+	b, err := os.ReadFile(env.PassWWDRFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("WWDR certificate is not PEM")
+	}
+	wwdr, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &passSigner{cert: cert, wwdr: wwdr, key: key, tls: pair}, nil
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+)
+
+type pkcs7Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	SignedAttributes          asn1.RawValue
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	Signature                 []byte
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+	Certificates     asn1.RawValue
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// sign makes the detached PKCS #7 signature of data that Wallet checks a
+// pass's manifest.json against.
+func (s *passSigner) sign(data []byte, at time.Time) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	attrs := [][]interface{}{
+		{oidContentType, oidData},
+		{oidSigningTime, at.UTC()},
+		{oidMessageDigest, digest[:]},
+	}
+	encodings := [][]byte{}
+	for _, a := range attrs {
+		value, err := asn1.Marshal(a[1])
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(pkcs7Attribute{
+			Type:  a[0].(asn1.ObjectIdentifier),
+			Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, attr)
+	}
+	slices.SortFunc(encodings, bytes.Compare)
+	encoded := bytes.Join(encodings, nil)
+
+	// The signature covers the attributes encoded as a SET, though they
+	// are sent tagged [0].
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: encoded})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(signed)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	sd := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		Certificates: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true,
+			Bytes: append(append([]byte{}, s.cert.Raw...), s.wwdr.Raw...),
+		},
+		SignerInfos: []pkcs7SignerInfo{{
+			Version:               1,
+			IssuerAndSerialNumber: pkcs7IssuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.cert.RawIssuer}, Serial: s.cert.SerialNumber},
+			DigestAlgorithm:       sha256Algorithm,
+			SignedAttributes:      asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encoded},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm: oidRSA, Parameters: asn1.NullRawValue,
+			},
+			Signature: sig,
+		}},
+	}
+	sd.ContentInfo.ContentType = oidData
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+}
+
+// passColor is the pass background, also used for its icon.
+var passColor = color.RGBA{0x1f, 0x6f, 0x5c, 0xff}
+
+// passIcon draws the square icon Wallet shows in notifications.
+func passIcon(size int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{passColor}, image.Point{}, draw.Src)
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.Bytes()
+}
+
+var passIcons = map[string][]byte{
+	"icon.png":    passIcon(29),
+	"icon@2x.png": passIcon(58),
+	"icon@3x.png": passIcon(87),
+}
+
+type passField struct {
+	Key           string `json:"key"`
+	Label         string `json:"label"`
+	Value         any    `json:"value"`
+	CurrencyCode  string `json:"currencyCode,omitempty"`
+	ChangeMessage string `json:"changeMessage,omitempty"`
+}
+
+// passJSON is the pass.json of a generic pass showing status.
+func (trackerDb *trackerDb) passJSON(pass *WalletPass, status BudgetStatus) ([]byte, error) {
+	env := trackerDb.env
+	money := func(key, label string, amount float64, change string) passField {
+		return passField{Key: key, Label: label, Value: amount, CurrencyCode: env.Currency, ChangeMessage: change}
+	}
+	return json.Marshal(map[string]any{
+		"formatVersion":       1,
+		"passTypeIdentifier":  env.PassTypeID,
+		"teamIdentifier":      env.PassTeamID,
+		"serialNumber":        pass.Serial.String(),
+		"organizationName":    "Finance Tracker",
+		"description":         "Budget left this month",
+		"webServiceURL":       strings.TrimSuffix(env.PublicURL, "/") + "/wallet",
+		"authenticationToken": pass.AuthToken,
+		"backgroundColor":     fmt.Sprintf("rgb(%d, %d, %d)", passColor.R, passColor.G, passColor.B),
+		"foregroundColor":     "rgb(255, 255, 255)",
+		"labelColor":          "rgb(210, 235, 225)",
+		"generic": map[string][]passField{
+			"primaryFields": {money("remaining", "LEFT THIS MONTH", status.Remaining, "Budget left: %@")},
+			"secondaryFields": {
+				money("spent", "SPENT", status.Spent, ""),
+				money("budget", "BUDGET", status.Budget, ""),
+			},
+			"auxiliaryFields": {{Key: "month", Label: "MONTH", Value: status.Month.Format("January 2006")}},
+		},
+	})
+}
+
+// pkpass builds and signs the pass bundle: pass.json, the icons, a
+// manifest of their SHA-1 hashes and the manifest's signature.
+func (trackerDb *trackerDb) pkpass(signer *passSigner, pass *WalletPass, status BudgetStatus) ([]byte, error) {
+	passJSON, err := trackerDb.passJSON(pass, status)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{"pass.json": passJSON}
+	for name, b := range passIcons {
+		files[name] = b
+	}
+
+	manifest := map[string]string{}
+	for name, b := range files {
+		sum := sha1.Sum(b)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+	files["manifest.json"], err = json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	files["signature"], err = signer.sign(files["manifest.json"], time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for name, content := range files {
+		w, err := z.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = z.Close()
+	return b.Bytes(), err
+}
+
+// getApplePass downloads the user's budget pass to add to Apple Wallet.
+func (trackerDb *trackerDb) getApplePass(c echo.Context) error {
+	ctx := context.Background()
+
+	userID, err := strconv.Atoi(c.QueryParam("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+	signer, err := trackerDb.passSigner()
+	if errors.Is(err, errApplePassDisabled) {
+		return respondError(c, http.StatusServiceUnavailable, "Apple Wallet passes are not configured")
+	}
+	if err != nil {
+		log.Printf("Error while loading the pass certificate: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	pass, err := trackerDb.walletPass(ctx, userID)
+	if err != nil {
+		log.Printf("Error while getting wallet pass: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	return trackerDb.sendPkpass(c, signer, pass)
+}
+
+// sendPkpass answers with the pass as it stands now, and records that.
+func (trackerDb *trackerDb) sendPkpass(c echo.Context, signer *passSigner, pass *WalletPass) error {
+	ctx := context.Background()
+
+	status, err := trackerDb.budgetStatus(ctx, pass.UserID, uuid.Nil, time.Now().UTC())
+	if err == nil {
+		err = trackerDb.recordWalletPass(ctx, pass, status)
+	}
+	if err != nil {
+		log.Printf("Error while getting budget status: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	b, err := trackerDb.pkpass(signer, pass, status)
+	if err != nil {
+		log.Printf("Error while building pass: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	c.Response().Header().Set(echo.HeaderLastModified, pass.UpdatedAt.Format(http.TimeFormat))
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="budget.pkpass"`)
+	return c.Blob(http.StatusOK, "application/vnd.apple.pkpass", b)
+}
+
+// walletRoutes mounts the web service Apple Wallet calls, at the
+// webServiceURL in pass.json, to register devices for push updates and
+// fetch updated passes. Its paths and responses are fixed by Apple; calls
+// about a pass authenticate with the pass's token rather than the API's.
+func (trackerDb *trackerDb) walletRoutes(e *echo.Echo) {
+	g := e.Group("/wallet/v1")
+	g.POST("/devices/:device/registrations/:type/:serial", trackerDb.registerPassDevice, trackerDb.passAuth)
+	g.DELETE("/devices/:device/registrations/:type/:serial", trackerDb.unregisterPassDevice, trackerDb.passAuth)
+	g.GET("/devices/:device/registrations/:type", trackerDb.getUpdatedPasses)
+	g.GET("/passes/:type/:serial", trackerDb.getUpdatedPass, trackerDb.passAuth)
+	g.POST("/log", logPassErrors)
+}
+
+// passAuth checks the "Authorization: ApplePass <token>" header against
+// the pass in the path, and stores the pass as "pass" for the handler.
+func (trackerDb *trackerDb) passAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := context.Background()
+
+		serial, err := uuid.Parse(c.Param("serial"))
+		if err != nil || c.Param("type") != trackerDb.env.PassTypeID {
+			return c.NoContent(http.StatusNotFound)
+		}
+		token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "ApplePass ")
+		if !ok {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+
+		pass := new(WalletPass)
+		err = trackerDb.db.NewSelect().Model(pass).Where("serial = ?", serial).Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		if err != nil {
+			log.Printf("Error while getting wallet pass: %+v", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		if !hasPassToken(token, pass.AuthToken) {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+
+		c.Set("pass", pass)
+		return next(c)
+	}
+}
+
+func hasPassToken(got, want string) bool {
+	return len(got) == len(want) && sha256.Sum256([]byte(got)) == sha256.Sum256([]byte(want))
+}
+
+func (trackerDb *trackerDb) registerPassDevice(c echo.Context) error {
+	ctx := context.Background()
+	pass := c.Get("pass").(*WalletPass)
+
+	var body struct {
+		PushToken string `json:"pushToken"`
+	}
+	err := c.Bind(&body)
+	if err != nil || body.PushToken == "" {
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	device := &WalletPassDevice{DeviceID: c.Param("device"), Serial: pass.Serial, PushToken: body.PushToken}
+	registered, err := trackerDb.db.NewSelect().Model(device).WherePK().Exists(ctx)
+	if err == nil {
+		_, err = trackerDb.db.NewInsert().
+			Model(device).
+			On("CONFLICT (device_id, serial) DO UPDATE").
+			Set("push_token = EXCLUDED.push_token").
+			Exec(ctx)
+	}
+	if err != nil {
+		log.Printf("Error while registering pass device: %+v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	if registered {
+		return c.NoContent(http.StatusOK)
+	}
+	return c.NoContent(http.StatusCreated)
+}
+
+func (trackerDb *trackerDb) unregisterPassDevice(c echo.Context) error {
+	ctx := context.Background()
+	pass := c.Get("pass").(*WalletPass)
+
+	_, err := trackerDb.db.NewDelete().
+		Model((*WalletPassDevice)(nil)).
+		Where("device_id = ?", c.Param("device")).
+		Where("serial = ?", pass.Serial).
+		Exec(ctx)
+	if err != nil {
+		log.Printf("Error while unregistering pass device: %+v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// getUpdatedPasses lists the serials of the device's passes updated since
+// passesUpdatedSince, the lastUpdated of its previous call, as a Unix time.
+func (trackerDb *trackerDb) getUpdatedPasses(c echo.Context) error {
+	ctx := context.Background()
+
+	if c.Param("type") != trackerDb.env.PassTypeID {
+		return c.NoContent(http.StatusNotFound)
+	}
+	passes := []WalletPass{}
+	q := trackerDb.db.NewSelect().
+		Model(&passes).
+		ColumnExpr("wp.serial, wp.updated_at").
+		Join("JOIN wallet_pass_device AS wpd ON wpd.serial = wp.serial").
+		Where("wpd.device_id = ?", c.Param("device"))
+	if since, err := strconv.ParseInt(c.QueryParam("passesUpdatedSince"), 10, 64); err == nil {
+		q = q.Where("wp.updated_at >= ?", time.Unix(since, 0).UTC())
+	}
+	err := q.Scan(ctx)
+	if err != nil {
+		log.Printf("Error while getting updated passes: %+v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	if len(passes) == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	serials := make([]string, len(passes))
+	last := time.Time{}
+	for i, p := range passes {
+		serials[i] = p.Serial.String()
+		if p.UpdatedAt.After(last) {
+			last = p.UpdatedAt
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"serialNumbers": serials,
+		"lastUpdated":   strconv.FormatInt(last.Unix()+1, 10),
+	})
+}
+
+// getUpdatedPass sends the latest version of a pass, or 304 if it hasn't
+// changed since If-Modified-Since.
+func (trackerDb *trackerDb) getUpdatedPass(c echo.Context) error {
+	pass := c.Get("pass").(*WalletPass)
+
+	since, err := http.ParseTime(c.Request().Header.Get(echo.HeaderIfModifiedSince))
+	if err == nil && !pass.UpdatedAt.Truncate(time.Second).After(since) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	signer, err := trackerDb.passSigner()
+	if err != nil {
+		log.Printf("Error while loading the pass certificate: %+v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return trackerDb.sendPkpass(c, signer, pass)
+}
+
+// logPassErrors logs the problems Wallet reports with the web service.
+func logPassErrors(c echo.Context) error {
+	var body struct {
+		Logs []string `json:"logs"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	for _, l := range body.Logs {
+		log.Printf("Apple Wallet: %s", l)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// pushPassUpdate tells the devices holding a pass that it changed, so
+// Wallet fetches it again. Devices whose token APNs no longer accepts are
+// forgotten.
+func (trackerDb *trackerDb) pushPassUpdate(ctx context.Context, client *http.Client, serial uuid.UUID) error {
+	devices := []WalletPassDevice{}
+	err := trackerDb.db.NewSelect().Model(&devices).Where("serial = ?", serial).Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.push.apple.com/3/device/"+url.PathEscape(d.PushToken), strings.NewReader("{}"))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("apns-topic", trackerDb.env.PassTypeID)
+
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		switch res.StatusCode {
+		case http.StatusOK:
+		case http.StatusGone, http.StatusBadRequest:
+			_, err = trackerDb.db.NewDelete().Model(&d).WherePK().Exec(ctx)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("apns: %s", res.Status)
+		}
+	}
+	return nil
+}
+
+// Google Wallet
+
+const googleWalletScope = "https://www.googleapis.com/auth/wallet_object.issuer"
+
+var googleWalletClient = newOutboundClient(30 * time.Second)
+
+// googlePassObject is the Google Wallet generic object showing status.
+func (trackerDb *trackerDb) googlePassObject(pass *WalletPass, status BudgetStatus, money moneyFormat) map[string]any {
+	issuer := trackerDb.env.GoogleWalletIssuerID
+	text := func(s string) map[string]any {
+		return map[string]any{"defaultValue": map[string]string{"language": "en", "value": s}}
+	}
+	return map[string]any{
+		"id":                 issuer + "." + pass.Serial.String(),
+		"classId":            issuer + ".budget",
+		"state":              "ACTIVE",
+		"hexBackgroundColor": fmt.Sprintf("#%02x%02x%02x", passColor.R, passColor.G, passColor.B),
+		"cardTitle":          text("Finance Tracker"),
+		"subheader":          text("Left this month"),
+		"header":             text(money.format(status.Remaining)),
+		"textModulesData": []map[string]string{
+			{"id": "spent", "header": "Spent", "body": money.format(status.Spent)},
+			{"id": "budget", "header": "Budget", "body": money.format(status.Budget)},
+			{"id": "month", "header": "Month", "body": status.Month.Format("January 2006")},
+		},
+	}
+}
+
+// getGooglePass returns a Save to Google Wallet link for the user's budget
+// pass. The link carries the pass itself, signed by the service account.
+func (trackerDb *trackerDb) getGooglePass(c echo.Context) error {
+	ctx := context.Background()
+
+	userID, err := strconv.Atoi(c.QueryParam("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+	if trackerDb.env.GoogleWalletIssuerID == "" || trackerDb.env.GoogleCredentialsFile == "" {
+		return respondError(c, http.StatusServiceUnavailable, "Google Wallet passes are not configured")
+	}
+
+	pass, err := trackerDb.walletPass(ctx, userID)
+	if err != nil {
+		log.Printf("Error while getting wallet pass: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	status, err := trackerDb.budgetStatus(ctx, userID, uuid.Nil, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error while getting budget status: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	money, err := trackerDb.moneyFormat(ctx, userID)
+	if err != nil {
+		log.Printf("Could not fetch preferences: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	sa, key, err := trackerDb.serviceAccount()
+	if err != nil {
+		log.Printf("Error while loading the service account: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	jwt, err := signJWT(key, map[string]interface{}{
+		"iss": sa.ClientEmail,
+		"aud": "google",
+		"typ": "savetowallet",
+		"iat": time.Now().Unix(),
+		"payload": map[string]any{
+			"genericClasses": []map[string]string{{"id": trackerDb.env.GoogleWalletIssuerID + ".budget"}},
+			"genericObjects": []map[string]any{trackerDb.googlePassObject(pass, status, money)},
+		},
+	})
+	if err != nil {
+		log.Printf("Error while signing the pass: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	pass.Google = true
+	err = trackerDb.recordWalletPass(ctx, pass, status)
+	if err != nil {
+		log.Printf("Error while saving wallet pass: %+v", err)
+		return respondError(c, http.StatusInternalServerError, "Internal server error")
+	}
+
+	return respondOK(c, map[string]string{"save_url": "https://pay.google.com/gp/v/save/" + jwt})
+}
+
+// patchGooglePass updates the pass's object in Google Wallet, which shows
+// the change on every phone that saved it. A pass whose link was never
+// used has no object yet, which is fine.
+func (trackerDb *trackerDb) patchGooglePass(ctx context.Context, token string, object map[string]any) error {
+	body, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	endpoint := "https://walletobjects.googleapis.com/walletobjects/v1/genericObject/" + url.PathEscape(object["id"].(string))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+
+	res, err := googleWalletClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("google wallet api: %s: %s", res.Status, msg)
+	}
+	return nil
+}
+
+// refreshWalletPasses runs every hour and updates the passes whose numbers
+// have changed, or that still show last month, on the phones holding them.
+func (trackerDb *trackerDb) refreshWalletPasses(ctx context.Context, hour time.Time) error {
+	passes := []WalletPass{}
+	err := trackerDb.db.NewSelect().
+		Model(&passes).
+		Where("wp.google OR EXISTS (SELECT 1 FROM wallet_pass_device wpd WHERE wpd.serial = wp.serial)").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var apns *http.Client
+	if signer, err := trackerDb.passSigner(); err == nil {
+		t := newBaseTransport().(*http.Transport)
+		t.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{signer.tls}}
+		t.ForceAttemptHTTP2 = true
+		apns = &http.Client{Timeout: 30 * time.Second, Transport: &outboundTransport{base: t, hosts: map[string]*circuit{}}}
+	} else if !errors.Is(err, errApplePassDisabled) {
+		return err
+	}
+	var googleToken string
+
+	for i := range passes {
+		pass := &passes[i]
+		status, err := trackerDb.budgetStatus(ctx, pass.UserID, uuid.Nil, hour)
+		if err != nil {
+			return err
+		}
+		if status.Budget == pass.Budget && status.Spent == pass.Spent && !pass.UpdatedAt.Before(status.Month) {
+			continue
+		}
+		err = trackerDb.recordWalletPass(ctx, pass, status)
+		if err != nil {
+			return err
+		}
+
+		if apns != nil {
+			err = trackerDb.pushPassUpdate(ctx, apns, pass.Serial)
+			if err != nil {
+				log.Printf("Error while pushing wallet pass %s: %+v", pass.Serial, err)
+			}
+		}
+		if pass.Google && trackerDb.env.GoogleWalletIssuerID != "" {
+			if googleToken == "" {
+				googleToken, err = trackerDb.googleToken(ctx, googleWalletScope)
+				if err != nil {
+					return err
+				}
+			}
+			money, err := trackerDb.moneyFormat(ctx, pass.UserID)
+			if err == nil {
+				err = trackerDb.patchGooglePass(ctx, googleToken, trackerDb.googlePassObject(pass, status, money))
+			}
+			if err != nil {
+				log.Printf("Error while updating Google Wallet pass %s: %+v", pass.Serial, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/uptrace/bun"
+)
+
+// widgetSummaryTTL is how long a summary is served from memory, and how
+// long clients may keep it, before it is computed again.
+const widgetSummaryTTL = time.Minute
+
+// widgetSummaryVersion is sent as schema_version. Fields may be added to
+// WidgetSummary without changing it; renaming or removing one, or changing
+// what one means, bumps it.
+const widgetSummaryVersion = 1
+
+// WidgetSummary is the little a home-screen widget shows. Every field is
+// always present: amounts are 0 rather than missing, and TopCategory is
+// null when nothing was spent this month. Spending leaves out scheduled,
+// excluded, reimbursed and adjustment items, as analytics does; weeks
+// start on Monday and days are UTC.
+type WidgetSummary struct {
+	SchemaVersion int          `json:"schema_version"`
+	Currency      string       `json:"currency"`
+	Balance       float64      `json:"balance"`
+	SpentToday    float64      `json:"spent_today"`
+	SpentWeek     float64      `json:"spent_week"`
+	SpentMonth    float64      `json:"spent_month"`
+	TopCategory   *TopCategory `json:"top_category"`
+	AsOf          time.Time    `json:"as_of"`
+}
+
+// TopCategory is the category with the most spending this month.
+type TopCategory struct {
+	Name  string  `json:"name"`
+	Spent float64 `json:"spent"`
+}
+
+type widgetKey struct {
+	userID  int
+	profile uuid.UUID
+}
+
+type cachedSummary struct {
+	summary WidgetSummary
+	expires time.Time
+}
+
+// widgetCache keeps each user's summary for widgetSummaryTTL, so widgets
+// polling every few seconds cost one query per user a minute. Like the
+// rate limiter it is per replica.
+type widgetCache struct {
+	mu      sync.Mutex
+	entries map[widgetKey]cachedSummary
+	swept   time.Time
+}
+
+func newWidgetCache() *widgetCache {
+	return &widgetCache{entries: map[widgetKey]cachedSummary{}}
+}
+
+func (w *widgetCache) get(key widgetKey, now time.Time) (WidgetSummary, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e, ok := w.entries[key]
+	return e.summary, ok && now.Before(e.expires)
+}
+
+func (w *widgetCache) put(key widgetKey, summary WidgetSummary, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if now.Sub(w.swept) > widgetSummaryTTL {
+		for k, e := range w.entries {
+			if !now.Before(e.expires) {
+				delete(w.entries, k)
+			}
+		}
+		w.swept = now
+	}
+	w.entries[key] = cachedSummary{summary: summary, expires: now.Add(widgetSummaryTTL)}
+}
+
+// widgetSummary computes the summary for the user's ledger or profile.
+func (trackerDb *trackerDb) widgetSummary(ctx context.Context, key widgetKey, now time.Time) (WidgetSummary, error) {
+	today := now.Truncate(24 * time.Hour)
+	week := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	summary := WidgetSummary{SchemaVersion: widgetSummaryVersion, Currency: trackerDb.env.Currency, AsOf: now}
+	err := trackerDb.db.NewSelect().
+		ColumnExpr("COALESCE(SUM(CASE WHEN i.type = 'credit' THEN i.cost ELSE -i.cost END), 0) AS balance").
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE ? AND i.created_at >= ?), 0) AS spent_today", spendingCondition, today).
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE ? AND i.created_at >= ?), 0) AS spent_week", spendingCondition, week).
+		ColumnExpr("COALESCE(SUM(i.cost) FILTER (WHERE ? AND i.created_at >= ?), 0) AS spent_month", spendingCondition, month).
+		TableExpr("item AS i").
+		Where("i.user_id = ?", key.userID).
+		Where("NOT i.scheduled").
+		Apply(inProfile(key.profile)).
+		Scan(ctx, &summary.Balance, &summary.SpentToday, &summary.SpentWeek, &summary.SpentMonth)
+	if err != nil {
+		return summary, err
+	}
+
+	top := []TopCategory{}
+	err = trackerDb.db.NewSelect().
+		ColumnExpr("COALESCE(c.name, 'Uncategorized') AS name").
+		ColumnExpr("SUM(i.cost) AS spent").
+		TableExpr("item AS i").
+		Join("LEFT JOIN category c ON c.id = i.category_id").
+		Where("i.user_id = ?", key.userID).
+		Where("NOT i.scheduled").
+		Where("i.created_at >= ?", month).
+		Apply(inProfile(key.profile)).
+		Where("?", spendingCondition).
+		GroupExpr("c.name").
+		OrderExpr("spent DESC").
+		Limit(1).
+		Scan(ctx, &top)
+	if len(top) > 0 {
+		summary.TopCategory = &top[0]
+	}
+	return summary, err
+}
+
+// spendingCondition is what the summary counts as spending.
+var spendingCondition = bun.SafeQuery("i.type = 'debit' AND NOT i.excluded AND NOT i.reimbursed AND NOT i.adjustment")
+
+// getWidgetSummary serves GET /me/summary. It is cached in memory and
+// marked cacheable by the client for a minute, and tagged so a poll that
+// finds nothing new costs a 304.
+func (trackerDb *trackerDb) getWidgetSummary(c echo.Context) error {
+	ctx := context.Background()
+
+	userID, err := strconv.Atoi(c.QueryParam("user_id"))
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "user_id must be a number")
+	}
+	key := widgetKey{userID: userID, profile: currentProfile(c)}
+
+	now := time.Now().UTC()
+	summary, ok := trackerDb.widgets.get(key, now)
+	if !ok {
+		summary, err = trackerDb.widgetSummary(ctx, key, now)
+		if err != nil {
+			log.Printf("Error while getting widget summary: %+v", err)
+			return respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		trackerDb.widgets.put(key, summary, now)
+	}
+
+	c.Response().Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(widgetSummaryTTL.Seconds())))
+	return respondOK(c, summary)
+}